@@ -0,0 +1,545 @@
+package hj
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Article is the main content of a page, found by scoring its blocks of text
+// in the way of Mozilla Readability
+type Article struct {
+	Title     string `json:"title,omitempty"`
+	Byline    string `json:"byline,omitempty"`
+	Published string `json:"published,omitempty"`
+	// Image is the URL of the lead image, resolved against the base URL of the document
+	Image string `json:"image,omitempty"`
+	// Content is a div holding cleaned copies of the elements with the main content:
+	// scripts, navigation, forms, comments, presentational attributes and blocks
+	// that look like boilerplate are removed, and links and images use absolute URLs
+	Content *Node `json:"-"`
+}
+
+// articleJSON represents an article with its content in the JSON format of elements
+type articleJSON struct {
+	*Article
+	Content interface{} `json:"content"`
+}
+
+// Patterns of class names and ids, as used by Readability
+var (
+	articleUnlikely    = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote`)
+	articleMaybe       = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	articlePositive    = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	articleNegative    = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	articleBylineClass = regexp.MustCompile(`(?i)byline|author|dateline|writtenby|p-author`)
+	titleSeparator     = regexp.MustCompile(`\s[|\-–—\\/>»]\s`)
+)
+
+// articleSkipTags lists the elements that never hold article content
+var articleSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "link": true, "meta": true,
+	"nav": true, "aside": true, "footer": true, "form": true, "iframe": true, "object": true, "embed": true,
+	"svg": true, "button": true, "input": true, "select": true, "textarea": true, "dialog": true,
+}
+
+// articleUnlikelyRoles lists the ARIA roles of elements that are not article content
+var articleUnlikelyRoles = []string{"menu", "menubar", "complementary", "navigation", "alert", "alertdialog", "dialog"}
+
+// articleScoreTags lists the elements whose text is scored
+var articleScoreTags = map[string]bool{
+	"p": true, "pre": true, "td": true, "section": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// articleBlockTags lists the elements that stop a div from being scored as a paragraph
+var articleBlockTags = map[string]bool{
+	"blockquote": true, "dl": true, "div": true, "img": true, "ol": true, "p": true, "pre": true, "table": true,
+	"ul": true, "section": true, "article": true, "figure": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true,
+}
+
+// articleConditionalTags lists the elements removed from the content when they look like boilerplate
+var articleConditionalTags = map[string]bool{
+	"div": true, "section": true, "ul": true, "ol": true, "header": true,
+}
+
+// articleEmptyTags lists the elements removed from the content when they have no text or media
+var articleEmptyTags = map[string]bool{
+	"p": true, "div": true, "section": true, "span": true, "header": true,
+}
+
+// articleMediaTags lists the elements that keep their parent in the content without any text
+var articleMediaTags = map[string]bool{
+	"img": true, "picture": true, "video": true, "audio": true, "source": true, "br": true, "hr": true,
+}
+
+// articleURLAttributes lists the attributes resolved to absolute URLs in the content
+var articleURLAttributes = []string{"href", "src", "poster"}
+
+// ExtractArticle finds the main content of a document along with its title,
+// byline, published date and lead image. Content falls back to the whole
+// body when no block of text stands out, and is nil for an empty document.
+func ExtractArticle(doc *Document) *Article {
+	meta := articleMeta(doc)
+	base := doc.BaseURL()
+	article := &Article{
+		Title:     articleTitle(doc, meta),
+		Byline:    articleByline(doc, meta),
+		Published: articlePublished(doc, meta),
+	}
+
+	body := articleBody(doc)
+	if body == nil {
+		return article
+	}
+
+	a := &articleReader{scores: map[*Node]float64{}, selected: map[*Node]bool{}}
+	a.score(body)
+	nodes := body.Children
+	if top := a.topCandidate(); top != nil && top.Tag != "body" {
+		nodes = a.siblings(top)
+		for _, n := range nodes {
+			a.selected[n] = true
+		}
+	}
+
+	content := &Node{Type: ElementNode, Tag: "div"}
+	for _, n := range nodes {
+		if c := a.clean(n, content, base); c != nil {
+			content.Children = append(content.Children, c)
+		}
+	}
+	article.Content = content
+
+	if image := firstString(meta, "og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		article.Image = resolveURL(base, image)
+	} else {
+		walkElements(content.Children, func(n *Node) {
+			if src := n.Attributes["src"]; n.Tag == "img" && article.Image == "" && src != "" {
+				article.Image = src
+			}
+		})
+	}
+	return article
+}
+
+// ArticleToJSON writes an article as JSON, with its content in the format of HTMLtoJSON
+func ArticleToJSON(article *Article, opts Options) ([]byte, error) {
+	out := articleJSON{Article: article}
+	if article.Content != nil {
+		out.Content = nodeToJSON(article.Content, opts)
+	}
+	return marshalJSON(out, opts)
+}
+
+// articleReader scores the elements of a document as candidates for the article content
+type articleReader struct {
+	scores     map[*Node]float64
+	candidates []*Node
+	// selected holds the top candidate and its siblings taken with it,
+	// which are kept even when they look like boilerplate
+	selected map[*Node]bool
+}
+
+// score scores the paragraphs under n and adds their scores to their ancestors,
+// skipping the elements that are unlikely to be content
+func (a *articleReader) score(n *Node) {
+	for _, c := range n.Children {
+		if c.Type != ElementNode || articleSkipTags[c.Tag] || unlikelyArticleNode(c) {
+			continue
+		}
+		if articleScoreTags[c.Tag] || (c.Tag == "div" && !hasBlockChild(c)) {
+			a.scoreParagraph(c)
+		}
+		a.score(c)
+	}
+}
+
+// scoreParagraph adds the score of a paragraph to its parent, half of it to
+// its grandparent and less to the three ancestors above
+func (a *articleReader) scoreParagraph(n *Node) {
+	text := collapsedText(n)
+	length := utf8.RuneCountInString(text)
+	if length < 25 {
+		return
+	}
+	score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(length/100), 3)
+
+	level := 0
+	for p := n.Parent; p != nil && p.Type == ElementNode && level < 5; p = p.Parent {
+		if _, ok := a.scores[p]; !ok {
+			a.scores[p] = initialArticleScore(p)
+			a.candidates = append(a.candidates, p)
+		}
+		switch level {
+		case 0:
+			a.scores[p] += score
+		case 1:
+			a.scores[p] += score / 2
+		default:
+			a.scores[p] += score / float64(level*3)
+		}
+		level++
+	}
+}
+
+// topCandidate scales the score of every candidate by the share of its text
+// outside links and returns the best one, or nil when nothing was scored
+func (a *articleReader) topCandidate() *Node {
+	var top *Node
+	for _, n := range a.candidates {
+		a.scores[n] *= 1 - linkDensity(n)
+		if top == nil || a.scores[n] > a.scores[top] {
+			top = n
+		}
+	}
+	return top
+}
+
+// siblings returns the top candidate and the siblings that look like part of the same content
+func (a *articleReader) siblings(top *Node) []*Node {
+	if top.Parent == nil {
+		return []*Node{top}
+	}
+	threshold := math.Max(10, a.scores[top]*0.2)
+
+	var nodes []*Node
+	for _, s := range top.Parent.Children {
+		if s.Type != ElementNode {
+			continue
+		}
+		if s == top {
+			nodes = append(nodes, s)
+			continue
+		}
+		score, scored := a.scores[s]
+		if class := s.Attributes["class"]; class != "" && class == top.Attributes["class"] {
+			score += a.scores[top] * 0.2
+		}
+		if scored && score >= threshold {
+			nodes = append(nodes, s)
+			continue
+		}
+		if s.Tag == "p" {
+			text := collapsedText(s)
+			length := utf8.RuneCountInString(text)
+			density := linkDensity(s)
+			if (length > 80 && density < 0.25) || (length > 0 && density == 0 && strings.Contains(text, ". ")) {
+				nodes = append(nodes, s)
+			}
+		}
+	}
+	return nodes
+}
+
+// clean returns a cleaned copy of n, or nil when n is not part of the content
+func (a *articleReader) clean(n *Node, parent *Node, base *url.URL) *Node {
+	switch n.Type {
+	case TextNode:
+		return &Node{Type: TextNode, Text: n.Text, Parent: parent}
+	case ElementNode:
+	default:
+		return nil
+	}
+	if articleSkipTags[n.Tag] || (!a.selected[n] && (unlikelyArticleNode(n) || a.boilerplate(n))) {
+		return nil
+	}
+	// The byline is already in Article.Byline
+	if !a.selected[n] && articleBylineClass.MatchString(n.Attributes["class"]+" "+n.ID) && utf8.RuneCountInString(collapsedText(n)) < 100 {
+		return nil
+	}
+
+	c := &Node{Type: ElementNode, Tag: n.Tag, ID: n.ID, Parent: parent}
+	for key, val := range n.Attributes {
+		if key == "style" || key == "class" || key == "align" || strings.HasPrefix(key, "on") {
+			continue
+		}
+		if indexOfString(articleURLAttributes, key) >= 0 {
+			val = resolveURL(base, val)
+		}
+		if c.Attributes == nil {
+			c.Attributes = map[string]string{}
+		}
+		c.Attributes[key] = val
+	}
+	for _, child := range n.Children {
+		if cc := a.clean(child, c, base); cc != nil {
+			c.Children = append(c.Children, cc)
+		}
+	}
+
+	if articleEmptyTags[n.Tag] && strings.Trim(textContent(c), whitespaceChars) == "" && !hasMedia(c) {
+		return nil
+	}
+	return c
+}
+
+// boilerplate reports whether a heading or block looks like boilerplate
+// rather than content, following the conditional cleaning of Readability
+func (a *articleReader) boilerplate(n *Node) bool {
+	weight := classWeight(n)
+	switch n.Tag {
+	case "h1", "h2", "h3":
+		return weight < 0
+	}
+	if !articleConditionalTags[n.Tag] {
+		return false
+	}
+	if float64(weight)+a.scores[n] < 0 {
+		return true
+	}
+
+	text := collapsedText(n)
+	if strings.Count(text, ",") >= 10 {
+		return false
+	}
+	var paragraphs, images, items, inputs, headings int
+	walkElements(n.Children, func(c *Node) {
+		switch c.Tag {
+		case "p":
+			paragraphs++
+		case "img":
+			images++
+		case "li":
+			items++
+		case "input":
+			inputs++
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			headings++
+		}
+	})
+	list := n.Tag == "ul" || n.Tag == "ol"
+	length := utf8.RuneCountInString(text)
+	density := linkDensity(n)
+
+	switch {
+	case images > 1 && float64(paragraphs)/float64(images) < 0.5:
+		return true
+	case !list && items-100 > paragraphs:
+		return true
+	case inputs > paragraphs/3:
+		return true
+	case !list && headings == 0 && length < 25 && (images == 0 || images > 2) && density > 0:
+		return true
+	case weight < 25 && density > 0.2:
+		return true
+	case weight >= 25 && density > 0.5:
+		return true
+	}
+	return false
+}
+
+// unlikelyArticleNode reports whether the class, id or role of n marks it as
+// something other than content, such as a sidebar, comments or navigation
+func unlikelyArticleNode(n *Node) bool {
+	switch n.Tag {
+	case "html", "body", "article", "main", "a":
+		return false
+	}
+	if indexOfString(articleUnlikelyRoles, n.Attributes["role"]) >= 0 {
+		return true
+	}
+	match := n.Attributes["class"] + " " + n.ID
+	return articleUnlikely.MatchString(match) && !articleMaybe.MatchString(match)
+}
+
+// initialArticleScore returns the score of a candidate before adding its paragraphs
+func initialArticleScore(n *Node) float64 {
+	score := float64(classWeight(n))
+	switch n.Tag {
+	case "div", "article", "main":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	return score
+}
+
+// classWeight returns 25 for each of the class and id of n that look like
+// content and -25 for each that look like boilerplate
+func classWeight(n *Node) int {
+	weight := 0
+	for _, name := range []string{n.Attributes["class"], n.ID} {
+		if name == "" {
+			continue
+		}
+		if articleNegative.MatchString(name) {
+			weight -= 25
+		}
+		if articlePositive.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity returns the share of the text of n that is inside links
+func linkDensity(n *Node) float64 {
+	length := utf8.RuneCountInString(collapsedText(n))
+	if length == 0 {
+		return 0
+	}
+	links := 0
+	walkElements(n.Children, func(c *Node) {
+		if c.Tag == "a" {
+			links += utf8.RuneCountInString(collapsedText(c))
+		}
+	})
+	return float64(links) / float64(length)
+}
+
+// hasBlockChild reports whether n has a descendant block element
+func hasBlockChild(n *Node) bool {
+	found := false
+	walkElements(n.Children, func(c *Node) {
+		found = found || articleBlockTags[c.Tag]
+	})
+	return found
+}
+
+// hasMedia reports whether n contains an image, video or other media element
+func hasMedia(n *Node) bool {
+	found := false
+	walkElements(n.Children, func(c *Node) {
+		found = found || articleMediaTags[c.Tag]
+	})
+	return found
+}
+
+// collapsedText returns the text of n with whitespace collapsed
+func collapsedText(n *Node) string {
+	return strings.Join(strings.Fields(textContent(n)), " ")
+}
+
+// articleBody returns the body of a document. For a fragment it returns an
+// element holding the top-level nodes without changing their parents.
+func articleBody(doc *Document) *Node {
+	var body *Node
+	walkElements(doc.Children, func(n *Node) {
+		if body == nil && n.Tag == "body" {
+			body = n
+		}
+	})
+	if body == nil && len(doc.Children) > 0 {
+		body = &Node{Type: ElementNode, Tag: "body", Children: doc.Children}
+	}
+	return body
+}
+
+// articleMeta returns the content of the meta elements by lowercase name or
+// property, keeping the first element for each
+func articleMeta(doc *Document) map[string]string {
+	meta := map[string]string{}
+	walkElements(doc.Children, func(n *Node) {
+		if n.Tag != "meta" {
+			return
+		}
+		content := strings.Trim(n.Attributes["content"], whitespaceChars)
+		for _, attr := range []string{"property", "name", "itemprop"} {
+			for _, name := range strings.Fields(strings.ToLower(n.Attributes[attr])) {
+				if _, ok := meta[name]; !ok && content != "" {
+					meta[name] = content
+				}
+			}
+		}
+	})
+	return meta
+}
+
+// firstString returns the first non-empty value of keys in meta
+func firstString(meta map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := meta[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// articleTitle returns the OpenGraph or Twitter title, or else the title
+// element without the site name, or else the first h1
+func articleTitle(doc *Document, meta map[string]string) string {
+	if title := firstString(meta, "og:title", "twitter:title", "headline"); title != "" {
+		return title
+	}
+
+	var title, heading string
+	walkElements(doc.Children, func(n *Node) {
+		switch {
+		case n.Tag == "title" && title == "":
+			title = collapsedText(n)
+		case n.Tag == "h1" && heading == "":
+			heading = collapsedText(n)
+		}
+	})
+	if title == "" {
+		return heading
+	}
+
+	// Drop the site name after the last separator, unless too little is left
+	if loc := titleSeparator.FindAllStringIndex(title, -1); loc != nil {
+		if head := title[:loc[len(loc)-1][0]]; len(strings.Fields(head)) >= 3 || (heading != "" && head == heading) {
+			return head
+		}
+	}
+	return title
+}
+
+// articleByline returns the author from the meta elements, or else the text
+// of the first short element marked as the author or byline
+func articleByline(doc *Document, meta map[string]string) string {
+	if author := firstString(meta, "author", "article:author", "dc.creator", "twitter:creator"); author != "" && !strings.Contains(author, "://") {
+		return author
+	}
+
+	var byline string
+	walkElements(doc.Children, func(n *Node) {
+		if byline != "" || articleSkipTags[n.Tag] {
+			return
+		}
+		if n.Attributes["rel"] != "author" && !strings.Contains(n.Attributes["itemprop"], "author") &&
+			!articleBylineClass.MatchString(n.Attributes["class"]+" "+n.ID) {
+			return
+		}
+		if text := collapsedText(n); text != "" && utf8.RuneCountInString(text) < 100 {
+			byline = text
+		}
+	})
+	return byline
+}
+
+// articlePublished returns the published date from the meta elements, or
+// else from the first element with itemprop datePublished or a time element
+func articlePublished(doc *Document, meta map[string]string) string {
+	if date := firstString(meta, "article:published_time", "datepublished", "date", "pubdate", "publishdate",
+		"publish-date", "dc.date", "dcterms.created"); date != "" {
+		return date
+	}
+
+	var published, datetime string
+	walkElements(doc.Children, func(n *Node) {
+		if published == "" && strings.Contains(n.Attributes["itemprop"], "datePublished") {
+			published = firstNonEmpty(n.Attributes["datetime"], n.Attributes["content"], collapsedText(n))
+		}
+		if value := strings.Trim(n.Attributes["datetime"], whitespaceChars); n.Tag == "time" && datetime == "" {
+			datetime = value
+		}
+	})
+	return firstNonEmpty(published, datetime)
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package hj
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestExtractArticle tests finding the main content of a page and its details
+func TestExtractArticle(t *testing.T) {
+	paragraph := "This paragraph is long enough to be scored, with a comma or two, as the text of an article."
+
+	tests := []struct {
+		name      string
+		input     string
+		title     string
+		byline    string
+		published string
+		image     string
+		content   string
+	}{
+		{
+			name: "Article between navigation and comments",
+			input: `<html><head><title>Park plan approved | Daily News</title>
+<meta name="author" content="Jane Doe"><meta property="article:published_time" content="2024-05-01">
+<meta property="og:image" content="/images/park.jpg"></head><body>
+<nav><a href="/">Home</a></nav>
+<div class="sidebar"><p>` + paragraph + `</p></div>
+<article class="post"><h1>Park plan approved</h1><p class="byline">By Jane Doe</p>
+<p onclick="x()" style="color: red">` + paragraph + `</p>
+<div class="share"><a href="/share">Share</a></div>
+<p>` + paragraph + ` <a href="more.html">More</a></p><script>track()</script></article>
+<div id="comments"><p>` + paragraph + `</p></div>
+<footer><p>` + paragraph + `</p></footer></body></html>`,
+			title:     "Park plan approved",
+			byline:    "Jane Doe",
+			published: "2024-05-01",
+			image:     "https://news.example.com/images/park.jpg",
+			content: `{"div":{"child":[{"article":{"child":[{"h1":{"child":"Park plan approved"}},{"p":{"child":"` + paragraph + `"}},` +
+				`{"p":{"child":["` + paragraph + ` ",{"a":{"attributes":{"href":"https://news.example.com/local/more.html"},"child":"More"}}]}}]}}]}}`,
+		},
+		{
+			name: "Siblings of the best block",
+			input: `<body><div class="main"><div class="text"><p>` + paragraph + `</p><p>` + paragraph + `</p></div>
+<p>` + paragraph + `</p><ul><li><a href="/a">Link</a></li></ul></div></body>`,
+			content: `{"div":{"child":[{"div":{"child":[{"p":{"child":"` + paragraph + `"}},{"p":{"child":"` + paragraph + `"}}]}},` +
+				`{"p":{"child":"` + paragraph + `"}}]}}`,
+		},
+		{
+			name:    "Whole body without enough text",
+			input:   `<title>Short</title><h1>Heading</h1><p>Short text.</p><img src="a.png">`,
+			title:   "Short",
+			image:   "https://news.example.com/local/a.png",
+			content: `{"div":{"child":[{"h1":{"child":"Heading"}},{"p":{"child":"Short text."}},{"img":{"attributes":{"src":"https://news.example.com/local/a.png"}}}]}}`,
+		},
+		{
+			name: "Details from the body",
+			input: `<title>A - B</title><h1>Heading</h1><span itemprop="author">John Roe</span>
+<time datetime="2024-06-01">June 1</time>`,
+			title:     "A - B",
+			byline:    "John Roe",
+			published: "2024-06-01",
+			content:   `{"div":{"child":[{"h1":{"child":"Heading"}},{"span":{"attributes":{"itemprop":"author"},"child":"John Roe"}},{"time":{"attributes":{"datetime":"2024-06-01"},"child":"June 1"}}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc.Metadata = &Metadata{Source: "https://news.example.com/local/park.html"}
+
+			article := ExtractArticle(doc)
+			if article.Title != tt.title || article.Byline != tt.byline || article.Published != tt.published || article.Image != tt.image {
+				t.Errorf("Details mismatch\nExpected: %q %q %q %q\nActual:   %q %q %q %q",
+					tt.title, tt.byline, tt.published, tt.image, article.Title, article.Byline, article.Published, article.Image)
+			}
+			content, err := ArticleToJSON(&Article{Content: article.Content}, Options{Compact: true, MixedContent: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if expected := `{"content":` + tt.content + `}`; string(content) != expected {
+				t.Errorf("Content mismatch\nExpected: %s\nActual:   %s", expected, content)
+			}
+		})
+	}
+}
+
+// TestExtractArticle_Sample tests that the sample document has a title and content
+func TestExtractArticle_Sample(t *testing.T) {
+	file, err := os.Open("sample.html")
+	if err != nil {
+		t.Fatalf("Failed to open sample.html: %v", err)
+	}
+	defer file.Close()
+
+	doc, err := Parse(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	article := ExtractArticle(doc)
+	if article.Title == "" || article.Content == nil {
+		t.Errorf("Expected a title and content, got %+v", article)
+	}
+	if _, err := ArticleToJSON(article, Options{}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
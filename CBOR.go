@@ -0,0 +1,334 @@
+package hj
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CBOR major types
+const (
+	cborUnsigned byte = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborBreak ends an item of indefinite length
+const cborBreak = 0xff
+
+// CBOREncoder writes CBOR (RFC 8949). Integers use the shortest encoding
+// and other numbers are written as 64-bit floats.
+type CBOREncoder struct{}
+
+// Encode writes v as a single CBOR data item
+func (e CBOREncoder) Encode(w io.Writer, v interface{}) error {
+	var b bytes.Buffer
+	if err := writeCBOR(&b, v); err != nil {
+		return fmt.Errorf("failed to convert to CBOR: %v", err)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeCBORHead writes the initial byte of a data item and its argument
+func writeCBORHead(b *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		b.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		b.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		b.Write(binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(n)))
+	case n <= math.MaxUint32:
+		b.Write(binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(n)))
+	default:
+		b.Write(binary.BigEndian.AppendUint64([]byte{major | 27}, n))
+	}
+}
+
+// writeCBOR writes v and its members
+func writeCBOR(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteByte(0xf6)
+	case bool:
+		if v {
+			b.WriteByte(0xf5)
+		} else {
+			b.WriteByte(0xf4)
+		}
+	case json.Number:
+		n, err := parseNumber(v)
+		if err != nil {
+			return err
+		}
+		switch n := n.(type) {
+		case int64:
+			if n < 0 {
+				writeCBORHead(b, cborNegative, uint64(-(n + 1)))
+			} else {
+				writeCBORHead(b, cborUnsigned, uint64(n))
+			}
+		case uint64:
+			writeCBORHead(b, cborUnsigned, n)
+		case float64:
+			b.Write(binary.BigEndian.AppendUint64([]byte{0xfb}, math.Float64bits(n)))
+		}
+	case string:
+		writeCBORHead(b, cborText, uint64(len(v)))
+		b.WriteString(v)
+	case []interface{}:
+		writeCBORHead(b, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := writeCBOR(b, item); err != nil {
+				return err
+			}
+		}
+	case Object:
+		writeCBORHead(b, cborMap, uint64(len(v)))
+		for _, f := range v {
+			writeCBORHead(b, cborText, uint64(len(f.Key)))
+			b.WriteString(f.Key)
+			if err := writeCBOR(b, f.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported value of type %T", v)
+	}
+	return nil
+}
+
+// CBORDecoder reads CBOR (RFC 8949). Tags are ignored, byte strings are read
+// as strings and undefined as null.
+type CBORDecoder struct{}
+
+// Decode reads a single CBOR data item from r
+func (d CBORDecoder) Decode(r io.Reader) (interface{}, error) {
+	br := bufio.NewReader(r)
+	v, err := readCBOR(br, 0)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CBOR: %v", err)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("failed to parse CBOR: unexpected data after the value")
+	}
+	return v, nil
+}
+
+// readCBOR reads a data item nested in depth arrays and maps
+func readCBOR(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, fmt.Errorf("nesting is too deep")
+	}
+	initial, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := initial>>5, initial&0x1f
+
+	if major == cborSimple {
+		return readCBORSimple(r, info)
+	}
+	if info == 31 {
+		return readCBORIndefinite(r, major, depth)
+	}
+	n, err := readCBORArgument(r, info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case cborNegative:
+		value := new(big.Int).SetUint64(n)
+		return json.Number(value.Neg(value.Add(value, big.NewInt(1))).String()), nil
+	case cborBytes, cborText:
+		data, err := readBytes(r, n)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText && !utf8.Valid(data) {
+			return nil, fmt.Errorf("invalid UTF-8 in text string")
+		}
+		return string(data), nil
+	case cborArray:
+		list := make([]interface{}, 0, min(n, 1024))
+		for ; n > 0; n-- {
+			item, err := readCBOR(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case cborMap:
+		obj := make(Object, 0, min(n, 1024))
+		for ; n > 0; n-- {
+			field, err := readCBORField(r, depth)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field)
+		}
+		return obj, nil
+	}
+	// Tagged data item
+	return readCBOR(r, depth+1)
+}
+
+// readCBORArgument reads the argument of a data item from its additional information
+func readCBORArgument(r io.Reader, info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+	if info > 27 {
+		return 0, fmt.Errorf("invalid additional information %d", info)
+	}
+	data, err := readBytes(r, 1<<(info-24))
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range data {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// readCBORField reads a key and value of a map
+func readCBORField(r *bufio.Reader, depth int) (Field, error) {
+	key, err := readCBOR(r, depth+1)
+	if err != nil {
+		return Field{}, err
+	}
+	name, ok := key.(string)
+	if !ok {
+		return Field{}, fmt.Errorf("map key must be a string, got %v", key)
+	}
+	value, err := readCBOR(r, depth+1)
+	if err != nil {
+		return Field{}, err
+	}
+	return Field{Key: name, Value: value}, nil
+}
+
+// readCBORIndefinite reads a string, array or map of indefinite length
+func readCBORIndefinite(r *bufio.Reader, major byte, depth int) (interface{}, error) {
+	var chunks []byte
+	list := []interface{}{}
+	obj := Object{}
+	for {
+		next, err := r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if next[0] == cborBreak {
+			r.ReadByte()
+			break
+		}
+
+		switch major {
+		case cborBytes, cborText:
+			// Strings are split into chunks of definite length of the same type
+			if next[0]>>5 != major || next[0]&0x1f == 31 {
+				return nil, fmt.Errorf("invalid chunk in string of indefinite length")
+			}
+			chunk, err := readCBOR(r, depth)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, chunk.(string)...)
+		case cborArray:
+			item, err := readCBOR(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		case cborMap:
+			field, err := readCBORField(r, depth)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field)
+		default:
+			return nil, fmt.Errorf("major type %d cannot have indefinite length", major)
+		}
+	}
+
+	switch major {
+	case cborArray:
+		return list, nil
+	case cborMap:
+		return obj, nil
+	}
+	return string(chunks), nil
+}
+
+// readCBORSimple reads a simple value or floating-point number
+func readCBORSimple(r io.Reader, info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25, 26, 27:
+		n, err := readCBORArgument(r, info)
+		if err != nil {
+			return nil, err
+		}
+		switch info {
+		case 25:
+			return numberValue(halfToFloat(uint16(n))), nil
+		case 26:
+			return numberValue(float64(math.Float32frombits(uint32(n)))), nil
+		}
+		return numberValue(math.Float64frombits(n)), nil
+	case 31:
+		return nil, fmt.Errorf("unexpected break")
+	}
+	return nil, fmt.Errorf("unsupported simple value %d", info)
+}
+
+// halfToFloat converts an IEEE 754 half-precision number
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
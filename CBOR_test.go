@@ -0,0 +1,172 @@
+package hj
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCBOREncoder tests encoding against the examples of RFC 8949 Appendix A
+func TestCBOREncoder(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected string
+	}{
+		{json: `0`, expected: "00"},
+		{json: `23`, expected: "17"},
+		{json: `24`, expected: "1818"},
+		{json: `1000`, expected: "1903e8"},
+		{json: `1000000`, expected: "1a000f4240"},
+		{json: `1000000000000`, expected: "1b000000e8d4a51000"},
+		{json: `18446744073709551615`, expected: "1bffffffffffffffff"},
+		{json: `-1`, expected: "20"},
+		{json: `-1000`, expected: "3903e7"},
+		{json: `1.1`, expected: "fb3ff199999999999a"},
+		{json: `false`, expected: "f4"},
+		{json: `true`, expected: "f5"},
+		{json: `null`, expected: "f6"},
+		{json: `""`, expected: "60"},
+		{json: `"IETF"`, expected: "6449455446"},
+		{json: `"ü"`, expected: "62c3bc"},
+		{json: `[1,[2,3],[4,5]]`, expected: "8301820203820405"},
+		{json: `{"a":1,"b":[2,3]}`, expected: "a26161016162820203"},
+		{json: `{"p":{"child":"text"}}`, expected: "a16170a1656368696c646474657874"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Transcode(&buf, []byte(tt.json), CBOREncoder{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := hex.EncodeToString(buf.Bytes()); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestCBORDecoder tests decoding the examples of RFC 8949 Appendix A
+func TestCBORDecoder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "1818", expected: `24`},
+		{input: "1bffffffffffffffff", expected: `18446744073709551615`},
+		{input: "3bffffffffffffffff", expected: `-18446744073709551616`},
+		{input: "3863", expected: `-100`},
+		{input: "f93c00", expected: `1`},
+		{input: "f97bff", expected: `65504`},
+		{input: "f9c400", expected: `-4`},
+		{input: "f90001", expected: `5.960464477539063e-08`},
+		{input: "fa47c35000", expected: `100000`},
+		{input: "fb3ff199999999999a", expected: `1.1`},
+		{input: "f97c00", expected: `"Infinity"`},
+		{input: "f97e00", expected: `"NaN"`},
+		{input: "f7", expected: `null`},
+		{input: "6449455446", expected: `"IETF"`},
+		{input: "4449455446", expected: `"IETF"`},
+		{input: "c074323031332d30332d32315432303a30343a30305a", expected: `"2013-03-21T20:04:00Z"`},
+		{input: "7f657374726561646d696e67ff", expected: `"streaming"`},
+		{input: "9fff", expected: `[]`},
+		{input: "9f018202039f0405ffff", expected: `[1,[2,3],[4,5]]`},
+		{input: "bf61610161629f0203ffff", expected: `{"a":1,"b":[2,3]}`},
+		{input: "a26162016161820203", expected: `{"b":1,"a":[2,3]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			v, err := CBORDecoder{}.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := (JSONEncoder{Compact: true}).Encode(&buf, v); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestCBORDecoder_Errors tests decoding invalid CBOR
+func TestCBORDecoder_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Empty", input: ""},
+		{name: "Truncated", input: "83010203"[:6]},
+		{name: "Truncated string", input: "6449455446"[:6]},
+		{name: "Trailing data", input: "0101"},
+		{name: "Integer key", input: "a10102"},
+		{name: "Invalid UTF-8", input: "61ff"},
+		{name: "Unexpected break", input: "ff"},
+		{name: "Unterminated array", input: "9f01"},
+		{name: "Nested chunk", input: "7f7fffff"},
+		{name: "Too deep", input: strings.Repeat("81", maxDecodeDepth+2) + "00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			if _, err := (CBORDecoder{}).Decode(bytes.NewReader(data)); err == nil {
+				t.Errorf("Expected error for %s", tt.input)
+			}
+		})
+	}
+}
+
+// TestDecodeDocument tests that documents written in the binary formats are read back
+func TestDecodeDocument(t *testing.T) {
+	data, err := os.ReadFile("sample.html")
+	if err != nil {
+		t.Fatalf("Failed to read sample.html: %v", err)
+	}
+	input := string(data) + `<!-- comment --><script>if (a < b) {}</script>`
+
+	for _, opts := range []Options{{}, {Lossless: true}} {
+		doc, err := ParseWithOptions(strings.NewReader(input), opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		jsonOutput, err := doc.ToJSON(opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, format := range []string{"json", "cbor", "msgpack"} {
+			enc, _ := LookupEncoder(format)
+			dec, err := LookupDecoder(format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := doc.Encode(&buf, enc, opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			decoded, err := DecodeDocument(&buf, dec)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", format, err)
+			}
+			result, err := decoded.ToJSON(opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(result) != string(jsonOutput) {
+				t.Errorf("%s with %+v: expected:\n%s\nGot:\n%s", format, opts, jsonOutput, result)
+			}
+		}
+	}
+
+	if _, err := LookupDecoder("yaml"); err == nil || err.Error() != "format cannot be read: yaml" {
+		t.Errorf("Expected error for yaml, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package hj
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// detectEncoding returns the encoding named by label, or the encoding
+// detected from data and contentType when label is empty. It also reports
+// whether the encoding was declared by label, a byte order mark, contentType
+// or a <meta> tag rather than guessed.
+func detectEncoding(data []byte, contentType, label string) (encoding.Encoding, string, bool, error) {
+	if label != "" {
+		enc, name := charset.Lookup(label)
+		if enc == nil {
+			return nil, "", false, fmt.Errorf("unknown encoding: %s", label)
+		}
+		return enc, name, true, nil
+	}
+	enc, name, certain := charset.DetermineEncoding(data, contentType)
+	return enc, name, certain || declaresCharset(data), nil
+}
+
+// declaresCharset reports whether the <meta> tags in the first 1024 bytes of
+// data name a character encoding other than UTF-8
+func declaresCharset(data []byte) bool {
+	// DetermineEncoding guesses UTF-8 for valid UTF-8 text with non-ASCII
+	// characters only when no <meta> tag names another encoding, so the head
+	// after such a character is read as UTF-8 unless it declares one
+	probe := append([]byte("\u00e9"), data[:min(len(data), 1022)]...)
+	_, name, _ := charset.DetermineEncoding(probe, "")
+	return name != "utf-8"
+}
+
+// validUTF8 reports whether data is valid UTF-8. When truncated is true data
+// is the start of a longer input, and a character cut off at its end is ignored.
+func validUTF8(data []byte, truncated bool) bool {
+	if truncated {
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					data = data[:i]
+				}
+				break
+			}
+		}
+	}
+	return utf8.Valid(data)
+}
+
+// DecodeHTML converts HTML bytes in any supported character encoding to UTF-8.
+// When label is not empty the content is read in that encoding, otherwise the
+// encoding is detected from a byte order mark, the charset parameter of
+// contentType and <meta charset> or http-equiv tags, in that order. Content
+// that declares no encoding is read as UTF-8 when it is valid UTF-8.
+// It returns the UTF-8 content and the name of the encoding that was used.
+func DecodeHTML(data []byte, contentType, label string) (string, string, error) {
+	enc, name, declared, err := detectEncoding(data, contentType, label)
+	if err != nil {
+		return "", "", err
+	}
+	if !declared && validUTF8(data, false) {
+		enc, name = encoding.Nop, "utf-8"
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode %s: %v", name, err)
+	}
+
+	// The byte order mark is not part of the content
+	return strings.TrimPrefix(string(decoded), "\uFEFF"), name, nil
+}
+
+// NewDecodingReader is the streaming counterpart of DecodeHTML. The encoding
+// is detected from the first 1024 bytes of r, which is as far as <meta>
+// tags are searched, and content that declares no encoding is read as UTF-8
+// unless those bytes are not valid UTF-8. Unlike DecodeHTML, which checks the
+// whole input, it cannot see undeclared text in another encoding after them.
+// It returns a reader of the UTF-8 content and the name of the encoding that
+// was used.
+func NewDecodingReader(r io.Reader, contentType, label string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, 1024)
+	data, err := br.Peek(1024)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", fmt.Errorf("failed to read input: %v", err)
+	}
+
+	enc, name, declared, err := detectEncoding(data, contentType, label)
+	if err != nil {
+		return nil, "", err
+	}
+	if !declared && validUTF8(data, len(data) == 1024) {
+		enc, name = encoding.Nop, "utf-8"
+	}
+
+	// The byte order mark is not part of the content
+	decoded := bufio.NewReader(enc.NewDecoder().Reader(br))
+	if bom, err := decoded.Peek(3); err == nil && bytes.Equal(bom, []byte("\uFEFF")) {
+		decoded.Discard(3)
+	}
+	return decoded, name, nil
+}
@@ -0,0 +1,151 @@
+package hj
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestDecodeHTML tests character encoding detection and conversion
+func TestDecodeHTML(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		label       string
+		expected    string
+		encoding    string
+	}{
+		{
+			name:     "UTF-8",
+			data:     []byte("<p>こんにちは</p>"),
+			expected: "<p>こんにちは</p>",
+			encoding: "utf-8",
+		},
+		{
+			name:     "UTF-8 BOM",
+			data:     []byte("\xef\xbb\xbf<p>a</p>"),
+			expected: "<p>a</p>",
+			encoding: "utf-8",
+		},
+		{
+			name:     "UTF-16LE BOM",
+			data:     []byte("\xff\xfe<\x00p\x00>\x00"),
+			expected: "<p>",
+			encoding: "utf-16le",
+		},
+		{
+			name:        "Content-Type charset",
+			data:        []byte("<p>\x82\xa0</p>"),
+			contentType: "text/html; charset=Shift_JIS",
+			expected:    "<p>あ</p>",
+			encoding:    "shift_jis",
+		},
+		{
+			name:     "Meta charset",
+			data:     []byte("<meta charset=\"euc-jp\"><p>\xa4\xa2</p>"),
+			expected: "<meta charset=\"euc-jp\"><p>あ</p>",
+			encoding: "euc-jp",
+		},
+		{
+			name:     "Meta http-equiv",
+			data:     []byte("<meta http-equiv=\"Content-Type\" content=\"text/html; charset=Shift_JIS\"><p>\x82\xa0</p>"),
+			expected: "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=Shift_JIS\"><p>あ</p>",
+			encoding: "shift_jis",
+		},
+		{
+			name:     "ISO-8859-1",
+			data:     []byte("<meta charset=\"iso-8859-1\"><p>caf\xe9</p>"),
+			expected: "<meta charset=\"iso-8859-1\"><p>café</p>",
+			encoding: "windows-1252",
+		},
+		{
+			name:     "UTF-8 after a long ASCII head",
+			data:     []byte("<head><!--" + strings.Repeat("x", 1100) + "--></head><p>日本語 café</p>"),
+			expected: "<head><!--" + strings.Repeat("x", 1100) + "--></head><p>日本語 café</p>",
+			encoding: "utf-8",
+		},
+		{
+			name:     "Undeclared windows-1252",
+			data:     []byte("<p>caf\xe9</p>"),
+			expected: "<p>café</p>",
+			encoding: "windows-1252",
+		},
+		{
+			name:     "Meta charset before a long ASCII head",
+			data:     []byte("<meta charset=\"iso-8859-1\"><!--" + strings.Repeat("x", 1100) + "--><p>caf\xc3\xa9</p>"),
+			expected: "<meta charset=\"iso-8859-1\"><!--" + strings.Repeat("x", 1100) + "--><p>cafÃ©</p>",
+			encoding: "windows-1252",
+		},
+		{
+			name:     "Forced label overrides meta",
+			data:     []byte("<meta charset=\"utf-8\"><p>\x82\xa0</p>"),
+			label:    "sjis",
+			expected: "<meta charset=\"utf-8\"><p>あ</p>",
+			encoding: "shift_jis",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, encoding, err := DecodeHTML(tt.data, tt.contentType, tt.label)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+			if encoding != tt.encoding {
+				t.Errorf("Expected encoding %q, got %q", tt.encoding, encoding)
+			}
+		})
+	}
+}
+
+// TestDecodeHTML_UnknownLabel tests forcing an unknown encoding
+func TestDecodeHTML_UnknownLabel(t *testing.T) {
+	if _, _, err := DecodeHTML([]byte("<p>a</p>"), "", "no-such-encoding"); err == nil {
+		t.Error("Expected error for unknown encoding")
+	}
+}
+
+// TestNewDecodingReader tests that the streaming decoder matches DecodeHTML
+func TestNewDecodingReader(t *testing.T) {
+	inputs := []struct {
+		data  []byte
+		label string
+	}{
+		{[]byte("<p>こんにちは</p>"), ""},
+		{[]byte("\xef\xbb\xbf<p>a</p>"), ""},
+		{[]byte("\xff\xfe<\x00p\x00>\x00"), ""},
+		{[]byte("<meta charset=\"euc-jp\"><p>\xa4\xa2</p>"), ""},
+		{append([]byte("<meta charset=\"iso-8859-1\">"+strings.Repeat(" ", 2000)), "caf\xe9"...), ""},
+		{[]byte("<p>\x82\xa0</p>"), "sjis"},
+		{[]byte("<!--" + strings.Repeat("x", 1100) + "--><p>日本語 café</p>"), ""},
+		{[]byte("<p>" + strings.Repeat("あ", 400) + "</p>"), ""},
+	}
+
+	for _, tt := range inputs {
+		expected, expectedName, err := DecodeHTML(tt.data, "", tt.label)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		r, name, err := NewDecodingReader(bytes.NewReader(tt.data), "", tt.label)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		result, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(result) != expected || name != expectedName {
+			t.Errorf("Expected %q (%s), got %q (%s)", expected, expectedName, result, name)
+		}
+	}
+
+	if _, _, err := NewDecodingReader(strings.NewReader("<p>"), "", "no-such-encoding"); err == nil {
+		t.Errorf("Expected error for unknown encoding")
+	}
+}
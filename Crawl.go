@@ -0,0 +1,266 @@
+package hj
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Crawler fetches the pages of a website by following its links from a
+// start page. Only the pages with the same origin (scheme, host and port)
+// as the start page are fetched, each one once.
+type Crawler struct {
+	// Fetcher fetches the pages and robots.txt, or the defaults of a zero
+	// Fetcher are used when it is nil
+	Fetcher *Fetcher
+	// MaxDepth is how many links away from the start page pages are
+	// fetched. 0 fetches the start page only, and a negative value sets no limit.
+	MaxDepth int
+	// MaxPages stops the crawl after this many pages when it is positive
+	MaxPages int
+	// Delay is the least time between two requests to a host. A longer
+	// Crawl-delay in robots.txt is followed.
+	Delay time.Duration
+	// IgnoreRobots fetches pages without reading robots.txt
+	IgnoreRobots bool
+	// Options are used to parse the pages
+	Options Options
+}
+
+// CrawlPage is a page fetched by a Crawler
+type CrawlPage struct {
+	// URL is the URL of the page after redirects
+	URL string `json:"url"`
+	// Status is the HTTP status of the response, or 0 when none was received
+	Status    int       `json:"status"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	// Depth is how many links away from the start page the page was found
+	Depth int `json:"depth"`
+	// Error tells why the page could not be fetched or parsed
+	Error string `json:"error,omitempty"`
+	// Document is the parsed page, or nil for errors and content other than HTML
+	Document *Document `json:"-"`
+}
+
+// crawlPageJSON is a page written with its document in the format of HTMLtoJSON
+type crawlPageJSON struct {
+	*CrawlPage
+	Document interface{} `json:"document,omitempty"`
+}
+
+// CrawlPageToJSON writes a crawled page as JSON, with its document in the format of HTMLtoJSON
+func CrawlPageToJSON(page *CrawlPage, opts Options) ([]byte, error) {
+	out := crawlPageJSON{CrawlPage: page}
+	if page.Document != nil {
+		out.Document = page.Document.toJSON(opts)
+	}
+	return marshalJSON(out, opts)
+}
+
+// crawlItem is a URL waiting to be fetched
+type crawlItem struct {
+	url   string
+	depth int
+}
+
+// Crawl fetches the pages found from startURL in breadth-first order and
+// calls fn for each one, stopping with the error returned by fn. Pages that
+// cannot be fetched are given to fn with their error, and pages disallowed
+// by robots.txt are skipped.
+func (c *Crawler) Crawl(ctx context.Context, startURL string, fn func(*CrawlPage) error) error {
+	start, err := url.Parse(startURL)
+	if err != nil || (start.Scheme != "http" && start.Scheme != "https") || start.Host == "" {
+		return fmt.Errorf("invalid start URL: %s", startURL)
+	}
+	fetcher := cmp.Or(c.Fetcher, &Fetcher{})
+	origin := originOf(start)
+	host := strings.TrimPrefix(origin, start.Scheme+"://")
+
+	queue := []crawlItem{{url: normalizeURL(start), depth: 0}}
+	seen := map[string]bool{queue[0].url: true}
+	lastRequest := map[string]time.Time{}
+	pages := 0
+
+	// Only the start site is crawled, so its robots.txt is read once
+	var rules *Robots
+	if !c.IgnoreRobots {
+		if rules, err = fetchRobots(ctx, fetcher, origin); err != nil {
+			return err
+		}
+		lastRequest[host] = time.Now()
+	}
+
+	for len(queue) > 0 && (c.MaxPages <= 0 || pages < c.MaxPages) {
+		item := queue[0]
+		queue = queue[1:]
+		u, _ := url.Parse(item.url)
+		if !rules.Allowed(u.RequestURI()) {
+			if item.depth == 0 {
+				return fmt.Errorf("start URL is disallowed by robots.txt: %s", startURL)
+			}
+			continue
+		}
+
+		var crawlDelay time.Duration
+		if rules != nil {
+			crawlDelay = rules.CrawlDelay
+		}
+		if err := c.wait(ctx, u.Host, crawlDelay, lastRequest); err != nil {
+			return err
+		}
+		page := c.fetchPage(ctx, fetcher, item)
+		lastRequest[u.Host] = time.Now()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// A redirect to a page that was already seen is not reported twice
+		final, err := url.Parse(page.URL)
+		if err != nil {
+			final = u
+		}
+		if normalized := normalizeURL(final); normalized != item.url {
+			if seen[normalized] {
+				continue
+			}
+			seen[normalized] = true
+		}
+
+		pages++
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if page.Document == nil || originOf(final) != origin || (c.MaxDepth >= 0 && item.depth >= c.MaxDepth) {
+			continue
+		}
+		for _, link := range ExtractLinks(page.Document) {
+			if (link.Tag != "a" && link.Tag != "area") || link.Attribute != "href" || slices.Contains(strings.Fields(strings.ToLower(link.Rel)), "nofollow") {
+				continue
+			}
+			target, err := url.Parse(link.URL)
+			if err != nil || originOf(target) != origin {
+				continue
+			}
+			if normalized := normalizeURL(target); !seen[normalized] {
+				seen[normalized] = true
+				queue = append(queue, crawlItem{url: normalized, depth: item.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+// wait waits until the delay between requests to host has passed since the last request
+func (c *Crawler) wait(ctx context.Context, host string, crawlDelay time.Duration, lastRequest map[string]time.Time) error {
+	last, ok := lastRequest[host]
+	if !ok {
+		return nil
+	}
+	wait := time.Until(last.Add(max(c.Delay, crawlDelay)))
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// fetchPage fetches and parses a page, recording errors in the page
+func (c *Crawler) fetchPage(ctx context.Context, fetcher *Fetcher, item crawlItem) *CrawlPage {
+	page := &CrawlPage{URL: item.url, Depth: item.depth, FetchedAt: time.Now().UTC()}
+	result, err := fetcher.Fetch(ctx, item.url)
+	if err != nil {
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) {
+			page.URL, page.Status = statusErr.URL, statusErr.StatusCode
+		}
+		page.Error = err.Error()
+		return page
+	}
+
+	page.URL, page.Status = result.URL, result.StatusCode
+	if result.StatusCode != http.StatusOK {
+		// Error pages read with AllowErrorStatus are not followed
+		page.Error = (&HTTPStatusError{StatusCode: result.StatusCode}).Error()
+		return page
+	}
+	if mediaType, _, err := mime.ParseMediaType(result.ContentType()); err == nil && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		page.Error = "unsupported content type: " + mediaType
+		return page
+	}
+	if page.Document, err = result.Document(c.Options); err != nil {
+		page.Error = err.Error()
+	}
+	return page
+}
+
+// fetchRobots reads the robots.txt of a site. A missing file allows every
+// page, and a file that cannot be read because of a server or network error
+// is returned as an error, for which RFC 9309 asks to disallow every page.
+func fetchRobots(ctx context.Context, fetcher *Fetcher, origin string) (*Robots, error) {
+	result, err := fetcher.Fetch(ctx, origin+"/robots.txt")
+	var statusErr *HTTPStatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read robots.txt: %v", err)
+	case result.StatusCode >= 400 && result.StatusCode < 500:
+		return nil, nil
+	case result.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to read robots.txt: HTTP error: %d", result.StatusCode)
+	}
+
+	userAgent := fetcher.Header.Get("User-Agent")
+	if userAgent == "" {
+		userAgent = cmp.Or(fetcher.UserAgent, DefaultUserAgent)
+	}
+	robots, err := ParseRobots(bytes.NewReader(result.Body), userAgent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read robots.txt: %v", err)
+	}
+	return robots, nil
+}
+
+// originOf returns the scheme, host and port of a URL, as in "https://example.com"
+func originOf(u *url.URL) string {
+	normalized, err := url.Parse(normalizeURL(u))
+	if err != nil {
+		return ""
+	}
+	return normalized.Scheme + "://" + normalized.Host
+}
+
+// normalizeURL returns a URL in the form used to recognise pages already
+// seen: without its fragment, with the scheme and host in lower case,
+// without a default port and with "/" as the path of the root
+func normalizeURL(u *url.URL) string {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); (n.Scheme == "http" && port == "80") || (n.Scheme == "https" && port == "443") {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	n.Fragment, n.RawFragment = "", ""
+	if n.Path == "" {
+		n.Path, n.RawPath = "/", ""
+	}
+	if n.RawQuery == "" {
+		n.ForceQuery = false
+	}
+	return n.String()
+}
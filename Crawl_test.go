@@ -0,0 +1,222 @@
+package hj
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// crawlSite is a small website used to test the crawler
+type crawlSite struct {
+	*httptest.Server
+	robots string
+
+	mu       sync.Mutex
+	requests []string
+	times    []time.Time
+}
+
+func newCrawlSite(robots string) *crawlSite {
+	site := &crawlSite{robots: robots}
+	pages := map[string]string{
+		"/": `<title>Home</title><a href="/a">A</a> <a href="b#top">B</a> <a href="/a">A again</a>
+<a href="http://other.example/">Other</a> <a href="/hidden" rel="nofollow">Hidden</a> <a href="/private/x">Private</a>
+<a href="/missing">Missing</a> <a href="/doc.pdf">PDF</a> <a href="/old">Old</a> <img src="/image.png">`,
+		"/a": `<title>A</title><a href="/c">C</a> <a href="/">Home</a>`,
+		"/b": `<title>B</title>`,
+		"/c": `<title>C</title><a href="/d">D</a>`,
+		"/d": `<title>D</title>`,
+	}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.requests = append(site.requests, r.URL.RequestURI())
+		site.times = append(site.times, time.Now())
+		site.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			if site.robots == "" {
+				http.NotFound(w, r)
+				return
+			}
+			if site.robots == "error" {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, site.robots)
+		case "/old":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF-1.4")
+		default:
+			page, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, page)
+		}
+	}))
+	return site
+}
+
+// TestCrawler_Crawl tests following links within the site
+func TestCrawler_Crawl(t *testing.T) {
+	site := newCrawlSite("User-agent: *\nDisallow: /private/\nCrawl-delay: 0.02\n")
+	defer site.Close()
+
+	var pages []string
+	crawler := &Crawler{MaxDepth: 2}
+	err := crawler.Crawl(context.Background(), site.URL, func(page *CrawlPage) error {
+		path := strings.TrimPrefix(page.URL, site.URL)
+		summary := fmt.Sprintf("%s %d %d", path, page.Depth, page.Status)
+		if page.Error != "" {
+			summary += " " + page.Error
+		}
+		if page.Document != nil {
+			summary += " " + ExtractPageMeta(page.Document).Title
+		}
+		if page.FetchedAt.IsZero() {
+			t.Errorf("Expected a fetch time for %s", path)
+		}
+		pages = append(pages, summary)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"/ 0 200 Home",
+		"/a 1 200 A",
+		"/b 1 200 B",
+		"/missing 1 404 HTTP error: 404",
+		"/doc.pdf 1 200 unsupported content type: application/pdf",
+		"/c 2 200 C",
+	}
+	if strings.Join(pages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(pages, "\n"))
+	}
+
+	// robots.txtで禁止されたページ、nofollowのリンク、他のサイトは取得しない
+	requests := strings.Join(site.requests, " ")
+	if expected := "/robots.txt / /a /b /missing /doc.pdf /old /a /c"; requests != expected {
+		t.Errorf("Expected requests %s, got %s", expected, requests)
+	}
+	for i := 1; i < len(site.times); i++ {
+		if site.requests[i-1] == "/old" {
+			// The redirect is followed in the same fetch
+			continue
+		}
+		if gap := site.times[i].Sub(site.times[i-1]); gap < 20*time.Millisecond {
+			t.Errorf("Expected the crawl delay between requests, got %v", gap)
+		}
+	}
+}
+
+// TestCrawler_Limits tests the page limit and crawling without robots.txt
+func TestCrawler_Limits(t *testing.T) {
+	site := newCrawlSite("User-agent: *\nDisallow: /\n")
+	defer site.Close()
+
+	var pages []string
+	crawler := &Crawler{MaxDepth: -1, MaxPages: 3, IgnoreRobots: true}
+	err := crawler.Crawl(context.Background(), site.URL+"/a", func(page *CrawlPage) error {
+		pages = append(pages, strings.TrimPrefix(page.URL, site.URL))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(pages, " ") != "/a /c /" {
+		t.Errorf("Expected /a /c /, got %v", pages)
+	}
+	if len(site.requests) != 3 {
+		t.Errorf("Expected 3 requests without robots.txt, got %v", site.requests)
+	}
+
+	// コールバックのエラーでクロールを止める
+	stop := fmt.Errorf("stop")
+	if err := crawler.Crawl(context.Background(), site.URL, func(*CrawlPage) error { return stop }); err != stop {
+		t.Errorf("Expected the error of the callback, got %v", err)
+	}
+}
+
+// TestCrawler_Errors tests crawls that cannot start
+func TestCrawler_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		start  string
+		err    string
+	}{
+		{name: "Disallowed start page", robots: "User-agent: hj\nDisallow: /a\n", start: "/a", err: "start URL is disallowed by robots.txt"},
+		{name: "Unavailable robots.txt", robots: "error", start: "/", err: "failed to read robots.txt: HTTP error: 503"},
+		{name: "Invalid start URL", start: "ftp://example.com/", err: "invalid start URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := newCrawlSite(tt.robots)
+			defer site.Close()
+
+			start := site.URL + tt.start
+			if strings.Contains(tt.start, "://") {
+				start = tt.start
+			}
+			err := (&Crawler{}).Crawl(context.Background(), start, func(*CrawlPage) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestNormalizeURL tests the URLs used to recognise pages already seen
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"HTTP://Example.COM", "http://example.com/"},
+		{"https://example.com:443/a?b=1#top", "https://example.com/a?b=1"},
+		{"http://example.com:8080/a/", "http://example.com:8080/a/"},
+		{"http://example.com/?", "http://example.com/"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result := normalizeURL(u); result != tt.expected {
+			t.Errorf("normalizeURL(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+// TestCrawlPageToJSON tests writing a crawled page
+func TestCrawlPageToJSON(t *testing.T) {
+	doc, err := ParseFragment(strings.NewReader("<p>Hi</p>"), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	page := &CrawlPage{URL: "https://example.com/", Status: 200, FetchedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Document: doc}
+
+	data, err := CrawlPageToJSON(page, Options{Compact: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"url":"https://example.com/","status":200,"fetchedAt":"2024-05-01T12:00:00Z","depth":0,"document":[{"p":{"child":"Hi"}}]}`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+}
@@ -0,0 +1,283 @@
+package hj
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// NodeType identifies the kind of a Node
+type NodeType int
+
+const (
+	// ElementNode is an HTML element such as <div>
+	ElementNode NodeType = iota
+	// TextNode is a run of character data
+	TextNode
+	// CommentNode is an HTML comment
+	CommentNode
+	// DoctypeNode is a <!DOCTYPE> declaration
+	DoctypeNode
+	// RawTextNode is the unescaped content of a raw text element such as <script> or <style>
+	RawTextNode
+	// ProcessingInstructionNode is a <?target data?> processing instruction
+	ProcessingInstructionNode
+)
+
+// rawTextElements lists the elements whose content is not parsed as HTML
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"xmp":       true,
+}
+
+// Node represents a node of a parsed HTML document.
+// For a DoctypeNode, Tag holds the doctype name and Attributes holds
+// the "public" and "system" identifiers when present.
+type Node struct {
+	Type       NodeType
+	Tag        string
+	ID         string
+	Attributes map[string]string
+	Children   []*Node
+	Text       string
+	Parent     *Node
+}
+
+// Document represents a parsed HTML document.
+// Fragment is set for documents read by ParseFragment, which are written
+// as an array of all their top-level nodes instead of the root element.
+type Document struct {
+	Children []*Node
+	Fragment bool
+	Metadata *Metadata
+}
+
+// Metadata describes where a document came from.
+// It is written with the document when Options.Metadata is enabled.
+type Metadata struct {
+	Source   string `json:"source,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// DefaultFragmentContext is the context element used when none is given to ParseFragment
+const DefaultFragmentContext = "body"
+
+// Parse reads HTML from r and returns it as a typed document tree
+func Parse(r io.Reader) (*Document, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	return newDocument(root), nil
+}
+
+// ParseFragment reads an HTML fragment from r as if it were the content of
+// a context element such as "ul", "tbody" or "template". Unlike Parse, no
+// html, head or body elements are added around the fragment.
+func ParseFragment(r io.Reader, context string) (*Document, error) {
+	if context == "" {
+		context = DefaultFragmentContext
+	}
+	contextNode := &html.Node{
+		Type:     html.ElementNode,
+		Data:     context,
+		DataAtom: atom.Lookup([]byte(context)),
+	}
+
+	nodes, err := html.ParseFragment(r, contextNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	// Attach the nodes to the context so that raw text is detected as in Parse
+	for _, n := range nodes {
+		contextNode.AppendChild(n)
+	}
+	doc := newDocument(contextNode)
+	doc.Fragment = true
+	return doc, nil
+}
+
+// ParseWithOptions reads HTML from r as a document, or as a fragment when opts.Fragment is set
+func ParseWithOptions(r io.Reader, opts Options) (*Document, error) {
+	if opts.Fragment {
+		return ParseFragment(r, opts.FragmentContext)
+	}
+	return Parse(r)
+}
+
+// newDocument builds a Document from the children of an html.Node
+func newDocument(root *html.Node) *Document {
+	doc := &Document{}
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if node := newNode(c, nil); node != nil {
+			doc.Children = append(doc.Children, node)
+		}
+	}
+	return doc
+}
+
+// newNode converts an html.Node and its descendants to a Node.
+// Node types hj does not represent are skipped and nil is returned.
+func newNode(n *html.Node, parent *Node) *Node {
+	node := &Node{Parent: parent}
+
+	switch n.Type {
+	case html.ElementNode:
+		node.Type = ElementNode
+		node.Tag = n.Data
+		for _, attr := range n.Attr {
+			if attr.Key == "id" {
+				node.ID = attr.Val
+				continue
+			}
+			if node.Attributes == nil {
+				node.Attributes = make(map[string]string)
+			}
+			node.Attributes[attr.Key] = attr.Val
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if child := newNode(c, node); child != nil {
+				node.Children = append(node.Children, child)
+			}
+		}
+
+	case html.TextNode:
+		node.Type = TextNode
+		if p := n.Parent; p != nil && p.Type == html.ElementNode && p.Namespace == "" && rawTextElements[p.Data] {
+			node.Type = RawTextNode
+		}
+		node.Text = n.Data
+
+	case html.CommentNode:
+		node.Type = CommentNode
+		node.Text = n.Data
+		// The HTML parser reads <?target data?> as a bogus comment
+		if strings.HasPrefix(n.Data, "?") {
+			node.Type = ProcessingInstructionNode
+			node.Text = strings.TrimSuffix(strings.TrimPrefix(n.Data, "?"), "?")
+		}
+
+	case html.DoctypeNode:
+		node.Type = DoctypeNode
+		node.Tag = n.Data
+		for _, attr := range n.Attr {
+			if node.Attributes == nil {
+				node.Attributes = make(map[string]string)
+			}
+			node.Attributes[attr.Key] = attr.Val
+		}
+
+	default:
+		return nil
+	}
+
+	return node
+}
+
+// Root returns the first top-level element of the document, usually <html>
+func (d *Document) Root() *Node {
+	for _, c := range d.Children {
+		if c.Type == ElementNode {
+			return c
+		}
+	}
+	return nil
+}
+
+// Key returns the key of the element as used in the JSON output
+func (n *Node) Key() string {
+	return generateElementKey(n.Tag, n.ID)
+}
+
+// Attr returns the value of the named attribute, including id
+func (n *Node) Attr(name string) (string, bool) {
+	if name == "id" {
+		return n.ID, n.ID != ""
+	}
+	val, ok := n.Attributes[name]
+	return val, ok
+}
+
+// SourceURL returns the source of the document as an absolute URL,
+// or nil when the document has no source or it is not a URL
+func (d *Document) SourceURL() *url.URL {
+	if d.Metadata == nil {
+		return nil
+	}
+	u, err := url.Parse(d.Metadata.Source)
+	if err != nil || !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// BaseURL returns the URL that relative URLs in the document are resolved
+// against: the href of the first <base> element resolved against the source,
+// or the source itself. It returns nil when neither gives an absolute URL.
+func (d *Document) BaseURL() *url.URL {
+	source := d.SourceURL()
+
+	var href string
+	found := false
+	walkElements(d.Children, func(n *Node) {
+		if !found && n.Tag == "base" {
+			href, found = n.Attributes["href"]
+		}
+	})
+	if !found {
+		return source
+	}
+
+	base, err := url.Parse(strings.Trim(href, whitespaceChars))
+	if err != nil {
+		return source
+	}
+	if source != nil {
+		base = source.ResolveReference(base)
+	}
+	if !base.IsAbs() {
+		return nil
+	}
+	return base
+}
+
+// ResolveURL resolves a URL found in the document against its base URL.
+// The URL is returned as written when there is no base URL or it is invalid.
+func (d *Document) ResolveURL(ref string) string {
+	return resolveURL(d.BaseURL(), ref)
+}
+
+// resolveURL resolves ref against base, which may be nil
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.Trim(ref, whitespaceChars)
+	if base == nil {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// MarshalJSON writes the document in the default hj JSON format
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.toJSON(Options{}))
+}
+
+// MarshalJSON writes the node in the default hj JSON format
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nodeToJSON(n, Options{}))
+}
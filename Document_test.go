@@ -0,0 +1,266 @@
+package hj
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestParse tests the typed document tree returned by Parse
+func TestParse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<div id="main" class="box">Hello <b>world</b><!-- c --></div>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	root := doc.Root()
+	if root == nil || root.Tag != "html" {
+		t.Fatalf("Expected html root, got %+v", root)
+	}
+
+	body := root.Children[1]
+	if body.Tag != "body" || body.Parent != root {
+		t.Fatalf("Expected body under html, got %+v", body)
+	}
+
+	div := body.Children[0]
+	if div.Type != ElementNode || div.Tag != "div" || div.ID != "main" {
+		t.Errorf("Unexpected div node: %+v", div)
+	}
+	if div.Key() != "div#main" {
+		t.Errorf("Expected key div#main, got %s", div.Key())
+	}
+	if len(div.Attributes) != 1 || div.Attributes["class"] != "box" {
+		t.Errorf("Expected only class attribute, got %v", div.Attributes)
+	}
+
+	if len(div.Children) != 3 {
+		t.Fatalf("Expected 3 children, got %d", len(div.Children))
+	}
+	if div.Children[0].Type != TextNode || div.Children[0].Text != "Hello " {
+		t.Errorf("Unexpected text node: %+v", div.Children[0])
+	}
+	if div.Children[1].Tag != "b" || div.Children[1].Parent != div {
+		t.Errorf("Unexpected element node: %+v", div.Children[1])
+	}
+	if div.Children[2].Type != CommentNode || div.Children[2].Text != " c " {
+		t.Errorf("Unexpected comment node: %+v", div.Children[2])
+	}
+}
+
+// TestParse_SpecialNodes tests parsing of doctype, processing instructions and raw text
+func TestParse_SpecialNodes(t *testing.T) {
+	input := `<?php echo 1; ?><!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN" "http://www.w3.org/TR/html4/strict.dtd"><html><head><style>p > a {}</style></head><body><svg><style>x</style></svg></body></html>`
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(doc.Children) != 3 {
+		t.Fatalf("Expected 3 top-level nodes, got %d", len(doc.Children))
+	}
+
+	pi := doc.Children[0]
+	if pi.Type != ProcessingInstructionNode || pi.Text != "php echo 1; " {
+		t.Errorf("Unexpected processing instruction: %+v", pi)
+	}
+
+	doctype := doc.Children[1]
+	if doctype.Type != DoctypeNode || doctype.Tag != "html" ||
+		doctype.Attributes["public"] != "-//W3C//DTD HTML 4.01//EN" ||
+		doctype.Attributes["system"] != "http://www.w3.org/TR/html4/strict.dtd" {
+		t.Errorf("Unexpected doctype: %+v", doctype)
+	}
+
+	style := doc.Root().Children[0].Children[0]
+	if style.Tag != "style" || style.Children[0].Type != RawTextNode || style.Children[0].Text != "p > a {}" {
+		t.Errorf("Unexpected style content: %+v", style.Children[0])
+	}
+
+	// style inside svg is foreign content and parsed as normal text
+	svgStyle := doc.Root().Children[1].Children[0].Children[0]
+	if svgStyle.Tag != "style" || svgStyle.Children[0].Type != TextNode {
+		t.Errorf("Unexpected svg style content: %+v", svgStyle.Children[0])
+	}
+}
+
+// TestParseFragment tests parsing fragments without html, head and body wrappers
+func TestParseFragment(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		context  string
+		expected string
+	}{
+		{
+			name:     "List items",
+			html:     "<li>a</li><li>b</li>",
+			context:  "ul",
+			expected: `[{"li":{"child":"a"}},{"li":{"child":"b"}}]`,
+		},
+		{
+			name:     "Table rows in tbody",
+			html:     "<tr><td>1</td></tr>",
+			context:  "tbody",
+			expected: `[{"tr":{"child":[{"td":{"child":"1"}}]}}]`,
+		},
+		{
+			name:     "Template content",
+			html:     "<tr><td>1</td></tr>",
+			context:  "template",
+			expected: `[{"tr":{"child":[{"td":{"child":"1"}}]}}]`,
+		},
+		{
+			name:     "Default context",
+			html:     `text <p id="a">x</p><p>y</p>`,
+			context:  "",
+			expected: `["text",{"p#a":{"child":"x"}},{"p":{"child":"y"}}]`,
+		},
+		{
+			name:     "Empty",
+			html:     "",
+			context:  "div",
+			expected: `[]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseFragment(strings.NewReader(tt.html), tt.context)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !doc.Fragment {
+				t.Errorf("Expected fragment document")
+			}
+			for _, c := range doc.Children {
+				if c.Parent != nil {
+					t.Errorf("Expected top-level node without parent, got %+v", c.Parent)
+				}
+			}
+
+			data, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatalf("Failed to marshal document: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, data)
+			}
+		})
+	}
+}
+
+// TestDocument_MarshalJSON tests that the typed tree serialises to the HTMLtoJSON output
+func TestDocument_MarshalJSON(t *testing.T) {
+	inputs := []string{
+		"",
+		"<div>Hello World</div>",
+		`<div id="main" class="box">Hello <b>world</b>!</div>`,
+		`<ul><li><a href="#home">Home</a></li><li>About</li></ul>`,
+	}
+
+	for _, input := range inputs {
+		expected, err := HTMLtoJSON(input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		doc, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("Failed to marshal document: %v", err)
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", DefaultIndent); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		if indented.String() != expected {
+			t.Errorf("Input %q\nExpected:\n%s\nGot:\n%s", input, expected, indented.String())
+		}
+	}
+}
+
+// TestDocument_ToJSONMetadata tests the optional metadata section
+func TestDocument_ToJSONMetadata(t *testing.T) {
+	doc, err := ParseWithOptions(strings.NewReader("<p>a</p>"), Options{Fragment: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc.Metadata = &Metadata{Source: "test.html", Encoding: "shift_jis"}
+
+	data, err := doc.ToJSON(Options{Compact: true, Metadata: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"metadata":{"source":"test.html","encoding":"shift_jis"},"document":[{"p":{"child":"a"}}]}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	// Metadata is only written when requested
+	data, err = doc.ToJSON(Options{Compact: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != `[{"p":{"child":"a"}}]` {
+		t.Errorf("Unexpected JSON without metadata: %s", data)
+	}
+}
+
+// TestNode_MarshalJSON tests serialising a single node
+func TestNode_MarshalJSON(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<p id="x">text</p>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p := doc.Root().Children[1].Children[0]
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Failed to marshal node: %v", err)
+	}
+	if string(data) != `{"p#x":{"child":"text"}}` {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+
+	data, err = json.Marshal(p.Children[0])
+	if err != nil {
+		t.Fatalf("Failed to marshal node: %v", err)
+	}
+	if string(data) != `"text"` {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+}
+
+// TestDocument_BaseURL tests resolving URLs against the source and <base href>
+func TestDocument_BaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		source   string
+		expected string
+	}{
+		{name: "Source", html: `<a href="x">`, source: "https://example.com/a/b.html", expected: "https://example.com/a/x"},
+		{name: "Base", html: `<base href="https://cdn.example.com/s/"><base href="/ignored/">`, source: "", expected: "https://cdn.example.com/s/x"},
+		{name: "Relative base", html: `<base target="_top"><base href=" /root/ ">`, source: "https://example.com/a/b.html", expected: "https://example.com/root/x"},
+		{name: "No URL", html: `<base href="/root/">`, source: "index.html", expected: "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc.Metadata = &Metadata{Source: tt.source}
+			if result := doc.ResolveURL(" x "); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
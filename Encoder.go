@@ -0,0 +1,871 @@
+package hj
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Encoder writes hj output in an output format such as YAML or XML.
+//
+// The value passed to Encode is the JSON structure of the output decoded
+// with objects kept in order: it holds nil, bool, json.Number, string,
+// []interface{} and Object values. Encoders of text formats end their output
+// with a newline.
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+// DocumentEncoder is implemented by encoders that write the document tree
+// itself rather than its JSON structure, such as TextEncoder and
+// MarkdownEncoder. Document.Encode uses EncodeDocument when it is available.
+type DocumentEncoder interface {
+	EncodeDocument(w io.Writer, doc *Document) error
+}
+
+// Field is a member of an Object
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Object is a JSON object with its members in document order
+type Object []Field
+
+// Get returns the value of the member named key
+func (o Object) Get(key string) (interface{}, bool) {
+	for _, f := range o {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON writes the object with its members in order
+func (o Object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// encoders holds the registered encoders by format name
+var encoders = map[string]Encoder{
+	"json":         JSONEncoder{},
+	"json-compact": JSONEncoder{Compact: true},
+	"yaml":         YAMLEncoder{},
+	"toml":         TOMLEncoder{},
+	"xml":          XMLEncoder{},
+	"cbor":         CBOREncoder{},
+	"msgpack":      MessagePackEncoder{},
+	"text":         TextEncoder{},
+	"markdown":     MarkdownEncoder{},
+}
+
+// RegisterEncoder makes an encoder available under a format name,
+// replacing any encoder registered with the same name
+func RegisterEncoder(format string, enc Encoder) {
+	encoders[format] = enc
+}
+
+// LookupEncoder returns the encoder registered for a format name
+func LookupEncoder(format string) (Encoder, error) {
+	enc, ok := encoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	return enc, nil
+}
+
+// Formats returns the names of the registered formats in alphabetical order
+func Formats() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decoder reads a value written by an Encoder back, holding the same types
+// as the values passed to Encode
+type Decoder interface {
+	Decode(r io.Reader) (interface{}, error)
+}
+
+// decoders holds the registered decoders by format name
+var decoders = map[string]Decoder{
+	"json":         JSONDecoder{},
+	"json-compact": JSONDecoder{},
+	"cbor":         CBORDecoder{},
+	"msgpack":      MessagePackDecoder{},
+}
+
+// RegisterDecoder makes a decoder available under a format name,
+// replacing any decoder registered with the same name
+func RegisterDecoder(format string, dec Decoder) {
+	decoders[format] = dec
+}
+
+// LookupDecoder returns the decoder registered for a format name
+func LookupDecoder(format string) (Decoder, error) {
+	dec, ok := decoders[format]
+	if !ok {
+		return nil, fmt.Errorf("format cannot be read: %s", format)
+	}
+	return dec, nil
+}
+
+// DecodeDocument reads a document written by Document.Encode in the format of dec
+func DecodeDocument(r io.Reader, dec Decoder) (*Document, error) {
+	v, err := dec.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return documentFromValue(plainValue(v))
+}
+
+// plainValue converts the objects in v to maps as read by documentFromValue
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Object:
+		m := make(map[string]interface{}, len(v))
+		for _, f := range v {
+			m[f.Key] = plainValue(f.Value)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = plainValue(item)
+		}
+		return list
+	}
+	return v
+}
+
+// maxDecodeDepth is the deepest nesting of arrays and objects read by the binary decoders
+const maxDecodeDepth = 10000
+
+// parseNumber returns n as an int64 or uint64 when it is an integer, or as a float64
+func parseNumber(n json.Number) (interface{}, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u, nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number: %s", n)
+	}
+	return f, nil
+}
+
+// readBytes reads exactly n bytes from r
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("length %d is too large", n)
+	}
+	// The length is not trusted for allocation until the data has been read
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), nil
+}
+
+// numberValue returns a decoded floating-point number as a json.Number.
+// NaN and infinity have no JSON representation and are returned as strings.
+func numberValue(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return xpathNumberToString(f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// Encode writes the document in the format of enc
+func (d *Document) Encode(w io.Writer, enc Encoder, opts Options) error {
+	if de, ok := enc.(DocumentEncoder); ok {
+		return de.EncodeDocument(w, d)
+	}
+	opts.Compact = true
+	data, err := d.ToJSON(opts)
+	if err != nil {
+		return err
+	}
+	return Transcode(w, data, enc)
+}
+
+// Transcode writes JSON text, such as the output of ToJSON, in the format of enc
+func Transcode(w io.Writer, data []byte, enc Encoder) error {
+	v, err := decodeOrderedJSON(data)
+	if err != nil {
+		return err
+	}
+	return enc.Encode(w, v)
+}
+
+// decodeOrderedJSON decodes JSON text keeping the order of object members
+func decodeOrderedJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeOrderedValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("failed to parse JSON: unexpected data after the value")
+	}
+	return v, nil
+}
+
+// decodeOrderedValue reads the next value from dec
+func decodeOrderedValue(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		obj := Object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, Field{Key: key.(string), Value: value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return t, nil
+}
+
+// JSONDecoder reads JSON text
+type JSONDecoder struct{}
+
+// Decode reads a JSON value from r
+func (d JSONDecoder) Decode(r io.Reader) (interface{}, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %v", err)
+	}
+	return decodeOrderedJSON(data)
+}
+
+// JSONEncoder writes JSON indented like HTMLtoJSON, or compact JSON
+type JSONEncoder struct {
+	// Indent is the indentation string for each nesting level (DefaultIndent if empty)
+	Indent string
+	// Compact writes JSON without any indentation or newlines
+	Compact bool
+}
+
+// Encode writes v as JSON
+func (e JSONEncoder) Encode(w io.Writer, v interface{}) error {
+	opts := Options{Indent: e.Indent, Compact: e.Compact}
+
+	var data []byte
+	var err error
+	if opts.Compact {
+		data, err = json.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", opts.indent())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert to JSON: %v", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// YAMLEncoder writes YAML in block style. Strings are quoted unless they
+// cannot be read as anything else.
+type YAMLEncoder struct{}
+
+// Encode writes v as YAML
+func (e YAMLEncoder) Encode(w io.Writer, v interface{}) error {
+	var b strings.Builder
+	for _, line := range yamlLines(v) {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// yamlLines returns the lines of v without indentation of the first level
+func yamlLines(v interface{}) []string {
+	switch v := v.(type) {
+	case Object:
+		if len(v) == 0 {
+			return []string{"{}"}
+		}
+		var lines []string
+		for _, f := range v {
+			value := yamlLines(f.Value)
+			key := yamlString(f.Key)
+			if !yamlCollection(f.Value) {
+				lines = append(lines, key+": "+value[0])
+				continue
+			}
+			lines = append(lines, key+":")
+			for _, line := range value {
+				lines = append(lines, "  "+line)
+			}
+		}
+		return lines
+	case []interface{}:
+		if len(v) == 0 {
+			return []string{"[]"}
+		}
+		var lines []string
+		for _, item := range v {
+			value := yamlLines(item)
+			lines = append(lines, "- "+value[0])
+			for _, line := range value[1:] {
+				lines = append(lines, "  "+line)
+			}
+		}
+		return lines
+	case string:
+		return []string{yamlString(v)}
+	case nil:
+		return []string{"null"}
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// yamlCollection reports whether v is written as a block on the following lines
+func yamlCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case Object:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// yamlString returns s as a plain scalar when that reads back as the same
+// string, and as a double-quoted scalar otherwise
+func yamlString(s string) string {
+	plain := s != "" && strings.TrimSpace(s) == s
+	for i, r := range s {
+		isWord := r == '_' || r == '-' || r == '.' || r == '/' || r == ' ' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') || (r > 0x7f && unicode.IsPrint(r))
+		if !isWord || (i == 0 && (r == '-' || r == '.' || ('0' <= r && r <= '9'))) {
+			plain = false
+			break
+		}
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "nan", "inf":
+		plain = false
+	}
+	if plain {
+		return s
+	}
+
+	// JSON escapes are valid in YAML double-quoted scalars
+	return jsonString(s)
+}
+
+// jsonString returns s as a JSON string without escaping HTML characters
+func jsonString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// TOMLEncoder writes TOML. Objects become tables and arrays of objects
+// become arrays of tables. A value that is not an object is written as the
+// "document" key. TOML has no null, so null values are left out.
+type TOMLEncoder struct{}
+
+// Encode writes v as TOML
+func (e TOMLEncoder) Encode(w io.Writer, v interface{}) error {
+	root, ok := v.(Object)
+	if !ok {
+		root = Object{{Key: "document", Value: v}}
+	}
+
+	var b strings.Builder
+	writeTOMLTable(&b, nil, root)
+	_, err := io.WriteString(w, strings.TrimPrefix(b.String(), "\n"))
+	return err
+}
+
+// writeTOMLTable writes the members of a table whose header has been written
+func writeTOMLTable(b *strings.Builder, path []string, obj Object) {
+	var tables, arrays []Field
+	for _, f := range obj {
+		switch value := f.Value.(type) {
+		case nil:
+			continue
+		case Object:
+			if len(value) > 0 {
+				tables = append(tables, f)
+				continue
+			}
+		case []interface{}:
+			if tomlTableArray(value) {
+				arrays = append(arrays, f)
+				continue
+			}
+		}
+		b.WriteString(tomlKey(f.Key) + " = " + tomlInline(f.Value) + "\n")
+	}
+
+	for _, f := range tables {
+		sub := append(append([]string{}, path...), f.Key)
+		value := f.Value.(Object)
+		if tomlHasValues(value) {
+			b.WriteString("\n[" + tomlPath(sub) + "]\n")
+		}
+		writeTOMLTable(b, sub, value)
+	}
+	for _, f := range arrays {
+		sub := append(append([]string{}, path...), f.Key)
+		for _, item := range f.Value.([]interface{}) {
+			b.WriteString("\n[[" + tomlPath(sub) + "]]\n")
+			writeTOMLTable(b, sub, item.(Object))
+		}
+	}
+}
+
+// tomlTableArray reports whether a is written as an array of tables
+func tomlTableArray(a []interface{}) bool {
+	if len(a) == 0 {
+		return false
+	}
+	for _, item := range a {
+		if _, ok := item.(Object); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlHasValues reports whether a table has members written as key/value
+// pairs, which need a table header
+func tomlHasValues(obj Object) bool {
+	for _, f := range obj {
+		switch value := f.Value.(type) {
+		case nil:
+		case Object:
+			if len(value) == 0 {
+				return true
+			}
+		case []interface{}:
+			if !tomlTableArray(value) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// tomlInline returns v as an inline TOML value
+func tomlInline(v interface{}) string {
+	switch v := v.(type) {
+	case Object:
+		var parts []string
+		for _, f := range v {
+			if f.Value != nil {
+				parts = append(parts, tomlKey(f.Key)+" = "+tomlInline(f.Value))
+			}
+		}
+		if len(parts) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			if item != nil {
+				parts = append(parts, tomlInline(item))
+			}
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case string:
+		return tomlString(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// tomlKey returns key as a bare key when possible and quoted otherwise
+func tomlKey(key string) string {
+	if key == "" || strings.Trim(key, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") != "" {
+		return tomlString(key)
+	}
+	return key
+}
+
+// tomlPath returns the dotted key of a table header
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+// tomlString returns s as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// XMLEncoder writes XML inside a root <hj> element. hj elements become XML
+// elements with their attributes and children, so a document reads like
+// XHTML, and comments and processing instructions are kept. Attributes whose
+// name is not an XML name, such as @click or xml:lang, are written as
+// <attr name="name"> elements before the children. Other objects become one
+// element per member, named after the key or written as <field name="key">
+// when the key is not an XML name. Array items that are not elements are
+// wrapped in <item>. Names with a colon are not used as XML names, since
+// their prefix is not declared.
+type XMLEncoder struct{}
+
+// Encode writes v as XML
+func (e XMLEncoder) Encode(w io.Writer, v interface{}) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	writeXMLElement(&b, "hj", nil, xmlItems(v), 0, true)
+	b.WriteByte('\n')
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeXMLElement writes an element with the given attributes and content.
+// The content is indented when indent is set and it contains no text.
+func writeXMLElement(b *strings.Builder, name string, attrs []Field, items []interface{}, depth int, indent bool) {
+	b.WriteString("<" + name)
+	for _, attr := range attrs {
+		b.WriteString(" " + attr.Key + `="` + xmlEscape(attr.Value.(string), true) + `"`)
+	}
+	if len(items) == 0 {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteString(">")
+
+	indent = indent && !xmlHasText(items)
+	for _, item := range items {
+		if indent {
+			b.WriteString("\n" + strings.Repeat("  ", depth+1))
+		}
+		writeXMLItem(b, item, depth+1, indent)
+	}
+	if indent {
+		b.WriteString("\n" + strings.Repeat("  ", depth))
+	}
+	b.WriteString("</" + name + ">")
+}
+
+// xmlItems returns the content of an element holding a generic value as a
+// list of text, nodes and fields
+func xmlItems(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if key, isNode := xmlNode(item); isNode {
+				if key != "#doctype" {
+					items = append(items, item)
+				}
+			} else if item != nil {
+				items = append(items, xmlField{name: "item", value: item})
+			}
+		}
+		return items
+	case Object:
+		if _, isNode := xmlNode(v); isNode {
+			return []interface{}{v}
+		}
+		items := make([]interface{}, 0, len(v))
+		for _, f := range v {
+			items = append(items, xmlField{name: f.Key, value: f.Value})
+		}
+		return items
+	}
+	return []interface{}{v}
+}
+
+// xmlChildItems returns the "child" value of an hj element as a list of text
+// and nodes. The XML declaration replaces doctypes, so they are left out.
+func xmlChildItems(child interface{}) []interface{} {
+	list, ok := child.([]interface{})
+	if !ok {
+		return xmlItems(child)
+	}
+	items := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		key, isNode := xmlNode(item)
+		if item == nil || key == "#doctype" {
+			continue
+		}
+		if _, isObject := item.(Object); isObject && !isNode {
+			item = xmlField{name: "item", value: item}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// xmlField is a member of a generic object or a wrapped array item
+type xmlField struct {
+	name  string
+	value interface{}
+}
+
+// xmlAttribute is an attribute of an hj element whose name is not an XML name
+type xmlAttribute struct {
+	name  string
+	value string
+}
+
+// xmlHasText reports whether items contain text, which must not be indented
+func xmlHasText(items []interface{}) bool {
+	for _, item := range items {
+		switch item := item.(type) {
+		case xmlField, xmlAttribute:
+		case Object:
+			if key, _ := xmlNode(item); key == "#raw" {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// writeXMLItem writes text, an hj node or a generic field
+func writeXMLItem(b *strings.Builder, item interface{}, depth int, indent bool) {
+	switch item := item.(type) {
+	case nil:
+	case xmlField:
+		if isXMLName(item.name) {
+			writeXMLElement(b, item.name, nil, xmlItems(item.value), depth, indent)
+		} else {
+			writeXMLElement(b, "field", []Field{{Key: "name", Value: item.name}}, xmlItems(item.value), depth, indent)
+		}
+	case xmlAttribute:
+		var value []interface{}
+		if item.value != "" {
+			value = []interface{}{item.value}
+		}
+		writeXMLElement(b, "attr", []Field{{Key: "name", Value: item.name}}, value, depth, indent)
+	case Object:
+		key, _ := xmlNode(item)
+		value := item[0].Value
+		switch key {
+		case "#comment":
+			b.WriteString("<!--" + xmlComment(value.(string)) + "-->")
+		case "#pi":
+			b.WriteString("<?" + strings.ReplaceAll(value.(string), "?>", "? >") + "?>")
+		case "#raw":
+			b.WriteString(xmlEscape(value.(string), false))
+		default:
+			tag, id := splitElementKey(key)
+			var attrs []Field
+			if id != "" {
+				attrs = append(attrs, Field{Key: "id", Value: id})
+			}
+			var items []interface{}
+			element := value.(Object)
+			if attributes, ok := element.Get("attributes"); ok {
+				for _, attr := range attributes.(Object) {
+					switch {
+					case id != "" && attr.Key == "id":
+					case isXMLName(attr.Key):
+						attrs = append(attrs, attr)
+					default:
+						items = append(items, xmlAttribute{name: attr.Key, value: attr.Value.(string)})
+					}
+				}
+			}
+			child, _ := element.Get("child")
+			writeXMLElement(b, tag, attrs, append(items, xmlChildItems(child)...), depth, indent)
+		}
+	default:
+		b.WriteString(xmlEscape(fmt.Sprint(item), false))
+	}
+}
+
+// xmlComment returns the text of a comment with a space after each "-"
+// followed by another and after a final "-", which XML does not allow
+func xmlComment(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteByte(s[i])
+		if s[i] == '-' && (i+1 == len(s) || s[i+1] == '-') {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// xmlEscape escapes text for element content or attribute values,
+// replacing characters that are not allowed in XML
+func xmlEscape(s string, attribute bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case attribute && r == '"':
+			b.WriteString("&quot;")
+		case attribute && (r == '\t' || r == '\n' || r == '\r'):
+			fmt.Fprintf(&b, "&#x%X;", r)
+		case r == '\t' || r == '\n' || r == '\r' ||
+			(r >= 0x20 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0xFFFD) || (r >= 0x10000 && r <= 0x10FFFF):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(utf8.RuneError)
+		}
+	}
+	return b.String()
+}
+
+// xmlNode returns the key of v when it is an hj element, comment,
+// processing instruction, raw text or doctype
+func xmlNode(v interface{}) (string, bool) {
+	obj, ok := v.(Object)
+	if !ok || len(obj) != 1 {
+		return "", false
+	}
+	key, value := obj[0].Key, obj[0].Value
+
+	switch key {
+	case "#comment", "#pi", "#raw":
+		_, ok := value.(string)
+		return key, ok
+	case "#doctype":
+		_, ok := value.(Object)
+		return key, ok
+	}
+
+	tag, _ := splitElementKey(key)
+	element, ok := value.(Object)
+	if !ok || !isXMLName(tag) {
+		return "", false
+	}
+	for _, f := range element {
+		switch f.Key {
+		case "attributes":
+			attributes, ok := f.Value.(Object)
+			if !ok {
+				return "", false
+			}
+			for _, attr := range attributes {
+				if _, ok := attr.Value.(string); !ok {
+					return "", false
+				}
+			}
+		case "child":
+		default:
+			return "", false
+		}
+	}
+	return key, true
+}
+
+// isXMLName reports whether s can be used as an XML element or attribute
+// name. Names with a colon are left out, since a namespace-aware parser
+// rejects a prefix that is not declared.
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, r := range s {
+		if r == '_' || unicode.IsLetter(r) {
+			continue
+		}
+		if i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)) {
+			continue
+		}
+		return false
+	}
+	return true
+}
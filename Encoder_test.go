@@ -0,0 +1,246 @@
+package hj
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDocument_Encode tests writing a document in each built-in format
+func TestDocument_Encode(t *testing.T) {
+	input := `<div id="main" class="box">Hello <b>world</b>!</div><p>123</p>`
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   "json-compact",
+			expected: `[{"div#main":{"attributes":{"class":"box"},"child":[{"b":{"child":"world"}}]}},{"p":{"child":"123"}}]` + "\n",
+		},
+		{
+			format: "yaml",
+			expected: `- "div#main":
+    attributes:
+      class: box
+    child:
+      - b:
+          child: world
+- p:
+    child: "123"
+`,
+		},
+		{
+			format: "toml",
+			expected: `[[document]]
+
+[document."div#main".attributes]
+class = "box"
+
+[[document."div#main".child]]
+
+[document."div#main".child.b]
+child = "world"
+
+[[document]]
+
+[document.p]
+child = "123"
+`,
+		},
+		{
+			format: "xml",
+			expected: `<?xml version="1.0" encoding="UTF-8"?>
+<hj>
+  <div id="main" class="box">
+    <b>world</b>
+  </div>
+  <p>123</p>
+</hj>
+`,
+		},
+	}
+
+	doc, err := ParseFragment(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			enc, err := LookupEncoder(tt.format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := doc.Encode(&buf, enc, Options{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+// TestJSONEncoder tests that the json format matches ToJSON
+func TestJSONEncoder(t *testing.T) {
+	data, err := os.ReadFile("sample.html")
+	if err != nil {
+		t.Fatalf("Failed to read sample.html: %v", err)
+	}
+	doc, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected, err := doc.ToJSON(Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := doc.Encode(&buf, JSONEncoder{}, Options{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != string(expected)+"\n" {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+// TestYAMLEncoder_Scalars tests quoting of YAML scalars
+func TestYAMLEncoder_Scalars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: `"text"`, expected: "text\n"},
+		{input: `"two words"`, expected: "two words\n"},
+		{input: `"true"`, expected: "\"true\"\n"},
+		{input: `"null"`, expected: "\"null\"\n"},
+		{input: `"- item"`, expected: "\"- item\"\n"},
+		{input: `"a: b"`, expected: "\"a: b\"\n"},
+		{input: `"#hash"`, expected: "\"#hash\"\n"},
+		{input: `"line\nbreak"`, expected: "\"line\\nbreak\"\n"},
+		{input: `"a & b"`, expected: "\"a & b\"\n"},
+		{input: `"日本語"`, expected: "日本語\n"},
+		{input: `""`, expected: "\"\"\n"},
+		{input: `12.5`, expected: "12.5\n"},
+		{input: `null`, expected: "null\n"},
+		{input: `[]`, expected: "[]\n"},
+		{input: `{}`, expected: "{}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Transcode(&buf, []byte(tt.input), YAMLEncoder{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+// TestXMLEncoder_SpecialNodes tests comments, processing instructions and names that are not valid in XML
+func TestXMLEncoder_SpecialNodes(t *testing.T) {
+	input := `[{"#comment":" a -- b "},{"#pi":"php echo 1; "},{"div":{"attributes":{"@click":"go()","title":"<\"x\">","xml:lang":"en",":class":""},"child":["a & b",{"br":{}}]}},` +
+		`{"p":{"attributes":{"foo:bar":"1"},"child":[{"span":{}}]}},{"odd key":1,"og:title":"T"}]`
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<hj>
+  <!-- a - - b -->
+  <?php echo 1; ?>
+  <div title="&lt;&quot;x&quot;&gt;"><attr name="@click">go()</attr><attr name="xml:lang">en</attr><attr name=":class"/>a &amp; b<br/></div>
+  <p>
+    <attr name="foo:bar">1</attr>
+    <span/>
+  </p>
+  <item>
+    <field name="odd key">1</field>
+    <field name="og:title">T</field>
+  </item>
+</hj>
+`
+
+	var buf bytes.Buffer
+	if err := Transcode(&buf, []byte(input), XMLEncoder{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+// TestXMLComment tests the hyphens that XML does not allow in comments
+func TestXMLComment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{" a -- b ", " a - - b "},
+		{"a---b", "a- - -b"},
+		{"tail-", "tail- "},
+		{"tail---", "tail- - - "},
+		{"-a-b-", "-a-b- "},
+	}
+
+	for _, tt := range tests {
+		if result := xmlComment(tt.input); result != tt.expected {
+			t.Errorf("xmlComment(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+// TestTranscode_Errors tests transcoding invalid JSON
+func TestTranscode_Errors(t *testing.T) {
+	inputs := []string{"", "{", `{"a":1} x`, "[1,]"}
+
+	for _, input := range inputs {
+		if err := Transcode(io.Discard, []byte(input), YAMLEncoder{}); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+// upperEncoder is a custom encoder used to test RegisterEncoder
+type upperEncoder struct{}
+
+func (upperEncoder) Encode(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	if err := (JSONEncoder{Compact: true}).Encode(&buf, v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, strings.ToUpper(buf.String()))
+	return err
+}
+
+// TestRegisterEncoder tests registering and looking up encoders
+func TestRegisterEncoder(t *testing.T) {
+	expected := []string{"cbor", "json", "json-compact", "markdown", "msgpack", "text", "toml", "xml", "yaml"}
+	if formats := Formats(); !reflect.DeepEqual(formats, expected) {
+		t.Errorf("Expected formats %v, got %v", expected, formats)
+	}
+
+	if _, err := LookupEncoder("upper"); err == nil || err.Error() != "unknown format: upper" {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+
+	RegisterEncoder("upper", upperEncoder{})
+	defer delete(encoders, "upper")
+
+	enc, err := LookupEncoder("upper")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Transcode(&buf, []byte(`{"p":{"child":"text"}}`), enc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != `{"P":{"CHILD":"TEXT"}}`+"\n" {
+		t.Errorf("Unexpected output: %s", buf.String())
+	}
+}
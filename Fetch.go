@@ -0,0 +1,438 @@
+package hj
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Defaults used by a Fetcher for the fields left empty
+const (
+	DefaultConnectTimeout = 30 * time.Second
+	DefaultReadTimeout    = 60 * time.Second
+	DefaultUserAgent      = "hj (+https://github.com/HARMONICOM/hj)"
+	DefaultRetryWait      = time.Second
+	DefaultMaxRetryWait   = 30 * time.Second
+)
+
+// HTTPStatusError is returned by a Fetcher for a response with a status other than 200 OK
+type HTTPStatusError struct {
+	// URL is the final URL of the response after redirects
+	URL        string
+	StatusCode int
+	Header     http.Header
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP error: %d", e.StatusCode)
+}
+
+// Temporary reports whether the status may change when the request is
+// retried later, as for 429 Too Many Requests and most 5xx statuses
+func (e *HTTPStatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Fetcher retrieves documents over HTTP and HTTPS.
+// The zero value is ready to use with the default timeouts and user agent.
+// A Fetcher reuses its connections and must not be copied after first use.
+type Fetcher struct {
+	// ConnectTimeout limits establishing a connection, including the TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout limits waiting for the response headers and for each read
+	// of the body, so that a server that stops sending data is given up on
+	ReadTimeout time.Duration
+
+	// UserAgent is sent unless Header has a User-Agent
+	UserAgent string
+	// Header holds extra request headers. A Host header sets the host of the request.
+	Header http.Header
+
+	// Jar holds the cookies sent with requests and receives the cookies set by
+	// responses, such as a jar read by LoadCookieFile
+	Jar http.CookieJar
+
+	// Username and Password are sent with basic authentication when Username is set
+	Username string
+	Password string
+	// BearerToken is sent in an "Authorization: Bearer" header when set
+	BearerToken string
+
+	// Proxy is the HTTP or HTTPS proxy to use. When nil, the proxy is taken
+	// from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy *url.URL
+	// TLSConfig configures TLS connections, such as the certificate
+	// authorities from LoadCertPool in RootCAs
+	TLSConfig *tls.Config
+
+	// Retries is how many times a request is retried after a network error
+	// or a temporary status such as 429 or 503
+	Retries int
+	// RetryWait is the wait before the first retry, doubled for each retry
+	// after it and varied randomly so that clients do not retry together
+	RetryWait time.Duration
+	// MaxRetryWait limits the wait between retries. A Retry-After header
+	// sent by the server is followed when it is not longer than this.
+	MaxRetryWait time.Duration
+
+	// AllowErrorStatus returns responses with a status other than 200 OK
+	// instead of an HTTPStatusError, so that error pages can be read
+	AllowErrorStatus bool
+
+	once   sync.Once
+	client *http.Client
+}
+
+// FetchResult is a response read by a Fetcher
+type FetchResult struct {
+	// URL is the final URL of the response after redirects
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ContentType returns the Content-Type header of the response
+func (r *FetchResult) ContentType() string {
+	return r.Header.Get("Content-Type")
+}
+
+// Fetch retrieves a URL with a GET request, following redirects and
+// retrying as configured. Responses with a status other than 200 OK are
+// returned as an HTTPStatusError unless AllowErrorStatus is set.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*FetchResult, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, err := f.fetch(ctx, rawURL)
+		if err == nil && result.StatusCode == http.StatusOK {
+			return result, nil
+		}
+
+		var statusErr *HTTPStatusError
+		if err == nil {
+			statusErr = &HTTPStatusError{URL: result.URL, StatusCode: result.StatusCode, Header: result.Header}
+		}
+		wait, retry := f.retryWait(ctx, attempt, statusErr, err)
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			if f.AllowErrorStatus {
+				return result, nil
+			}
+			return nil, statusErr
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err == nil {
+				err = statusErr
+			}
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// fetch sends a single request and reads its response
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (*FetchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %v", err)
+	}
+	for name, values := range f.Header {
+		for _, value := range values {
+			if http.CanonicalHeaderKey(name) == "Host" {
+				req.Host = value
+				continue
+			}
+			req.Header.Add(name, value)
+		}
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", cmp.Or(f.UserAgent, DefaultUserAgent))
+	}
+	if f.Username != "" {
+		req.SetBasicAuth(f.Username, f.Password)
+	}
+	if f.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+f.BearerToken)
+	}
+
+	resp, err := f.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result := &FetchResult{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+	if resp.StatusCode != http.StatusOK && !f.AllowErrorStatus {
+		// The body of an error is not needed, but reading a little of it
+		// lets the connection be reused for a retry
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return result, nil
+	}
+
+	result.Body, err = readWithIdleTimeout(resp.Body, cmp.Or(f.ReadTimeout, DefaultReadTimeout), cancel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return result, nil
+}
+
+// retryWait returns how long to wait before retrying a request that failed
+// with statusErr or err, and false when it is not retried
+func (f *Fetcher) retryWait(ctx context.Context, attempt int, statusErr *HTTPStatusError, err error) (time.Duration, bool) {
+	if attempt >= f.Retries || ctx.Err() != nil {
+		return 0, false
+	}
+	maxWait := cmp.Or(f.MaxRetryWait, DefaultMaxRetryWait)
+	if statusErr != nil {
+		if !statusErr.Temporary() {
+			return 0, false
+		}
+		if wait, ok := retryAfter(statusErr.Header.Get("Retry-After"), time.Now()); ok {
+			// Retrying sooner than the server asks is likely to fail again
+			return wait, wait <= maxWait
+		}
+	} else {
+		// Certificate errors and the like do not go away on their own
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			return 0, false
+		}
+	}
+
+	// Exponential backoff with half of the wait chosen at random
+	wait := cmp.Or(f.RetryWait, DefaultRetryWait)
+	for i := 0; i < attempt && wait < maxWait; i++ {
+		wait *= 2
+	}
+	wait = min(wait, maxWait)
+	return wait/2 + rand.N(wait/2+1), true
+}
+
+// retryAfter parses the value of a Retry-After header, given in seconds
+// or as an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(min(seconds, math.MaxInt32)) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
+
+// FetchDocument retrieves a URL and parses it as HTML using opts, detecting
+// its character encoding. The metadata of the document holds the final URL
+// and the encoding.
+func (f *Fetcher) FetchDocument(ctx context.Context, rawURL string, opts Options) (*Document, error) {
+	result, err := f.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return result.Document(opts)
+}
+
+// Document parses the body of the response as HTML using opts, detecting its
+// character encoding. The metadata of the document holds the final URL and
+// the encoding.
+func (r *FetchResult) Document(opts Options) (*Document, error) {
+	content, encoding, err := DecodeHTML(r.Body, r.ContentType(), "")
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ParseWithOptions(strings.NewReader(content), opts)
+	if err != nil {
+		return nil, err
+	}
+	doc.Metadata = &Metadata{Source: r.URL, Encoding: encoding}
+	return doc, nil
+}
+
+// httpClient returns the client of the fetcher, creating it on first use
+func (f *Fetcher) httpClient() *http.Client {
+	f.once.Do(func() {
+		connectTimeout := cmp.Or(f.ConnectTimeout, DefaultConnectTimeout)
+		proxy := http.ProxyFromEnvironment
+		if f.Proxy != nil {
+			proxy = http.ProxyURL(f.Proxy)
+		}
+		var tlsConfig *tls.Config
+		if f.TLSConfig != nil {
+			tlsConfig = f.TLSConfig.Clone()
+		}
+		f.client = &http.Client{
+			Jar: f.Jar,
+			Transport: &http.Transport{
+				Proxy:                 proxy,
+				DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+				TLSClientConfig:       tlsConfig,
+				TLSHandshakeTimeout:   connectTimeout,
+				ResponseHeaderTimeout: cmp.Or(f.ReadTimeout, DefaultReadTimeout),
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		}
+	})
+	return f.client
+}
+
+// readWithIdleTimeout reads r to the end, calling cancel to abort the
+// request when no data arrives for timeout
+func readWithIdleTimeout(r io.Reader, timeout time.Duration, cancel context.CancelFunc) ([]byte, error) {
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		if n > 0 {
+			timer.Reset(timeout)
+		}
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			if timedOut.Load() {
+				return nil, fmt.Errorf("no data received for %v", timeout)
+			}
+			return nil, err
+		}
+	}
+}
+
+// LoadCookieFile reads cookies from a file in the Netscape format written by
+// curl, wget and browser extensions into a new cookie jar. Expired cookies
+// are left out, and cookies marked with a "#HttpOnly_" prefix are included.
+func LoadCookieFile(path string) (http.CookieJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie jar: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookie file: %v", err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(text, "#HttpOnly_"); ok {
+			text, httpOnly = rest, true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("failed to read cookie file: line %d: expected 7 fields separated by tabs", line)
+		}
+		domain, subdomains, path, secure, expires, name, value := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+		seconds, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cookie file: line %d: invalid expiry: %s", line, expires)
+		}
+
+		cookie := &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     path,
+			Secure:   strings.EqualFold(secure, "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		// A cookie for subdomains has a Domain attribute, others are host-only
+		host := strings.TrimPrefix(domain, ".")
+		if strings.EqualFold(subdomains, "TRUE") {
+			cookie.Domain = host
+		}
+		// An expiry of 0 marks a session cookie
+		if seconds != 0 {
+			cookie.Expires = time.Unix(seconds, 0)
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: path}, []*http.Cookie{cookie})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cookie file: %v", err)
+	}
+	return jar, nil
+}
+
+// LoadCertPool reads PEM certificates, such as a CA bundle, into a
+// certificate pool for TLSConfig.RootCAs
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("failed to read CA bundle: no certificates found in %s", path)
+	}
+	return pool, nil
+}
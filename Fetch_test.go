@@ -0,0 +1,426 @@
+package hj
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFetcher_Request tests the headers and authentication sent by a fetcher
+func TestFetcher_Request(t *testing.T) {
+	tests := []struct {
+		name     string
+		fetcher  *Fetcher
+		expected string
+	}{
+		{
+			name:     "Defaults",
+			fetcher:  &Fetcher{},
+			expected: "UA=" + DefaultUserAgent + " Auth= Lang= Host=",
+		},
+		{
+			name:     "User agent and headers",
+			fetcher:  &Fetcher{UserAgent: "bot/1.0", Header: http.Header{"Accept-Language": {"ja"}, "Host": {"example.com"}}},
+			expected: "UA=bot/1.0 Auth= Lang=ja Host=example.com",
+		},
+		{
+			name:     "User agent in headers",
+			fetcher:  &Fetcher{UserAgent: "bot/1.0", Header: http.Header{"User-Agent": {"custom"}}},
+			expected: "UA=custom Auth= Lang= Host=",
+		},
+		{
+			name:     "Basic authentication",
+			fetcher:  &Fetcher{Username: "alice", Password: "secret"},
+			expected: "UA=" + DefaultUserAgent + " Auth=Basic YWxpY2U6c2VjcmV0 Lang= Host=",
+		},
+		{
+			name:     "Bearer token",
+			fetcher:  &Fetcher{BearerToken: "abc"},
+			expected: "UA=" + DefaultUserAgent + " Auth=Bearer abc Lang= Host=",
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if strings.HasPrefix(host, "127.0.0.1:") {
+			host = ""
+		}
+		fmt.Fprintf(w, "UA=%s Auth=%s Lang=%s Host=%s", r.UserAgent(), r.Header.Get("Authorization"), r.Header.Get("Accept-Language"), host)
+	}))
+	defer server.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.fetcher.Fetch(context.Background(), server.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(result.Body) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Body)
+			}
+		})
+	}
+}
+
+// TestFetcher_Response tests the final URL, status and headers of a response
+func TestFetcher_Response(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<p>moved</p>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := &Fetcher{}
+	result, err := fetcher.Fetch(context.Background(), server.URL+"/old")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.URL != server.URL+"/new" || result.StatusCode != http.StatusOK || result.ContentType() != "text/html; charset=utf-8" || string(result.Body) != "<p>moved</p>" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/missing"); err == nil || err.Error() != "HTTP error: 404" {
+		t.Errorf("Expected HTTP error: 404, got %v", err)
+	}
+}
+
+// TestFetcher_FetchDocument tests parsing a fetched document with its final URL as the source
+func TestFetcher_FetchDocument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=shift_jis")
+		w.Write([]byte("<p>\x82\xa0</p>"))
+	}))
+	defer server.Close()
+
+	doc, err := (&Fetcher{}).FetchDocument(context.Background(), server.URL+"/page", Options{Fragment: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc.Metadata.Source != server.URL+"/page" || doc.Metadata.Encoding != "shift_jis" {
+		t.Errorf("Unexpected metadata: %+v", doc.Metadata)
+	}
+	if text := textContent(doc.Children[0]); text != "あ" {
+		t.Errorf("Expected あ, got %q", text)
+	}
+}
+
+// TestFetcher_Timeouts tests giving up on servers that are slow to respond or to send data
+func TestFetcher_Timeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body" {
+			fmt.Fprint(w, "<p>partial")
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	fetcher := &Fetcher{ReadTimeout: 100 * time.Millisecond}
+	for _, path := range []string{"/headers", "/body"} {
+		start := time.Now()
+		if _, err := fetcher.Fetch(context.Background(), server.URL+path); err == nil {
+			t.Errorf("Expected a timeout for %s", path)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Timeout for %s took %v", path, elapsed)
+		}
+	}
+}
+
+// TestFetcher_Cookies tests sending cookies from a cookie file and keeping cookies set by the server
+func TestFetcher_Cookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "login", Value: "yes"})
+		}
+		var names []string
+		for _, cookie := range r.Cookies() {
+			names = append(names, cookie.Name+"="+cookie.Value)
+		}
+		fmt.Fprint(w, strings.Join(names, "; "))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	host = host[:strings.LastIndex(host, ":")]
+	future := time.Now().Add(time.Hour).Unix()
+	cookies := fmt.Sprintf(`# Netscape HTTP Cookie File
+
+%[1]s	FALSE	/	FALSE	%[2]d	session	abc
+#HttpOnly_%[1]s	FALSE	/	FALSE	0	token	xyz
+%[1]s	FALSE	/	FALSE	1	expired	old
+%[1]s	FALSE	/admin	FALSE	0	admin	1
+`, host, future)
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(path, []byte(cookies), 0644); err != nil {
+		t.Fatalf("Failed to write cookie file: %v", err)
+	}
+
+	jar, err := LoadCookieFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fetcher := &Fetcher{Jar: jar}
+	for _, tt := range []struct{ path, expected string }{
+		{"/", "session=abc; token=xyz"},
+		{"/login", "session=abc; token=xyz"},
+		{"/admin", "admin=1; session=abc; token=xyz; login=yes"},
+	} {
+		result, err := fetcher.Fetch(context.Background(), server.URL+tt.path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(result.Body) != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.path, tt.expected, result.Body)
+		}
+	}
+}
+
+// TestLoadCookieFile_Errors tests reading invalid cookie files
+func TestLoadCookieFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "Missing fields", content: "example.com\tFALSE\t/\tFALSE\t0\tname\n", err: "line 1: expected 7 fields"},
+		{name: "Invalid expiry", content: "# comment\nexample.com\tFALSE\t/\tFALSE\tnever\tname\tvalue\n", err: "line 2: invalid expiry: never"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cookies.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write cookie file: %v", err)
+			}
+			if _, err := LoadCookieFile(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	if _, err := LoadCookieFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
+
+// TestFetcher_TLS tests verifying servers with a CA bundle
+func TestFetcher_TLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	}))
+	// The rejected handshake is logged by the server otherwise
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	if _, err := (&Fetcher{}).Fetch(context.Background(), server.URL); err == nil {
+		t.Error("Expected a certificate error without the CA bundle")
+	}
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0644); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	pool, err := LoadCertPool(bundle)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := (&Fetcher{TLSConfig: &tls.Config{RootCAs: pool}}).Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(result.Body) != "secure" {
+		t.Errorf("Expected secure, got %q", result.Body)
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	if _, err := LoadCertPool(empty); err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("Expected no certificates error, got %v", err)
+	}
+}
+
+// TestFetcher_Proxy tests sending requests through a proxy
+func TestFetcher_Proxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	result, err := (&Fetcher{Proxy: proxyURL}).Fetch(context.Background(), "http://example.invalid/page")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "proxied http://example.invalid/page"; string(result.Body) != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Body)
+	}
+}
+
+// TestFetcher_Retries tests retrying network errors and temporary statuses
+func TestFetcher_Retries(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []int
+		header    string
+		retries   int
+		status    int
+		attempts  int
+	}{
+		{name: "Success after errors", responses: []int{503, 0, 429, 200}, retries: 3, status: 200, attempts: 4},
+		{name: "Retries exhausted", responses: []int{500, 502, 504}, retries: 2, status: 504, attempts: 3},
+		{name: "No retries", responses: []int{503, 200}, status: 503, attempts: 1},
+		{name: "Status that is not retried", responses: []int{404, 200}, retries: 3, status: 404, attempts: 1},
+		{name: "Short Retry-After", responses: []int{503, 200}, header: "0", retries: 1, status: 200, attempts: 2},
+		{name: "Retry-After longer than the limit", responses: []int{503, 200}, header: "3600", retries: 1, status: 503, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.responses[min(attempts, len(tt.responses)-1)]
+				attempts++
+				if status == 0 {
+					// Close the connection without a response
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(status)
+				fmt.Fprint(w, "body")
+			}))
+			defer server.Close()
+
+			fetcher := &Fetcher{Retries: tt.retries, RetryWait: time.Millisecond, MaxRetryWait: time.Minute}
+			result, err := fetcher.Fetch(context.Background(), server.URL)
+			status := 0
+			var statusErr *HTTPStatusError
+			if errors.As(err, &statusErr) {
+				status = statusErr.StatusCode
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else {
+				status = result.StatusCode
+			}
+			if status != tt.status || attempts != tt.attempts {
+				t.Errorf("Expected status %d after %d attempts, got %d after %d", tt.status, tt.attempts, status, attempts)
+			}
+		})
+	}
+}
+
+// TestFetcher_StatusError tests the details of a status error and reading error pages
+func TestFetcher_StatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Reason", "gone")
+		w.WriteHeader(http.StatusGone)
+		fmt.Fprint(w, "<p>This page was removed</p>")
+	}))
+	defer server.Close()
+
+	_, err := (&Fetcher{}).Fetch(context.Background(), server.URL+"/page")
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected an HTTPStatusError, got %v", err)
+	}
+	if err.Error() != "HTTP error: 410" || statusErr.URL != server.URL+"/page" || statusErr.Header.Get("X-Reason") != "gone" || statusErr.Temporary() {
+		t.Errorf("Unexpected error: %+v", statusErr)
+	}
+
+	result, err := (&Fetcher{AllowErrorStatus: true}).Fetch(context.Background(), server.URL+"/page")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.StatusCode != http.StatusGone || string(result.Body) != "<p>This page was removed</p>" {
+		t.Errorf("Unexpected result: %d %q", result.StatusCode, result.Body)
+	}
+}
+
+// TestRetryAfter tests parsing Retry-After headers
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "120", expected: 2 * time.Minute, ok: true},
+		{value: " 0 ", expected: 0, ok: true},
+		{value: "Wed, 01 May 2024 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{value: "Wed, 01 May 2024 11:00:00 GMT", expected: 0, ok: true},
+		{value: "-1"},
+		{value: "soon"},
+		{value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			wait, ok := retryAfter(tt.value, now)
+			if wait != tt.expected || ok != tt.ok {
+				t.Errorf("Expected %v %v, got %v %v", tt.expected, tt.ok, wait, ok)
+			}
+		})
+	}
+}
+
+// TestFetcher_RetryWait tests the exponential backoff between retries
+func TestFetcher_RetryWait(t *testing.T) {
+	fetcher := &Fetcher{Retries: 10, RetryWait: time.Second, MaxRetryWait: 10 * time.Second}
+	networkErr := fmt.Errorf("failed to fetch URL: connection reset")
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 0, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 2, min: 2 * time.Second, max: 4 * time.Second},
+		{attempt: 8, min: 5 * time.Second, max: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			wait, ok := fetcher.retryWait(context.Background(), tt.attempt, nil, networkErr)
+			if !ok || wait < tt.min || wait > tt.max {
+				t.Fatalf("Attempt %d: expected a wait between %v and %v, got %v %v", tt.attempt, tt.min, tt.max, wait, ok)
+			}
+		}
+	}
+
+	if _, ok := fetcher.retryWait(context.Background(), 10, nil, networkErr); ok {
+		t.Error("Expected no retry after the last attempt")
+	}
+}
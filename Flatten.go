@@ -0,0 +1,162 @@
+package hj
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FlatElement is an element of a document without its descendants,
+// as written by WriteNDJSON
+type FlatElement struct {
+	Tag        string            `json:"tag"`
+	ID         string            `json:"id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Text is the text of the direct child text nodes, trimmed of surrounding whitespace
+	Text string `json:"text,omitempty"`
+	// Depth is the number of ancestor elements
+	Depth int `json:"depth"`
+	// Index is the position of the element among its element siblings, starting at 0
+	Index int `json:"index"`
+	// Path locates the element from the top of the document, such as /html/body/div#content/p[2]
+	Path string `json:"path"`
+	// Parent is the path of the parent element, empty for top-level elements
+	Parent string `json:"parent,omitempty"`
+	// Source is the source of the document when metadata is requested
+	Source string `json:"source,omitempty"`
+}
+
+// Flatten returns all elements of the document in document order.
+// Paths are built from the keys of the ancestors, with the position among
+// siblings of the same tag added when it is needed to tell them apart.
+func Flatten(doc *Document) []FlatElement {
+	var elements []FlatElement
+	paths := newElementPaths(doc)
+	var walk func(nodes []*Node, depth int)
+	walk = func(nodes []*Node, depth int) {
+		for _, n := range nodes {
+			if n.Type != ElementNode {
+				continue
+			}
+			parent := ""
+			if n.Parent != nil {
+				parent = paths.path(n.Parent)
+			}
+			path := paths.path(n)
+
+			elements = append(elements, FlatElement{
+				Tag:        n.Tag,
+				ID:         n.ID,
+				Attributes: n.Attributes,
+				Text:       strings.Trim(directText(n), whitespaceChars),
+				Depth:      depth,
+				Index:      paths.index[n],
+				Path:       path,
+				Parent:     parent,
+			})
+			walk(n.Children, depth+1)
+		}
+	}
+	for _, n := range doc.Children {
+		// The top-level nodes of a selection keep their ancestors
+		depth := 0
+		for p := n.Parent; p != nil; p = p.Parent {
+			depth++
+		}
+		walk([]*Node{n}, depth)
+	}
+	return elements
+}
+
+// WriteNDJSON writes the flattened elements of the document as
+// newline-delimited JSON, one object per element
+func (d *Document) WriteNDJSON(w io.Writer, opts Options) error {
+	source := ""
+	if opts.Metadata && d.Metadata != nil {
+		source = d.Metadata.Source
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range Flatten(d) {
+		e.Source = source
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to convert to JSON: %v", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	return nil
+}
+
+// elementPaths builds the paths of the elements of a document. The steps
+// of all children of a parent are found in one pass over them, so that
+// building the paths of many siblings takes linear time.
+type elementPaths struct {
+	doc   *Document
+	paths map[*Node]string
+	steps map[*Node]string
+	// index is the position of an element among its element siblings
+	index map[*Node]int
+}
+
+func newElementPaths(doc *Document) *elementPaths {
+	return &elementPaths{doc: doc, paths: map[*Node]string{}, steps: map[*Node]string{}, index: map[*Node]int{}}
+}
+
+// path returns the path of n, caching the paths of its ancestors
+func (p *elementPaths) path(n *Node) string {
+	if path, ok := p.paths[n]; ok {
+		return path
+	}
+
+	prefix := ""
+	if n.Parent != nil {
+		prefix = p.path(n.Parent)
+	}
+	if _, ok := p.steps[n]; !ok {
+		p.addSiblings(n)
+	}
+	if _, ok := p.steps[n]; !ok {
+		// An ancestor of a selection is not among the top-level nodes of the document
+		p.steps[n], p.index[n] = n.Key(), -1
+	}
+
+	path := prefix + "/" + p.steps[n]
+	p.paths[n] = path
+	return path
+}
+
+// addSiblings records the steps and indexes of n and its element siblings
+func (p *elementPaths) addSiblings(n *Node) {
+	siblings := elementSiblings(p.doc, n)
+	counts := map[string]int{}
+	for _, s := range siblings {
+		counts[s.Tag]++
+	}
+
+	positions := map[string]int{}
+	for i, s := range siblings {
+		positions[s.Tag]++
+		step := s.Key()
+		if s.ID == "" && counts[s.Tag] > 1 {
+			step += fmt.Sprintf("[%d]", positions[s.Tag])
+		}
+		p.steps[s] = step
+		p.index[s] = i
+	}
+}
+
+// directText returns the text of the direct child text nodes of n
+func directText(n *Node) string {
+	var b strings.Builder
+	for _, c := range n.Children {
+		if c.Type == TextNode || c.Type == RawTextNode {
+			b.WriteString(c.Text)
+		}
+	}
+	return b.String()
+}
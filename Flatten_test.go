@@ -0,0 +1,98 @@
+package hj
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestFlatten tests flattening a document into its elements
+func TestFlatten(t *testing.T) {
+	input := `<div id="content" class="box"><p>a</p><p>Hello <b>world</b> !</p></div><div>z</div>`
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []FlatElement{
+		{Tag: "html", Depth: 0, Index: 0, Path: "/html"},
+		{Tag: "head", Depth: 1, Index: 0, Path: "/html/head", Parent: "/html"},
+		{Tag: "body", Depth: 1, Index: 1, Path: "/html/body", Parent: "/html"},
+		{Tag: "div", ID: "content", Attributes: map[string]string{"class": "box"}, Depth: 2, Index: 0, Path: "/html/body/div#content", Parent: "/html/body"},
+		{Tag: "p", Text: "a", Depth: 3, Index: 0, Path: "/html/body/div#content/p[1]", Parent: "/html/body/div#content"},
+		{Tag: "p", Text: "Hello  !", Depth: 3, Index: 1, Path: "/html/body/div#content/p[2]", Parent: "/html/body/div#content"},
+		{Tag: "b", Text: "world", Depth: 4, Index: 0, Path: "/html/body/div#content/p[2]/b", Parent: "/html/body/div#content/p[2]"},
+		{Tag: "div", Text: "z", Depth: 2, Index: 1, Path: "/html/body/div[2]", Parent: "/html/body"},
+	}
+
+	elements := Flatten(doc)
+	if len(elements) != len(expected) {
+		t.Fatalf("Expected %d elements, got %d: %+v", len(expected), len(elements), elements)
+	}
+	for i, e := range elements {
+		exp := expected[i]
+		if e.Tag != exp.Tag || e.ID != exp.ID || e.Text != exp.Text || e.Depth != exp.Depth ||
+			e.Index != exp.Index || e.Path != exp.Path || e.Parent != exp.Parent ||
+			len(e.Attributes) != len(exp.Attributes) || e.Attributes["class"] != exp.Attributes["class"] {
+			t.Errorf("Element %d: expected %+v, got %+v", i, exp, e)
+		}
+	}
+}
+
+// TestFlatten_Fragment tests paths of the top-level elements of a fragment
+func TestFlatten_Fragment(t *testing.T) {
+	doc, err := ParseFragment(strings.NewReader(`<li>a</li>text<li>b</li><!-- c -->`), "ul")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	elements := Flatten(doc)
+	if len(elements) != 2 {
+		t.Fatalf("Expected 2 elements, got %+v", elements)
+	}
+	if elements[0].Path != "/li[1]" || elements[1].Path != "/li[2]" || elements[1].Index != 1 || elements[1].Parent != "" {
+		t.Errorf("Unexpected elements: %+v", elements)
+	}
+}
+
+// TestDocument_WriteNDJSON tests writing one JSON object per line
+func TestDocument_WriteNDJSON(t *testing.T) {
+	doc, err := ParseFragment(strings.NewReader(`<p id="a">x</p><p title="t">y</p>`), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc.Metadata = &Metadata{Source: "test.html"}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			name: "Default",
+			opts: Options{},
+			expected: `{"tag":"p","id":"a","text":"x","depth":0,"index":0,"path":"/p#a"}
+{"tag":"p","attributes":{"title":"t"},"text":"y","depth":0,"index":1,"path":"/p[2]"}
+`,
+		},
+		{
+			name: "Metadata",
+			opts: Options{Metadata: true},
+			expected: `{"tag":"p","id":"a","text":"x","depth":0,"index":0,"path":"/p#a","source":"test.html"}
+{"tag":"p","attributes":{"title":"t"},"text":"y","depth":0,"index":1,"path":"/p[2]","source":"test.html"}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := doc.WriteNDJSON(&buf, tt.opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package hj
+
+import (
+	"strings"
+)
+
+// Form describes a <form> element and the controls submitted with it
+type Form struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Action is the URL the form is submitted to, resolved against the base URL of the document
+	Action string `json:"action"`
+	// Method is "get", "post" or "dialog"
+	Method string `json:"method"`
+	// Enctype is the content type used to submit the form
+	Enctype  string         `json:"enctype"`
+	Controls []*FormControl `json:"controls"`
+}
+
+// FormControl describes an input, select, textarea or button element
+type FormControl struct {
+	Tag string `json:"tag"`
+	// Type is the type attribute of inputs and buttons, "select-one" or
+	// "select-multiple" for selects and "textarea" for textareas
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	ID   string `json:"id,omitempty"`
+	// Value is the default value. For selects it is the value of the first
+	// selected option, or of the option selected by default.
+	Value    string `json:"value"`
+	Checked  bool   `json:"checked,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	// Disabled is also set for controls inside a disabled fieldset
+	Disabled bool   `json:"disabled,omitempty"`
+	Label    string `json:"label,omitempty"`
+	// Options holds the options of a select, including those in optgroups
+	Options []*FormOption `json:"options,omitempty"`
+}
+
+// FormOption describes an <option> of a select
+type FormOption struct {
+	Value    string `json:"value"`
+	Label    string `json:"label"`
+	Selected bool   `json:"selected,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// Default attribute values of forms
+const (
+	defaultFormMethod  = "get"
+	defaultFormEnctype = "application/x-www-form-urlencoded"
+)
+
+// formMethods and formEnctypes list the valid values of method and enctype
+var (
+	formMethods  = []string{"get", "post", "dialog"}
+	formEnctypes = []string{defaultFormEnctype, "multipart/form-data", "text/plain"}
+)
+
+// inputTypes lists the valid input types, any other type is "text"
+var inputTypes = []string{
+	"hidden", "text", "search", "tel", "url", "email", "password", "date", "month", "week", "time",
+	"datetime-local", "number", "range", "color", "checkbox", "radio", "file", "submit", "image", "reset", "button",
+}
+
+// ExtractForms returns the forms of the document in document order.
+// The controls of a form are its descendants and the controls elsewhere in
+// the document whose form attribute names it.
+func ExtractForms(doc *Document) []*Form {
+	base := doc.BaseURL()
+	source := doc.SourceURL()
+
+	byID := map[string]*Form{}
+	owners := map[*Node]*Form{}
+	var forms []*Form
+	walkElements(doc.Children, func(n *Node) {
+		if n.Tag != "form" {
+			return
+		}
+		form := newForm(n)
+		// A missing or empty action submits the form to the document itself
+		if action, ok := n.Attributes["action"]; ok && strings.Trim(action, whitespaceChars) != "" {
+			form.Action = resolveURL(base, action)
+		} else if source != nil {
+			form.Action = source.String()
+		}
+		if n.ID != "" && byID[n.ID] == nil {
+			byID[n.ID] = form
+		}
+		owners[n] = form
+		forms = append(forms, form)
+	})
+	if len(forms) == 0 {
+		return forms
+	}
+
+	labels := formLabels(doc)
+	walkElements(doc.Children, func(n *Node) {
+		if !formControlTags[n.Tag] {
+			return
+		}
+
+		var form *Form
+		if id, ok := n.Attributes["form"]; ok {
+			form = byID[id]
+		} else {
+			for p := n.Parent; p != nil && form == nil; p = p.Parent {
+				form = owners[p]
+			}
+		}
+		if form != nil {
+			form.Controls = append(form.Controls, newFormControl(n, labels))
+		}
+	})
+	return forms
+}
+
+// FormsToJSON writes forms as JSON
+func FormsToJSON(forms []*Form, opts Options) ([]byte, error) {
+	if forms == nil {
+		forms = []*Form{}
+	}
+	return marshalJSON(forms, opts)
+}
+
+// formControlTags lists the elements described as form controls
+var formControlTags = map[string]bool{
+	"input":    true,
+	"select":   true,
+	"textarea": true,
+	"button":   true,
+}
+
+// newForm describes a form element without its controls
+func newForm(n *Node) *Form {
+	form := &Form{
+		ID:       n.ID,
+		Name:     n.Attributes["name"],
+		Method:   defaultFormMethod,
+		Enctype:  defaultFormEnctype,
+		Controls: []*FormControl{},
+	}
+	if method := strings.ToLower(strings.Trim(n.Attributes["method"], whitespaceChars)); indexOfString(formMethods, method) >= 0 {
+		form.Method = method
+	}
+	if enctype := strings.ToLower(strings.Trim(n.Attributes["enctype"], whitespaceChars)); indexOfString(formEnctypes, enctype) >= 0 {
+		form.Enctype = enctype
+	}
+	return form
+}
+
+// newFormControl describes a control element
+func newFormControl(n *Node, labels map[string]string) *FormControl {
+	_, required := n.Attributes["required"]
+	_, disabled := n.Attributes["disabled"]
+	control := &FormControl{
+		Tag:      n.Tag,
+		Name:     n.Attributes["name"],
+		ID:       n.ID,
+		Required: required,
+		Disabled: disabled || disabledFieldset(n),
+		Label:    controlLabel(n, labels),
+	}
+
+	switch n.Tag {
+	case "input":
+		control.Type = strings.ToLower(n.Attributes["type"])
+		if indexOfString(inputTypes, control.Type) < 0 {
+			control.Type = "text"
+		}
+		value, ok := n.Attributes["value"]
+		if !ok && (control.Type == "checkbox" || control.Type == "radio") {
+			value = "on"
+		}
+		control.Value = value
+		_, control.Checked = n.Attributes["checked"]
+	case "button":
+		control.Type = strings.ToLower(n.Attributes["type"])
+		if control.Type != "reset" && control.Type != "button" {
+			control.Type = "submit"
+		}
+		control.Value = n.Attributes["value"]
+	case "textarea":
+		control.Type = "textarea"
+		control.Value = textContent(n)
+	case "select":
+		setSelectOptions(control, n)
+	}
+	return control
+}
+
+// setSelectOptions sets the type, options and value of a select control
+func setSelectOptions(control *FormControl, n *Node) {
+	_, multiple := n.Attributes["multiple"]
+	control.Type = "select-one"
+	if multiple {
+		control.Type = "select-multiple"
+	}
+
+	var addOptions func(n *Node, disabled bool)
+	addOptions = func(n *Node, disabled bool) {
+		for _, c := range n.Children {
+			if c.Type != ElementNode {
+				continue
+			}
+			_, optionDisabled := c.Attributes["disabled"]
+			switch c.Tag {
+			case "option":
+				label := strings.Join(strings.Fields(textContent(c)), " ")
+				value, ok := c.Attributes["value"]
+				if !ok {
+					value = label
+				}
+				if l, ok := c.Attributes["label"]; ok && l != "" {
+					label = l
+				}
+				_, selected := c.Attributes["selected"]
+				control.Options = append(control.Options, &FormOption{
+					Value:    value,
+					Label:    label,
+					Selected: selected,
+					Disabled: disabled || optionDisabled,
+				})
+			case "optgroup":
+				addOptions(c, optionDisabled)
+			}
+		}
+	}
+	addOptions(n, false)
+
+	for _, option := range control.Options {
+		if option.Selected {
+			control.Value = option.Value
+			return
+		}
+	}
+	// A single select shows its first enabled option when none is selected
+	if !multiple {
+		for _, option := range control.Options {
+			if !option.Disabled {
+				control.Value = option.Value
+				return
+			}
+		}
+	}
+}
+
+// disabledFieldset reports whether n is inside a disabled fieldset,
+// outside the first legend of that fieldset
+func disabledFieldset(n *Node) bool {
+	child := n
+	for p := n.Parent; p != nil; child, p = p, p.Parent {
+		if p.Type != ElementNode || p.Tag != "fieldset" {
+			continue
+		}
+		if _, ok := p.Attributes["disabled"]; !ok {
+			continue
+		}
+		if legend := firstChildElement(p, "legend"); legend == nil || legend != child {
+			return true
+		}
+	}
+	return false
+}
+
+// firstChildElement returns the first child element of n with the given tag
+func firstChildElement(n *Node, tag string) *Node {
+	for _, c := range n.Children {
+		if c.Type == ElementNode && c.Tag == tag {
+			return c
+		}
+	}
+	return nil
+}
+
+// formLabels returns the text of the labels with a for attribute by control id.
+// The first label for an id is used.
+func formLabels(doc *Document) map[string]string {
+	labels := map[string]string{}
+	walkElements(doc.Children, func(n *Node) {
+		if n.Tag != "label" {
+			return
+		}
+		if id, ok := n.Attributes["for"]; ok {
+			if _, seen := labels[id]; !seen {
+				labels[id] = labelText(n)
+			}
+		}
+	})
+	return labels
+}
+
+// controlLabel returns the text of the label of a control: the label
+// referring to its id, or else the label containing it
+func controlLabel(n *Node, labels map[string]string) string {
+	if n.ID != "" {
+		if label, ok := labels[n.ID]; ok {
+			return label
+		}
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == ElementNode && p.Tag == "label" {
+			if _, ok := p.Attributes["for"]; !ok {
+				return labelText(p)
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// labelText returns the text of a label with whitespace collapsed, leaving
+// out the content of the controls inside it
+func labelText(n *Node) string {
+	var b strings.Builder
+	var appendLabelText func(n *Node)
+	appendLabelText = func(n *Node) {
+		for _, c := range n.Children {
+			switch {
+			case c.Type == TextNode:
+				b.WriteString(c.Text)
+			case c.Type == ElementNode && !formControlTags[c.Tag] && c.Tag != "datalist":
+				appendLabelText(c)
+			}
+		}
+	}
+	appendLabelText(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// textContent returns the text of all descendant text nodes of n
+func textContent(n *Node) string {
+	var b strings.Builder
+	appendText(&b, n)
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package hj
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExtractForms tests describing forms and their controls
+func TestExtractForms(t *testing.T) {
+	input := `<base href="/app/">
+<form id="signup" name="s" action=" submit?x=1 " method="POST" enctype="multipart/form-data">
+<label for="email">E-mail <b>*</b></label><input id="email" type="EMAIL" name="email" required>
+<label><input type="checkbox" name="agree" checked> I agree</label>
+<fieldset disabled><legend><input name="first"></legend><textarea name="note">
+Hello</textarea></fieldset>
+<select name="plan"><option value="">--</option><optgroup label="Old" disabled><option> Basic  plan </option></optgroup><option value="pro" label="Pro plan" selected>Pro</option></select>
+<select name="tags" multiple><option>a</option></select>
+<button disabled>Send</button>
+</form>
+<input name="outside" form="signup" type="unknown">
+<input name="orphan">
+<form method="put"><select name="size"><option disabled>S</option><option>M</option></select></form>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc.Metadata = &Metadata{Source: "https://example.com/dir/page.html"}
+
+	expected := []*Form{
+		{
+			ID:      "signup",
+			Name:    "s",
+			Action:  "https://example.com/app/submit?x=1",
+			Method:  "post",
+			Enctype: "multipart/form-data",
+			Controls: []*FormControl{
+				{Tag: "input", Type: "email", Name: "email", ID: "email", Required: true, Label: "E-mail *"},
+				{Tag: "input", Type: "checkbox", Name: "agree", Value: "on", Checked: true, Label: "I agree"},
+				{Tag: "input", Type: "text", Name: "first"},
+				{Tag: "textarea", Type: "textarea", Name: "note", Value: "Hello", Disabled: true},
+				{Tag: "select", Type: "select-one", Name: "plan", Value: "pro", Options: []*FormOption{
+					{Value: "", Label: "--"},
+					{Value: "Basic plan", Label: "Basic plan", Disabled: true},
+					{Value: "pro", Label: "Pro plan", Selected: true},
+				}},
+				{Tag: "select", Type: "select-multiple", Name: "tags", Options: []*FormOption{{Value: "a", Label: "a"}}},
+				{Tag: "button", Type: "submit", Disabled: true},
+				{Tag: "input", Type: "text", Name: "outside"},
+			},
+		},
+		{
+			Action:  "https://example.com/dir/page.html",
+			Method:  "get",
+			Enctype: "application/x-www-form-urlencoded",
+			Controls: []*FormControl{
+				{Tag: "select", Type: "select-one", Name: "size", Value: "M", Options: []*FormOption{
+					{Value: "S", Label: "S", Disabled: true},
+					{Value: "M", Label: "M"},
+				}},
+			},
+		},
+	}
+
+	forms := ExtractForms(doc)
+	if len(forms) != len(expected) {
+		t.Fatalf("Expected %d forms, got %d", len(expected), len(forms))
+	}
+	for i, form := range forms {
+		if !reflect.DeepEqual(form, expected[i]) {
+			data, _ := FormsToJSON([]*Form{form}, Options{Compact: true})
+			t.Errorf("Form %d: unexpected form %s", i, data)
+		}
+	}
+}
+
+// TestExtractForms_RelativeAction tests forms of documents without a URL
+func TestExtractForms_RelativeAction(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<form action="../post"></form><form></form>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	forms := ExtractForms(doc)
+	if len(forms) != 2 || forms[0].Action != "../post" || forms[1].Action != "" {
+		t.Errorf("Unexpected forms: %+v", forms)
+	}
+
+	data, err := FormsToJSON(ExtractForms(&Document{}), Options{})
+	if err != nil || string(data) != "[]" {
+		t.Errorf("Expected empty array, got %s (%v)", data, err)
+	}
+}
@@ -3,9 +3,8 @@ package hj
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
-
-	"golang.org/x/net/html"
 )
 
 // HTMLElement represents an HTML element
@@ -16,9 +15,140 @@ type HTMLElement struct {
 	Child      interface{}            `json:"child,omitempty"`
 }
 
-// JSONOutput represents the final JSON output format
+// JSONOutput represents the final JSON output format of an element,
+// keyed by the element key such as "div#content"
 type JSONOutput map[string]*HTMLElement
 
+// WhitespacePolicy controls how whitespace in text nodes is handled
+type WhitespacePolicy int
+
+const (
+	// WhitespaceDefault trims text, or collapses it when MixedContent is enabled
+	WhitespaceDefault WhitespacePolicy = iota
+	// WhitespaceTrim removes leading and trailing whitespace of every text node
+	WhitespaceTrim
+	// WhitespaceCollapse replaces every run of whitespace with a single space
+	WhitespaceCollapse
+	// WhitespacePreserve keeps text exactly as it appears in the HTML
+	WhitespacePreserve
+)
+
+// AttributePolicy controls which attributes are written to "attributes"
+type AttributePolicy int
+
+const (
+	// AttributesDefault writes every attribute except the one used in the key
+	AttributesDefault AttributePolicy = iota
+	// AttributesAll writes every attribute, including id
+	AttributesAll
+	// AttributesNone drops all attributes
+	AttributesNone
+)
+
+// KeyStyle controls how element keys are generated
+type KeyStyle int
+
+const (
+	// KeyTagID uses "tag#id", or "tag" when the element has no id
+	KeyTagID KeyStyle = iota
+	// KeyTag uses the tag name only and leaves id in "attributes"
+	KeyTag
+)
+
+// DefaultIndent is the indentation used when Options.Indent is empty
+const DefaultIndent = "    "
+
+// Options controls how HTML is converted to JSON.
+// The zero value produces the same output as HTMLtoJSON.
+type Options struct {
+	// MixedContent keeps text and element children together in document order.
+	// When enabled, "child" becomes an array interleaving text strings and
+	// element maps instead of dropping text next to elements.
+	MixedContent bool
+
+	// Whitespace selects how text nodes are normalized
+	Whitespace WhitespacePolicy
+
+	// Indent is the indentation string for each nesting level (DefaultIndent if empty)
+	Indent string
+
+	// Compact writes JSON without any indentation or newlines
+	Compact bool
+
+	// KeepComments writes HTML comments as {"#comment": "text"} children
+	KeepComments bool
+
+	// Attributes selects which attributes are written
+	Attributes AttributePolicy
+
+	// KeyStyle selects how element keys are generated
+	KeyStyle KeyStyle
+
+	// Lossless keeps everything the HTML parser reports. It implies MixedContent,
+	// KeepComments and WhitespacePreserve, writes the document as an array of its
+	// top-level nodes, and adds {"#doctype": {...}}, {"#pi": "..."} and
+	// {"#raw": "..."} objects for the doctype, processing instructions and the
+	// content of raw text elements such as script and style.
+	Lossless bool
+
+	// Fragment parses the HTML as a fragment without adding html, head and body
+	// elements, and writes an array of all its top-level nodes
+	Fragment bool
+
+	// FragmentContext is the element the fragment is parsed in, such as "ul" or
+	// "tbody" (DefaultFragmentContext if empty)
+	FragmentContext string
+
+	// Metadata writes {"metadata": {...}, "document": ...} instead of the
+	// document alone when the document has Metadata
+	Metadata bool
+}
+
+// metadataJSON represents the output with a metadata section
+type metadataJSON struct {
+	Metadata *Metadata   `json:"metadata"`
+	Document interface{} `json:"document"`
+}
+
+// doctypeJSON represents a doctype in lossless output
+type doctypeJSON struct {
+	Name   string `json:"name"`
+	Public string `json:"public,omitempty"`
+	System string `json:"system,omitempty"`
+}
+
+// mixedContent reports whether text and elements are kept in document order
+func (o Options) mixedContent() bool {
+	return o.MixedContent || o.Lossless
+}
+
+// keepComments reports whether comments are written
+func (o Options) keepComments() bool {
+	return o.KeepComments || o.Lossless
+}
+
+// whitespace returns the effective whitespace policy
+func (o Options) whitespace() WhitespacePolicy {
+	if o.Lossless {
+		return WhitespacePreserve
+	}
+	if o.Whitespace != WhitespaceDefault {
+		return o.Whitespace
+	}
+	if o.MixedContent {
+		return WhitespaceCollapse
+	}
+	return WhitespaceTrim
+}
+
+// indent returns the effective indentation string
+func (o Options) indent() string {
+	if o.Indent == "" {
+		return DefaultIndent
+	}
+	return o.Indent
+}
+
 // generateElementKey generates a key according to specification from tag name and ID
 func generateElementKey(tagName, id string) string {
 	if id != "" {
@@ -27,96 +157,269 @@ func generateElementKey(tagName, id string) string {
 	return tagName
 }
 
-// parseHTMLtoJSON converts HTML to JSON based on new specification
-func parseHTMLtoJSON(n *html.Node) interface{} {
-	switch n.Type {
-	case html.DocumentNode:
-		// For document node, process child nodes (usually html element)
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				return parseHTMLtoJSON(c)
+// collapseWhitespace replaces every run of whitespace with a single space
+func collapseWhitespace(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// normalizeText applies the whitespace policy to text.
+// It returns false when the text should be dropped.
+func normalizeText(text string, policy WhitespacePolicy) (string, bool) {
+	switch policy {
+	case WhitespacePreserve:
+		return text, text != ""
+	case WhitespaceCollapse:
+		text = collapseWhitespace(text)
+		return text, strings.TrimSpace(text) != ""
+	default:
+		text = strings.TrimSpace(text)
+		return text, text != ""
+	}
+}
+
+// toJSON converts the document to the JSON structure based on new specification
+func (d *Document) toJSON(opts Options) interface{} {
+	// Fragments and lossless output keep every top-level node such as the doctype
+	if d.Fragment || opts.Lossless {
+		nodes := []interface{}{}
+		for _, c := range d.Children {
+			if childJSON := nodeToJSON(c, opts); childJSON != nil {
+				nodes = append(nodes, childJSON)
 			}
 		}
+		return nodes
+	}
+
+	// For the document, process its root element (usually html)
+	root := d.Root()
+	if root == nil {
 		return nil
+	}
+	return nodeToJSON(root, opts)
+}
 
-	case html.ElementNode:
+// nodeToJSON converts a node to the JSON structure based on new specification
+func nodeToJSON(n *Node, opts Options) interface{} {
+	switch n.Type {
+	case ElementNode:
 		element := &HTMLElement{
-			TagName: n.Data,
+			TagName: n.Tag,
+			ID:      n.ID,
 		}
 
 		// Process attributes
-		var id string
-		if len(n.Attr) > 0 {
-			for _, attr := range n.Attr {
-				if attr.Key == "id" {
-					id = attr.Val
-					element.ID = id
-				} else {
-					if element.Attributes == nil {
-						element.Attributes = make(map[string]string)
-					}
-					element.Attributes[attr.Key] = attr.Val
-				}
+		if n.ID != "" && opts.Attributes != AttributesNone &&
+			(opts.KeyStyle != KeyTagID || opts.Attributes == AttributesAll) {
+			element.Attributes = map[string]string{"id": n.ID}
+		}
+		if len(n.Attributes) > 0 && opts.Attributes != AttributesNone {
+			if element.Attributes == nil {
+				element.Attributes = make(map[string]string, len(n.Attributes))
+			}
+			for key, val := range n.Attributes {
+				element.Attributes[key] = val
 			}
 		}
 
 		// Process child nodes
-		var children []interface{}
-		var textContent strings.Builder
-
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				childJSON := parseHTMLtoJSON(c)
-				if childJSON != nil {
-					children = append(children, childJSON)
-				}
-			} else if c.Type == html.TextNode {
-				text := strings.TrimSpace(c.Data)
-				if text != "" {
-					textContent.WriteString(text)
+		if opts.mixedContent() {
+			element.Child = mixedContentToJSON(n, opts)
+		} else {
+			var children []interface{}
+			var textContent strings.Builder
+
+			for _, c := range n.Children {
+				if c.Type == ElementNode || c.Type == CommentNode || c.Type == ProcessingInstructionNode {
+					childJSON := nodeToJSON(c, opts)
+					if childJSON != nil {
+						children = append(children, childJSON)
+					}
+				} else if c.Type == TextNode || c.Type == RawTextNode {
+					if text, ok := normalizeText(c.Text, opts.whitespace()); ok {
+						textContent.WriteString(text)
+					}
 				}
 			}
-		}
 
-		// Determine child content
-		if len(children) > 0 {
-			element.Child = children
-		} else if textContent.Len() > 0 {
-			element.Child = textContent.String()
+			// Determine child content
+			if len(children) > 0 {
+				element.Child = children
+			} else if textContent.Len() > 0 {
+				text := textContent.String()
+				if opts.whitespace() == WhitespaceCollapse {
+					text = strings.TrimSpace(collapseWhitespace(text))
+				}
+				element.Child = text
+			}
 		}
 
 		// 結果をマップ形式で返す
-		key := generateElementKey(n.Data, id)
-		result := make(map[string]*HTMLElement)
-		result[key] = element
+		key := n.Tag
+		if opts.KeyStyle == KeyTagID {
+			key = n.Key()
+		}
+		return JSONOutput{key: element}
 
-		return result
+	case TextNode:
+		if text, ok := normalizeText(n.Text, opts.whitespace()); ok {
+			return text
+		}
+		return nil
 
-	case html.TextNode:
-		text := strings.TrimSpace(n.Data)
-		if text != "" {
+	case RawTextNode:
+		if opts.Lossless {
+			return map[string]string{"#raw": n.Text}
+		}
+		if text, ok := normalizeText(n.Text, opts.whitespace()); ok {
 			return text
 		}
 		return nil
 
+	case CommentNode:
+		if opts.keepComments() {
+			return map[string]string{"#comment": n.Text}
+		}
+		return nil
+
+	case ProcessingInstructionNode:
+		if opts.Lossless {
+			return map[string]string{"#pi": n.Text}
+		}
+		if opts.KeepComments {
+			return map[string]string{"#comment": "?" + n.Text + "?"}
+		}
+		return nil
+
+	case DoctypeNode:
+		if opts.Lossless {
+			return map[string]doctypeJSON{"#doctype": {
+				Name:   n.Tag,
+				Public: n.Attributes["public"],
+				System: n.Attributes["system"],
+			}}
+		}
+		return nil
+
 	default:
 		return nil
 	}
 }
 
+// mixedContentToJSON returns the children of n as text strings and element maps
+// in document order. A lone text child is returned as a plain string.
+func mixedContentToJSON(n *Node, opts Options) interface{} {
+	policy := opts.whitespace()
+	var children []interface{}
+	for _, c := range n.Children {
+		if c.Type == RawTextNode && opts.Lossless {
+			children = append(children, nodeToJSON(c, opts))
+			continue
+		}
+		switch c.Type {
+		case ElementNode, CommentNode, ProcessingInstructionNode:
+			if childJSON := nodeToJSON(c, opts); childJSON != nil {
+				children = append(children, childJSON)
+			}
+		case TextNode, RawTextNode:
+			text, ok := normalizeText(c.Text, policy)
+			if !ok {
+				continue
+			}
+			// Adjacent text nodes are merged so that they read as one fragment
+			if last := len(children) - 1; last >= 0 {
+				if prev, ok := children[last].(string); ok {
+					children[last], _ = normalizeText(prev+text, policy)
+					continue
+				}
+			}
+			children = append(children, text)
+		}
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	// Whitespace at the edges of the element carries no meaning
+	if policy == WhitespaceCollapse {
+		if text, ok := children[0].(string); ok {
+			children[0] = strings.TrimLeft(text, " ")
+		}
+		last := len(children) - 1
+		if text, ok := children[last].(string); ok {
+			children[last] = strings.TrimRight(text, " ")
+		}
+	}
+
+	if len(children) == 1 {
+		if text, ok := children[0].(string); ok {
+			return text
+		}
+	}
+	return children
+}
+
+// ToJSON writes the document as JSON text using opts
+func (d *Document) ToJSON(opts Options) ([]byte, error) {
+	// Create JSON structure based on new specification
+	return d.marshal(d.toJSON(opts), opts)
+}
+
+// marshal writes jsonStructure taken from the document as JSON text using opts,
+// adding the metadata of the document when requested
+func (d *Document) marshal(jsonStructure interface{}, opts Options) ([]byte, error) {
+	if opts.Metadata && d.Metadata != nil {
+		jsonStructure = metadataJSON{Metadata: d.Metadata, Document: jsonStructure}
+	}
+	return marshalJSON(jsonStructure, opts)
+}
+
+// marshalJSON converts v to JSON, indented unless opts.Compact is set
+func marshalJSON(v interface{}, opts Options) ([]byte, error) {
+	var jsonData []byte
+	var err error
+	if opts.Compact {
+		jsonData, err = json.Marshal(v)
+	} else {
+		jsonData, err = json.MarshalIndent(v, "", opts.indent())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to JSON: %v", err)
+	}
+	return jsonData, nil
+}
+
 // HTMLtoJSON converts HTML to JSON based on new specification
 func HTMLtoJSON(htmlContent string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
+	return HTMLtoJSONWithOptions(strings.NewReader(htmlContent), Options{})
+}
+
+// HTMLtoJSONWithOptions reads HTML from r and converts it to JSON using opts
+func HTMLtoJSONWithOptions(r io.Reader, opts Options) (string, error) {
+	doc, err := ParseWithOptions(r, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse HTML: %v", err)
+		return "", err
 	}
 
-	// Create JSON structure based on new specification
-	jsonStructure := parseHTMLtoJSON(doc)
-
-	jsonData, err := json.MarshalIndent(jsonStructure, "", "    ")
+	jsonData, err := doc.ToJSON(opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert to JSON: %v", err)
+		return "", err
 	}
 
 	return string(jsonData), nil
@@ -2,6 +2,8 @@ package hj
 
 import (
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -323,6 +325,241 @@ func TestHTMLtoJSON_AttributeHandling(t *testing.T) {
 	}
 }
 
+// TestCollapseWhitespace tests the collapseWhitespace function
+func TestCollapseWhitespace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Hello", "Hello"},
+		{"  Hello \n\t world  ", " Hello world "},
+		{"\n\n", " "},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		result := collapseWhitespace(tt.input)
+		if result != tt.expected {
+			t.Errorf("collapseWhitespace(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+// TestHTMLtoJSONWithOptions_MixedContent tests ordered mixed text and element content
+func TestHTMLtoJSONWithOptions_MixedContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "Text around element",
+			html:     "<p>Hello <b>world</b>!</p>",
+			expected: `[{"p":{"child":["Hello ",{"b":{"child":"world"}},"!"]}}]`,
+		},
+		{
+			name:     "Text only",
+			html:     "<p>\n  Just   text\n</p>",
+			expected: `[{"p":{"child":"Just text"}}]`,
+		},
+		{
+			name:     "Fragments split by comment",
+			html:     "<p>one<!-- c --> two</p>",
+			expected: `[{"p":{"child":"one two"}}]`,
+		},
+		{
+			name:     "Whitespace between elements",
+			html:     "<ul>\n  <li>a</li>\n  <li>b</li>\n</ul>",
+			expected: `[{"ul":{"child":[{"li":{"child":"a"}},{"li":{"child":"b"}}]}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := HTMLtoJSONWithOptions(strings.NewReader(tt.html), Options{MixedContent: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var jsonResult struct {
+				HTML struct {
+					Child []map[string]struct {
+						Child interface{} `json:"child"`
+					} `json:"child"`
+				} `json:"html"`
+			}
+			if err := json.Unmarshal([]byte(result), &jsonResult); err != nil {
+				t.Fatalf("Result is not valid JSON: %v\nResult: %s", err, result)
+			}
+
+			body := jsonResult.HTML.Child[1]["body"].Child
+			var expected interface{}
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatalf("Invalid expectation: %v", err)
+			}
+			if !reflect.DeepEqual(body, expected) {
+				t.Errorf("Unexpected body content\nGot:      %v\nExpected: %v", body, expected)
+			}
+		})
+	}
+}
+
+// TestHTMLtoJSONWithOptions_Defaults tests that zero options match HTMLtoJSON
+func TestHTMLtoJSONWithOptions_Defaults(t *testing.T) {
+	input := "<div id=\"main\">Hello <b>world</b>!</div>"
+
+	expected, err := HTMLtoJSON(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := HTMLtoJSONWithOptions(strings.NewReader(input), Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result != expected {
+		t.Errorf("Expected default output\n%s\ngot\n%s", expected, result)
+	}
+}
+
+// TestHTMLtoJSONWithOptions_Output tests options controlling whitespace, comments, attributes, keys and indentation
+func TestHTMLtoJSONWithOptions_Output(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		opts     Options
+		expected string
+	}{
+		{
+			name:     "Default",
+			html:     `<p id="x" class="c">  a  b  </p>`,
+			opts:     Options{Compact: true},
+			expected: `{"p#x":{"attributes":{"class":"c"},"child":"a  b"}}`,
+		},
+		{
+			name:     "Whitespace collapse",
+			html:     `<p>  a  <!-- c -->  b  </p>`,
+			opts:     Options{Compact: true, Whitespace: WhitespaceCollapse},
+			expected: `{"p":{"child":"a b"}}`,
+		},
+		{
+			name:     "Whitespace preserve",
+			html:     `<p>  a  b  </p>`,
+			opts:     Options{Compact: true, Whitespace: WhitespacePreserve},
+			expected: `{"p":{"child":"  a  b  "}}`,
+		},
+		{
+			name:     "Keep comments",
+			html:     `<div><!-- note --><p>a</p></div>`,
+			opts:     Options{Compact: true, KeepComments: true},
+			expected: `{"div":{"child":[{"#comment":" note "},{"p":{"child":"a"}}]}}`,
+		},
+		{
+			name:     "Keep comments with mixed content",
+			html:     `<p>a<!--x-->b</p>`,
+			opts:     Options{Compact: true, KeepComments: true, MixedContent: true},
+			expected: `{"p":{"child":["a",{"#comment":"x"},"b"]}}`,
+		},
+		{
+			name:     "All attributes",
+			html:     `<p id="x" class="c">a</p>`,
+			opts:     Options{Compact: true, Attributes: AttributesAll},
+			expected: `{"p#x":{"attributes":{"class":"c","id":"x"},"child":"a"}}`,
+		},
+		{
+			name:     "No attributes",
+			html:     `<p id="x" class="c">a</p>`,
+			opts:     Options{Compact: true, Attributes: AttributesNone},
+			expected: `{"p#x":{"child":"a"}}`,
+		},
+		{
+			name:     "Tag key style",
+			html:     `<p id="x" class="c">a</p>`,
+			opts:     Options{Compact: true, KeyStyle: KeyTag},
+			expected: `{"p":{"attributes":{"class":"c","id":"x"},"child":"a"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := HTMLtoJSONWithOptions(strings.NewReader("<body>"+tt.html+"</body>"), tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			prefix := `{"html":{"child":[{"head":{}},{"body":{"child":[`
+			suffix := `]}}]}}`
+			if !strings.HasPrefix(result, prefix) || !strings.HasSuffix(result, suffix) {
+				t.Fatalf("Unexpected document structure: %s", result)
+			}
+			body := strings.TrimSuffix(strings.TrimPrefix(result, prefix), suffix)
+			if body != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, body)
+			}
+		})
+	}
+}
+
+// TestHTMLtoJSONWithOptions_Indent tests custom indentation
+func TestHTMLtoJSONWithOptions_Indent(t *testing.T) {
+	result, err := HTMLtoJSONWithOptions(strings.NewReader("<p>a</p>"), Options{Indent: "\t"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(result, "{\n\t\"html\": {\n\t\t\"child\"") {
+		t.Errorf("Expected tab indentation, got %s", result)
+	}
+}
+
+// TestHTMLtoJSONWithOptions_Lossless tests lossless output of doctype, comments, processing instructions and raw text
+func TestHTMLtoJSONWithOptions_Lossless(t *testing.T) {
+	input := `<?xml version="1.0"?><!DOCTYPE html><!--[if IE]>old<![endif]--><html><head><script>if (a < b) {}</script></head><body>
+<p>Hi <b>there</b></p></body></html>`
+	expected := `[` +
+		`{"#pi":"xml version=\"1.0\""},` +
+		`{"#doctype":{"name":"html"}},` +
+		`{"#comment":"[if IE]\u003eold\u003c![endif]"},` +
+		`{"html":{"child":[` +
+		`{"head":{"child":[{"script":{"child":[{"#raw":"if (a \u003c b) {}"}]}}]}},` +
+		`{"body":{"child":["\n",{"p":{"child":["Hi ",{"b":{"child":"there"}}]}}]}}` +
+		`]}}]`
+
+	result, err := HTMLtoJSONWithOptions(strings.NewReader(input), Options{Lossless: true, Compact: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, result)
+	}
+
+	// Without lossless mode the extra nodes are dropped as before
+	defaultResult, err := HTMLtoJSONWithOptions(strings.NewReader(input), Options{Compact: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(defaultResult, "#") {
+		t.Errorf("Expected no special nodes in default output, got %s", defaultResult)
+	}
+	if !strings.Contains(defaultResult, `{"script":{"child":"if (a \u003c b) {}"}}`) {
+		t.Errorf("Expected script text as child in default output, got %s", defaultResult)
+	}
+}
+
+// TestHTMLtoJSONWithOptions_Fragment tests fragment parsing through options
+func TestHTMLtoJSONWithOptions_Fragment(t *testing.T) {
+	result, err := HTMLtoJSONWithOptions(strings.NewReader("<li>a</li><li>b</li>"), Options{
+		Fragment:        true,
+		FragmentContext: "ul",
+		Compact:         true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `[{"li":{"child":"a"}},{"li":{"child":"b"}}]`
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
 // BenchmarkHTMLtoJSON benchmarks the HTMLtoJSON function
 func BenchmarkHTMLtoJSON(b *testing.B) {
 	html := `<article id="article1">
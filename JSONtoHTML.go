@@ -0,0 +1,241 @@
+package hj
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// splitElementKey splits a key generated by generateElementKey back into tag name and ID
+func splitElementKey(key string) (string, string) {
+	if i := strings.Index(key, "#"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// documentFromValue builds a Document from decoded hj output.
+// v is either a single element map, an array of nodes or nil.
+func documentFromValue(v interface{}) (*Document, error) {
+	doc := &Document{}
+	if v == nil {
+		return doc, nil
+	}
+
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	for _, item := range items {
+		node, err := nodeFromValue(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		doc.Children = append(doc.Children, node)
+	}
+	return doc, nil
+}
+
+// nodeFromValue builds a Node from a decoded text string, special node map or element map
+func nodeFromValue(v interface{}, parent *Node) (*Node, error) {
+	switch value := v.(type) {
+	case string:
+		return &Node{Type: TextNode, Text: value, Parent: parent}, nil
+
+	case map[string]interface{}:
+		if len(value) != 1 {
+			return nil, fmt.Errorf("element must have exactly one key, got %d", len(value))
+		}
+		for key, content := range value {
+			switch key {
+			case "#comment", "#raw", "#pi":
+				text, ok := content.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s must be a string", key)
+				}
+				node := &Node{Type: CommentNode, Text: text, Parent: parent}
+				if key == "#raw" {
+					node.Type = RawTextNode
+				} else if key == "#pi" {
+					node.Type = ProcessingInstructionNode
+				}
+				return node, nil
+			case "#doctype":
+				return doctypeFromValue(content, parent)
+			}
+			return elementFromValue(key, content, parent)
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected value: %v", v)
+}
+
+// doctypeFromValue builds a DoctypeNode from its {"name", "public", "system"} object
+func doctypeFromValue(content interface{}, parent *Node) (*Node, error) {
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("#doctype must be an object")
+	}
+
+	node := &Node{Type: DoctypeNode, Parent: parent}
+	for name, value := range object {
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("#doctype field %q must be a string", name)
+		}
+		switch name {
+		case "name":
+			node.Tag = text
+		case "public", "system":
+			if node.Attributes == nil {
+				node.Attributes = make(map[string]string)
+			}
+			node.Attributes[name] = text
+		default:
+			return nil, fmt.Errorf("unexpected field %q in #doctype", name)
+		}
+	}
+	return node, nil
+}
+
+// elementFromValue builds an element Node from its key and {"attributes", "child"} object
+func elementFromValue(key string, content interface{}, parent *Node) (*Node, error) {
+	tag, id := splitElementKey(key)
+	if tag == "" {
+		return nil, fmt.Errorf("element %q has no tag name", key)
+	}
+	node := &Node{Type: ElementNode, Tag: tag, ID: id, Parent: parent}
+
+	if content == nil {
+		return node, nil
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("element %q must be an object", key)
+	}
+
+	for name, value := range object {
+		switch name {
+		case "attributes":
+			attributes, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("attributes of %q must be an object", key)
+			}
+			for attrKey, attrVal := range attributes {
+				text, ok := attrVal.(string)
+				if !ok {
+					return nil, fmt.Errorf("attribute %q of %q must be a string", attrKey, key)
+				}
+				// The id is kept in attributes when the key has no id
+				if attrKey == "id" {
+					node.ID = text
+					continue
+				}
+				if node.Attributes == nil {
+					node.Attributes = make(map[string]string)
+				}
+				node.Attributes[attrKey] = text
+			}
+
+		case "child":
+			children, ok := value.([]interface{})
+			if !ok {
+				children = []interface{}{value}
+			}
+			for _, item := range children {
+				child, err := nodeFromValue(item, node)
+				if err != nil {
+					return nil, err
+				}
+				node.Children = append(node.Children, child)
+			}
+
+		default:
+			return nil, fmt.Errorf("unexpected field %q in %q", name, key)
+		}
+	}
+
+	return node, nil
+}
+
+// UnmarshalJSON reads a document written in the hj JSON format
+func (d *Document) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	doc, err := documentFromValue(v)
+	if err != nil {
+		return err
+	}
+	*d = *doc
+	return nil
+}
+
+// toHTMLNode converts the node and its descendants to an html.Node
+func (n *Node) toHTMLNode() *html.Node {
+	switch n.Type {
+	case TextNode, RawTextNode:
+		return &html.Node{Type: html.TextNode, Data: n.Text}
+	case CommentNode:
+		return &html.Node{Type: html.CommentNode, Data: n.Text}
+	case ProcessingInstructionNode:
+		return &html.Node{Type: html.RawNode, Data: "<?" + n.Text + "?>"}
+	case DoctypeNode:
+		node := &html.Node{Type: html.DoctypeNode, Data: n.Tag}
+		for _, key := range []string{"public", "system"} {
+			if val, ok := n.Attributes[key]; ok {
+				node.Attr = append(node.Attr, html.Attribute{Key: key, Val: val})
+			}
+		}
+		return node
+	}
+
+	node := &html.Node{Type: html.ElementNode, Data: n.Tag}
+	if n.ID != "" {
+		node.Attr = append(node.Attr, html.Attribute{Key: "id", Val: n.ID})
+	}
+	keys := make([]string, 0, len(n.Attributes))
+	for key := range n.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		node.Attr = append(node.Attr, html.Attribute{Key: key, Val: n.Attributes[key]})
+	}
+	for _, c := range n.Children {
+		node.AppendChild(c.toHTMLNode())
+	}
+	return node
+}
+
+// Render writes the document as HTML to w
+func (d *Document) Render(w io.Writer) error {
+	root := &html.Node{Type: html.DocumentNode}
+	for _, c := range d.Children {
+		root.AppendChild(c.toHTMLNode())
+	}
+	if err := html.Render(w, root); err != nil {
+		return fmt.Errorf("failed to render HTML: %v", err)
+	}
+	return nil
+}
+
+// JSONtoHTML converts JSON produced by HTMLtoJSON back to HTML
+func JSONtoHTML(jsonContent string) (string, error) {
+	var doc Document
+	if err := json.Unmarshal([]byte(jsonContent), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := doc.Render(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,150 @@
+package hj
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSplitElementKey tests the splitElementKey function
+func TestSplitElementKey(t *testing.T) {
+	tests := []struct {
+		key string
+		tag string
+		id  string
+	}{
+		{"div#main", "div", "main"},
+		{"p", "p", ""},
+		{"div#a#b", "div", "a#b"},
+		{"#test", "", "test"},
+	}
+
+	for _, tt := range tests {
+		tag, id := splitElementKey(tt.key)
+		if tag != tt.tag || id != tt.id {
+			t.Errorf("splitElementKey(%q) = (%q, %q), expected (%q, %q)", tt.key, tag, id, tt.tag, tt.id)
+		}
+		if tt.tag != "" && generateElementKey(tag, id) != tt.key {
+			t.Errorf("generateElementKey(%q, %q) did not round-trip to %q", tag, id, tt.key)
+		}
+	}
+}
+
+// TestJSONtoHTML tests converting hj JSON back to HTML
+func TestJSONtoHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		expected string
+	}{
+		{
+			name:     "Element with id and attributes",
+			json:     `{"div#main": {"attributes": {"class": "box", "data-x": "1"}, "child": "Hello"}}`,
+			expected: `<div id="main" class="box" data-x="1">Hello</div>`,
+		},
+		{
+			name:     "Nested elements",
+			json:     `{"ul": {"child": [{"li": {"child": "a"}}, {"li": {"child": "b"}}]}}`,
+			expected: `<ul><li>a</li><li>b</li></ul>`,
+		},
+		{
+			name:     "Void element",
+			json:     `{"p": {"child": [{"img": {"attributes": {"src": "test.png"}}}, {"br": {}}]}}`,
+			expected: `<p><img src="test.png"/><br/></p>`,
+		},
+		{
+			name:     "Escaping",
+			json:     `{"a": {"attributes": {"title": "\"quoted\" & <b>"}, "child": "1 < 2 & 3"}}`,
+			expected: `<a title="&#34;quoted&#34; &amp; &lt;b&gt;">1 &lt; 2 &amp; 3</a>`,
+		},
+		{
+			name:     "Mixed content and comments",
+			json:     `{"p": {"child": ["Hello ", {"b": {"child": "world"}}, {"#comment": " c "}, "!"]}}`,
+			expected: `<p>Hello <b>world</b><!-- c -->!</p>`,
+		},
+		{
+			name:     "Id in attributes",
+			json:     `{"p": {"attributes": {"id": "x"}}}`,
+			expected: `<p id="x"></p>`,
+		},
+		{
+			name:     "Null",
+			json:     `null`,
+			expected: ``,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := JSONtoHTML(tt.json)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestJSONtoHTML_RoundTrip tests that HTMLtoJSON output converts back to equivalent HTML
+func TestJSONtoHTML_RoundTrip(t *testing.T) {
+	input := `<html><head><title>Title</title></head><body><div id="content" class="flex"><p>Text</p><img src="test.png"></div></body></html>`
+
+	jsonOutput, err := HTMLtoJSON(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := JSONtoHTML(jsonOutput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Replace(input, `<img src="test.png">`, `<img src="test.png"/>`, 1)
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+// TestJSONtoHTML_LosslessRoundTrip tests that lossless output converts back to the same HTML
+func TestJSONtoHTML_LosslessRoundTrip(t *testing.T) {
+	input := `<?xml version="1.0"?><!DOCTYPE html><!-- top --><html lang="en"><head><script>if (a < b && c) {}</script></head><body>
+  <p>Hello <b>world</b>!</p>
+</body></html>`
+
+	jsonOutput, err := HTMLtoJSONWithOptions(strings.NewReader(input), Options{Lossless: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := JSONtoHTML(jsonOutput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result != input {
+		t.Errorf("Expected\n%s\ngot\n%s", input, result)
+	}
+}
+
+// TestJSONtoHTML_Errors tests invalid input
+func TestJSONtoHTML_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"Invalid JSON", `{"div":`},
+		{"Multiple keys", `{"div": {}, "p": {}}`},
+		{"Number child", `{"div": {"child": 1}}`},
+		{"Unknown field", `{"div": {"children": []}}`},
+		{"Attribute not string", `{"div": {"attributes": {"a": 1}}}`},
+		{"Void element with child", `{"img": {"child": "text"}}`},
+		{"Comment not string", `{"#comment": {}}`},
+		{"Doctype not object", `{"#doctype": "html"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := JSONtoHTML(tt.json); err == nil {
+				t.Errorf("Expected error for %s", tt.json)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package hj
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Link is a reference from an element of a document to another resource
+type Link struct {
+	// URL is the reference resolved against the base URL of the document
+	URL string `json:"url"`
+	// Tag and Attribute name the element and attribute the reference was found in
+	Tag       string `json:"tag"`
+	Attribute string `json:"attribute"`
+	Rel       string `json:"rel,omitempty"`
+	// Text is the text of a link, or the alt text of an image or area
+	Text string `json:"text,omitempty"`
+	// Path is the path of the element as in Flatten
+	Path string `json:"path"`
+}
+
+// linkAttributes lists the attributes holding URLs by element
+var linkAttributes = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"img":    {"src", "srcset"},
+	"source": {"src", "srcset"},
+	"script": {"src"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"embed":  {"src"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"track":  {"src"},
+	"object": {"data"},
+	"form":   {"action"},
+	"button": {"formaction"},
+	"input":  {"src", "formaction"},
+}
+
+// cssURLPattern matches url() in CSS
+var cssURLPattern = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)"'\s]*))\s*\)`)
+
+// ExtractLinks returns every reference to another resource in the document,
+// in document order: links, images and their srcset candidates, scripts,
+// stylesheets, frames, media, form actions and url() in style attributes.
+// URLs are resolved against the base URL of the document.
+func ExtractLinks(doc *Document) []*Link {
+	base := doc.BaseURL()
+	paths := newElementPaths(doc)
+	links := []*Link{}
+
+	walkElements(doc.Children, func(n *Node) {
+		add := func(attribute, ref string) {
+			if strings.Trim(ref, whitespaceChars) == "" {
+				return
+			}
+			link := &Link{
+				URL:       resolveURL(base, ref),
+				Tag:       n.Tag,
+				Attribute: attribute,
+				Rel:       n.Attributes["rel"],
+				Path:      paths.path(n),
+			}
+			switch n.Tag {
+			case "a":
+				link.Text = strings.Join(strings.Fields(textContent(n)), " ")
+			case "img", "area":
+				link.Text = n.Attributes["alt"]
+			}
+			links = append(links, link)
+		}
+
+		for _, attribute := range linkAttributes[n.Tag] {
+			value, ok := n.Attributes[attribute]
+			if !ok {
+				continue
+			}
+			if attribute == "srcset" {
+				for _, candidate := range parseSrcset(value) {
+					add(attribute, candidate)
+				}
+				continue
+			}
+			add(attribute, value)
+		}
+		if style, ok := n.Attributes["style"]; ok {
+			for _, ref := range cssURLs(style) {
+				add("style", ref)
+			}
+		}
+	})
+	return links
+}
+
+// LinksToJSON writes links as JSON
+func LinksToJSON(links []*Link, opts Options) ([]byte, error) {
+	if links == nil {
+		links = []*Link{}
+	}
+	return marshalJSON(links, opts)
+}
+
+// parseSrcset returns the URLs of the image candidates in a srcset attribute
+func parseSrcset(srcset string) []string {
+	var urls []string
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, whitespaceChars+",")
+		if s == "" {
+			return urls
+		}
+
+		end := strings.IndexAny(s, whitespaceChars)
+		if end < 0 {
+			end = len(s)
+		}
+		url := s[:end]
+		s = s[end:]
+
+		// A URL ending with a comma has no descriptors
+		if trimmed := strings.TrimRight(url, ","); trimmed != url {
+			urls = append(urls, trimmed)
+			continue
+		}
+		urls = append(urls, url)
+
+		// Skip the descriptors up to the next comma outside parentheses
+		depth := 0
+		i := 0
+		for ; i < len(s); i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				if depth > 0 {
+					depth--
+				}
+			}
+			if s[i] == ',' && depth == 0 {
+				break
+			}
+		}
+		s = s[i:]
+	}
+}
+
+// cssURLs returns the URLs of url() functions in CSS
+func cssURLs(css string) []string {
+	var urls []string
+	for _, m := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		urls = append(urls, m[1]+m[2]+m[3])
+	}
+	return urls
+}
@@ -0,0 +1,83 @@
+package hj
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExtractLinks tests listing the references of a document
+func TestExtractLinks(t *testing.T) {
+	input := `<base href="https://cdn.example.com/s/"><link rel="stylesheet" href="main.css"><script src="/app.js"></script>
+<a href="../x?y=1#z" rel="nofollow"> Go  <b>there</b></a><a href="">self</a><a>none</a>
+<img src="a.png" alt="A" srcset="a-1x.png 1x, data:image/png;base64,AA==, b.png 2x">
+<div style="background: URL( &quot;bg.png&quot; ); mask: url(m.svg#a)"></div>
+<form action="/post"><button formaction="/other">x</button></form><iframe src="//video.example.net/e"></iframe>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []*Link{
+		{URL: "https://cdn.example.com/s/main.css", Tag: "link", Attribute: "href", Rel: "stylesheet", Path: "/html/head/link"},
+		{URL: "https://cdn.example.com/app.js", Tag: "script", Attribute: "src", Path: "/html/head/script"},
+		{URL: "https://cdn.example.com/x?y=1#z", Tag: "a", Attribute: "href", Rel: "nofollow", Text: "Go there", Path: "/html/body/a[1]"},
+		{URL: "https://cdn.example.com/s/a.png", Tag: "img", Attribute: "src", Text: "A", Path: "/html/body/img"},
+		{URL: "https://cdn.example.com/s/a-1x.png", Tag: "img", Attribute: "srcset", Text: "A", Path: "/html/body/img"},
+		{URL: "data:image/png;base64,AA==", Tag: "img", Attribute: "srcset", Text: "A", Path: "/html/body/img"},
+		{URL: "https://cdn.example.com/s/b.png", Tag: "img", Attribute: "srcset", Text: "A", Path: "/html/body/img"},
+		{URL: "https://cdn.example.com/s/bg.png", Tag: "div", Attribute: "style", Path: "/html/body/div"},
+		{URL: "https://cdn.example.com/s/m.svg#a", Tag: "div", Attribute: "style", Path: "/html/body/div"},
+		{URL: "https://cdn.example.com/post", Tag: "form", Attribute: "action", Path: "/html/body/form"},
+		{URL: "https://cdn.example.com/other", Tag: "button", Attribute: "formaction", Path: "/html/body/form/button"},
+		{URL: "https://video.example.net/e", Tag: "iframe", Attribute: "src", Path: "/html/body/iframe"},
+	}
+
+	links := ExtractLinks(doc)
+	if len(links) != len(expected) {
+		data, _ := LinksToJSON(links, Options{})
+		t.Fatalf("Expected %d links, got %d: %s", len(expected), len(links), data)
+	}
+	for i, link := range links {
+		if !reflect.DeepEqual(link, expected[i]) {
+			t.Errorf("Link %d: expected %+v, got %+v", i, expected[i], link)
+		}
+	}
+}
+
+// TestExtractLinks_NoBaseURL tests that URLs are kept as written without a base URL
+func TestExtractLinks_NoBaseURL(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<a href=" docs/index.html ">Docs</a>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc.Metadata = &Metadata{Source: "index.html"}
+
+	links := ExtractLinks(doc)
+	if len(links) != 1 || links[0].URL != "docs/index.html" {
+		t.Errorf("Unexpected links: %+v", links)
+	}
+}
+
+// TestParseSrcset tests reading the URLs of image candidates
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset   string
+		expected []string
+	}{
+		{srcset: "a.png", expected: []string{"a.png"}},
+		{srcset: " a.png 1x , b.png 2x ", expected: []string{"a.png", "b.png"}},
+		{srcset: "a.png,b.png", expected: []string{"a.png,b.png"}},
+		{srcset: "a.png, b.png,", expected: []string{"a.png", "b.png"}},
+		{srcset: "a.png 100w (x, y), b.png", expected: []string{"a.png", "b.png"}},
+		{srcset: "data:image/gif;base64,R0lG, c.png 2x", expected: []string{"data:image/gif;base64,R0lG", "c.png"}},
+		{srcset: " , ", expected: nil},
+	}
+
+	for _, tt := range tests {
+		if result := parseSrcset(tt.srcset); !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("parseSrcset(%q) = %q, expected %q", tt.srcset, result, tt.expected)
+		}
+	}
+}
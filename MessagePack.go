@@ -0,0 +1,294 @@
+package hj
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MessagePackEncoder writes MessagePack. Integers use the shortest encoding
+// and other numbers are written as float 64.
+type MessagePackEncoder struct{}
+
+// Encode writes v as a single MessagePack object
+func (e MessagePackEncoder) Encode(w io.Writer, v interface{}) error {
+	var b bytes.Buffer
+	if err := writeMessagePack(&b, v); err != nil {
+		return fmt.Errorf("failed to convert to MessagePack: %v", err)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeMessagePackHead writes the type byte and length of a string, array or map.
+// fix holds the type byte of the fix format with room for lengths below fixMax,
+// and wide the type bytes of the 8, 16 and 32 bit formats, 0 where there is none.
+func writeMessagePackHead(b *bytes.Buffer, n int, fix byte, fixMax int, wide [3]byte) error {
+	switch {
+	case n < fixMax:
+		b.WriteByte(fix | byte(n))
+	case n <= math.MaxUint8 && wide[0] != 0:
+		b.Write([]byte{wide[0], byte(n)})
+	case n <= math.MaxUint16:
+		b.Write(binary.BigEndian.AppendUint16([]byte{wide[1]}, uint16(n)))
+	case uint64(n) <= math.MaxUint32:
+		b.Write(binary.BigEndian.AppendUint32([]byte{wide[2]}, uint32(n)))
+	default:
+		return fmt.Errorf("length %d is too large", n)
+	}
+	return nil
+}
+
+// writeMessagePackInt writes an integer in its shortest format
+func writeMessagePackInt(b *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= math.MaxInt8:
+		b.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		b.Write([]byte{0xcc, byte(n)})
+	case n >= 0 && n <= math.MaxUint16:
+		b.Write(binary.BigEndian.AppendUint16([]byte{0xcd}, uint16(n)))
+	case n >= 0 && n <= math.MaxUint32:
+		b.Write(binary.BigEndian.AppendUint32([]byte{0xce}, uint32(n)))
+	case n >= 0:
+		b.Write(binary.BigEndian.AppendUint64([]byte{0xcf}, uint64(n)))
+	case n >= -32:
+		b.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		b.Write([]byte{0xd0, byte(n)})
+	case n >= math.MinInt16:
+		b.Write(binary.BigEndian.AppendUint16([]byte{0xd1}, uint16(n)))
+	case n >= math.MinInt32:
+		b.Write(binary.BigEndian.AppendUint32([]byte{0xd2}, uint32(n)))
+	default:
+		b.Write(binary.BigEndian.AppendUint64([]byte{0xd3}, uint64(n)))
+	}
+}
+
+// writeMessagePack writes v and its members
+func writeMessagePack(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case bool:
+		if v {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case json.Number:
+		n, err := parseNumber(v)
+		if err != nil {
+			return err
+		}
+		switch n := n.(type) {
+		case int64:
+			writeMessagePackInt(b, n)
+		case uint64:
+			b.Write(binary.BigEndian.AppendUint64([]byte{0xcf}, n))
+		case float64:
+			b.Write(binary.BigEndian.AppendUint64([]byte{0xcb}, math.Float64bits(n)))
+		}
+	case string:
+		if err := writeMessagePackHead(b, len(v), 0xa0, 32, [3]byte{0xd9, 0xda, 0xdb}); err != nil {
+			return err
+		}
+		b.WriteString(v)
+	case []interface{}:
+		if err := writeMessagePackHead(b, len(v), 0x90, 16, [3]byte{0, 0xdc, 0xdd}); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := writeMessagePack(b, item); err != nil {
+				return err
+			}
+		}
+	case Object:
+		if err := writeMessagePackHead(b, len(v), 0x80, 16, [3]byte{0, 0xde, 0xdf}); err != nil {
+			return err
+		}
+		for _, f := range v {
+			if err := writeMessagePack(b, f.Key); err != nil {
+				return err
+			}
+			if err := writeMessagePack(b, f.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported value of type %T", v)
+	}
+	return nil
+}
+
+// MessagePackDecoder reads MessagePack. Binary data is read as strings;
+// extension types are not supported.
+type MessagePackDecoder struct{}
+
+// Decode reads a single MessagePack object from r
+func (d MessagePackDecoder) Decode(r io.Reader) (interface{}, error) {
+	br := bufio.NewReader(r)
+	v, err := readMessagePack(br, 0)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MessagePack: %v", err)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("failed to parse MessagePack: unexpected data after the value")
+	}
+	return v, nil
+}
+
+// readMessagePackUint reads a big-endian unsigned integer of size bytes
+func readMessagePackUint(r io.Reader, size uint64) (uint64, error) {
+	data, err := readBytes(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range data {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// readMessagePack reads an object nested in depth arrays and maps
+func readMessagePack(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, fmt.Errorf("nesting is too deep")
+	}
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t <= 0x7f:
+		return json.Number(strconv.Itoa(int(t))), nil
+	case t >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(t)))), nil
+	case t >= 0xa0 && t <= 0xbf:
+		return readMessagePackString(r, uint64(t&0x1f), true)
+	case t >= 0x90 && t <= 0x9f:
+		return readMessagePackArray(r, uint64(t&0x0f), depth)
+	case t >= 0x80 && t <= 0x8f:
+		return readMessagePackMap(r, uint64(t&0x0f), depth)
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readMessagePackUint(r, 1<<(t-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := uint64(1) << (t - 0xd0)
+		n, err := readMessagePackUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the size of the integer
+		shift := 64 - 8*size
+		return json.Number(strconv.FormatInt(int64(n<<shift)>>shift, 10)), nil
+	case 0xca:
+		n, err := readMessagePackUint(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		return numberValue(float64(math.Float32frombits(uint32(n)))), nil
+	case 0xcb:
+		n, err := readMessagePackUint(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return numberValue(math.Float64frombits(n)), nil
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		// str 8/16/32 and bin 8/16/32
+		text := t >= 0xd9
+		size := uint64(1) << (t - 0xc4)
+		if text {
+			size = uint64(1) << (t - 0xd9)
+		}
+		n, err := readMessagePackUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return readMessagePackString(r, n, text)
+	case 0xdc, 0xdd:
+		n, err := readMessagePackUint(r, 2<<(t-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMessagePackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := readMessagePackUint(r, 2<<(t-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMessagePackMap(r, n, depth)
+	case 0xc7, 0xc8, 0xc9, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return nil, fmt.Errorf("extension types are not supported")
+	}
+	return nil, fmt.Errorf("invalid type byte 0x%02x", t)
+}
+
+// readMessagePackString reads a str or bin of n bytes
+func readMessagePackString(r io.Reader, n uint64, text bool) (interface{}, error) {
+	data, err := readBytes(r, n)
+	if err != nil {
+		return nil, err
+	}
+	if text && !utf8.Valid(data) {
+		return nil, fmt.Errorf("invalid UTF-8 in string")
+	}
+	return string(data), nil
+}
+
+// readMessagePackArray reads the n items of an array
+func readMessagePackArray(r *bufio.Reader, n uint64, depth int) (interface{}, error) {
+	list := make([]interface{}, 0, min(n, 1024))
+	for ; n > 0; n-- {
+		item, err := readMessagePack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// readMessagePackMap reads the n keys and values of a map
+func readMessagePackMap(r *bufio.Reader, n uint64, depth int) (interface{}, error) {
+	obj := make(Object, 0, min(n, 1024))
+	for ; n > 0; n-- {
+		key, err := readMessagePack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string, got %v", key)
+		}
+		value, err := readMessagePack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, Field{Key: name, Value: value})
+	}
+	return obj, nil
+}
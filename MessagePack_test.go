@@ -0,0 +1,123 @@
+package hj
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestMessagePackEncoder tests encoding in the shortest formats
+func TestMessagePackEncoder(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected string
+	}{
+		{json: `null`, expected: "c0"},
+		{json: `false`, expected: "c2"},
+		{json: `true`, expected: "c3"},
+		{json: `127`, expected: "7f"},
+		{json: `128`, expected: "cc80"},
+		{json: `256`, expected: "cd0100"},
+		{json: `65536`, expected: "ce00010000"},
+		{json: `4294967296`, expected: "cf0000000100000000"},
+		{json: `18446744073709551615`, expected: "cfffffffffffffffff"},
+		{json: `-1`, expected: "ff"},
+		{json: `-32`, expected: "e0"},
+		{json: `-33`, expected: "d0df"},
+		{json: `-129`, expected: "d1ff7f"},
+		{json: `-32769`, expected: "d2ffff7fff"},
+		{json: `-2147483649`, expected: "d3ffffffff7fffffff"},
+		{json: `1.5`, expected: "cb3ff8000000000000"},
+		{json: `"a"`, expected: "a161"},
+		{json: `"` + strings.Repeat("a", 32) + `"`, expected: "d920" + strings.Repeat("61", 32)},
+		{json: `"` + strings.Repeat("a", 256) + `"`, expected: "da0100" + strings.Repeat("61", 256)},
+		{json: `[]`, expected: "90"},
+		{json: `[1,2]`, expected: "920102"},
+		{json: `[` + strings.Repeat("0,", 15) + `0]`, expected: "dc0010" + strings.Repeat("00", 16)},
+		{json: `{"p":{"child":"text"}}`, expected: "81a17081a56368696c64a474657874"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Transcode(&buf, []byte(tt.json), MessagePackEncoder{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := hex.EncodeToString(buf.Bytes()); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestMessagePackDecoder tests decoding each format family
+func TestMessagePackDecoder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "7f", expected: `127`},
+		{input: "e0", expected: `-32`},
+		{input: "cc80", expected: `128`},
+		{input: "cfffffffffffffffff", expected: `18446744073709551615`},
+		{input: "d0df", expected: `-33`},
+		{input: "d1ff7f", expected: `-129`},
+		{input: "d3ffffffff7fffffff", expected: `-2147483649`},
+		{input: "ca3fc00000", expected: `1.5`},
+		{input: "cb7ff8000000000000", expected: `"NaN"`},
+		{input: "a0", expected: `""`},
+		{input: "d90161", expected: `"a"`},
+		{input: "db0000000161", expected: `"a"`},
+		{input: "c40161", expected: `"a"`},
+		{input: "dc0002c0c3", expected: `[null,true]`},
+		{input: "dd00000000", expected: `[]`},
+		{input: "82a162c2a161c3", expected: `{"b":false,"a":true}`},
+		{input: "de0001a16190", expected: `{"a":[]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			v, err := MessagePackDecoder{}.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := (JSONEncoder{Compact: true}).Encode(&buf, v); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := strings.TrimSuffix(buf.String(), "\n"); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestMessagePackDecoder_Errors tests decoding invalid MessagePack
+func TestMessagePackDecoder_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Empty", input: ""},
+		{name: "Truncated", input: "920102"[:4]},
+		{name: "Truncated length", input: "dc00"},
+		{name: "Trailing data", input: "0101"},
+		{name: "Integer key", input: "810102"},
+		{name: "Invalid UTF-8", input: "a1ff"},
+		{name: "Never used", input: "c1"},
+		{name: "Extension", input: "d40100"},
+		{name: "Large length", input: "dbffffffff61"},
+		{name: "Too deep", input: strings.Repeat("91", maxDecodeDepth+2) + "00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.input)
+			if _, err := (MessagePackDecoder{}).Decode(bytes.NewReader(data)); err == nil {
+				t.Errorf("Expected error for %s", tt.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package hj
+
+import (
+	"mime"
+	"strings"
+)
+
+// PageMeta summarises the metadata in the head of a document
+type PageMeta struct {
+	Title       string   `json:"title,omitempty"`
+	Canonical   string   `json:"canonical,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Charset     string   `json:"charset,omitempty"`
+	Robots      []string `json:"robots,omitempty"`
+	// OpenGraph and Twitter hold the OpenGraph and Twitter card properties in
+	// document order. Properties given more than once have an array of values.
+	OpenGraph  Object           `json:"openGraph,omitempty"`
+	Twitter    Object           `json:"twitter,omitempty"`
+	Icons      []*PageIcon      `json:"icons,omitempty"`
+	Alternates []*PageAlternate `json:"alternates,omitempty"`
+}
+
+// PageIcon is a favicon or other icon of a page
+type PageIcon struct {
+	URL   string `json:"url"`
+	Rel   string `json:"rel"`
+	Sizes string `json:"sizes,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// PageAlternate is an alternate version of a page, such as a translation or a feed
+type PageAlternate struct {
+	URL      string `json:"url"`
+	Hreflang string `json:"hreflang,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// openGraphPrefixes lists the prefixes of OpenGraph properties, including
+// those of the OpenGraph object types
+var openGraphPrefixes = []string{"og:", "article:", "book:", "profile:", "music:", "video:"}
+
+// ExtractPageMeta reads the title, meta elements and link elements in the
+// head of a document, or in the whole document when it has no head, such as
+// a fragment. Elements inside svg and math are not HTML metadata and are
+// skipped. URLs are resolved against the base URL of the document, and the
+// charset falls back to the encoding in Document.Metadata.
+func ExtractPageMeta(doc *Document) *PageMeta {
+	base := doc.BaseURL()
+	meta := &PageMeta{}
+	var contentLanguage string
+
+	if root := doc.Root(); root != nil && root.Tag == "html" {
+		meta.Language = strings.Trim(root.Attributes["lang"], whitespaceChars)
+	}
+
+	walkHTMLElements(headChildren(doc), func(n *Node) {
+		switch n.Tag {
+		case "title":
+			if meta.Title == "" {
+				meta.Title = strings.Join(strings.Fields(textContent(n)), " ")
+			}
+
+		case "meta":
+			content := strings.Trim(n.Attributes["content"], whitespaceChars)
+			if charset, ok := n.Attributes["charset"]; ok && meta.Charset == "" {
+				meta.Charset = strings.ToLower(strings.Trim(charset, whitespaceChars))
+			}
+
+			switch strings.ToLower(n.Attributes["http-equiv"]) {
+			case "content-type":
+				if _, params, err := mime.ParseMediaType(content); err == nil && meta.Charset == "" {
+					meta.Charset = strings.ToLower(params["charset"])
+				}
+			case "content-language":
+				if contentLanguage == "" {
+					contentLanguage = content
+				}
+			}
+
+			// OpenGraph uses property and Twitter uses name, but both are found either way
+			property := n.Attributes["property"]
+			if property == "" {
+				property = n.Attributes["name"]
+			}
+			property = strings.ToLower(strings.Trim(property, whitespaceChars))
+			switch {
+			case property == "description":
+				if meta.Description == "" {
+					meta.Description = content
+				}
+			case property == "keywords":
+				if meta.Keywords == nil {
+					meta.Keywords = splitList(content, ",")
+				}
+			case property == "robots":
+				meta.Robots = append(meta.Robots, splitList(strings.ToLower(content), ",")...)
+			case strings.HasPrefix(property, "twitter:"):
+				meta.Twitter = addProperty(meta.Twitter, property, content)
+			case hasAnyPrefix(property, openGraphPrefixes):
+				meta.OpenGraph = addProperty(meta.OpenGraph, property, content)
+			}
+
+		case "link":
+			href, ok := n.Attributes["href"]
+			if !ok {
+				return
+			}
+			rels := strings.Fields(strings.ToLower(n.Attributes["rel"]))
+			switch {
+			case indexOfString(rels, "canonical") >= 0:
+				if meta.Canonical == "" {
+					meta.Canonical = resolveURL(base, href)
+				}
+			case indexOfString(rels, "alternate") >= 0:
+				meta.Alternates = append(meta.Alternates, &PageAlternate{
+					URL:      resolveURL(base, href),
+					Hreflang: n.Attributes["hreflang"],
+					Type:     n.Attributes["type"],
+					Title:    n.Attributes["title"],
+				})
+			case iconRel(rels):
+				meta.Icons = append(meta.Icons, &PageIcon{
+					URL:   resolveURL(base, href),
+					Rel:   strings.Join(rels, " "),
+					Sizes: n.Attributes["sizes"],
+					Type:  n.Attributes["type"],
+				})
+			}
+		}
+	})
+
+	if meta.Language == "" {
+		meta.Language = contentLanguage
+	}
+	if meta.Charset == "" && doc.Metadata != nil {
+		meta.Charset = doc.Metadata.Encoding
+	}
+	return meta
+}
+
+// headChildren returns the children of the head element of doc, or the
+// top-level nodes when there is no head
+func headChildren(doc *Document) []*Node {
+	if root := doc.Root(); root != nil && root.Tag == "html" {
+		for _, c := range root.Children {
+			if c.Type == ElementNode && c.Tag == "head" {
+				return c.Children
+			}
+		}
+	}
+	return doc.Children
+}
+
+// walkHTMLElements calls fn for the elements in nodes and their descendants
+// in document order, leaving out svg and math elements and their content
+func walkHTMLElements(nodes []*Node, fn func(*Node)) {
+	for _, n := range nodes {
+		if n.Type == ElementNode && n.Tag != "svg" && n.Tag != "math" {
+			fn(n)
+			walkHTMLElements(n.Children, fn)
+		}
+	}
+}
+
+// PageMetaToJSON writes page metadata as JSON
+func PageMetaToJSON(meta *PageMeta, opts Options) ([]byte, error) {
+	return marshalJSON(meta, opts)
+}
+
+// iconRel reports whether link relations name an icon, such as "icon",
+// "shortcut icon", "apple-touch-icon" or "mask-icon"
+func iconRel(rels []string) bool {
+	for _, rel := range rels {
+		if rel == "icon" || strings.HasSuffix(rel, "-icon") || strings.HasPrefix(rel, "apple-touch-icon") {
+			return true
+		}
+	}
+	return false
+}
+
+// addProperty adds a property to obj, turning the value into an array when
+// the property is already there
+func addProperty(obj Object, key, value string) Object {
+	for i, f := range obj {
+		if f.Key != key {
+			continue
+		}
+		switch v := f.Value.(type) {
+		case string:
+			obj[i].Value = []string{v, value}
+		case []string:
+			obj[i].Value = append(v, value)
+		}
+		return obj
+	}
+	return append(obj, Field{Key: key, Value: value})
+}
+
+// splitList splits a list such as "noindex, nofollow", dropping empty items
+func splitList(s, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.Trim(item, whitespaceChars); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// hasAnyPrefix reports whether s begins with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
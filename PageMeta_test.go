@@ -0,0 +1,126 @@
+package hj
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExtractPageMeta tests summarising the head of a document
+func TestExtractPageMeta(t *testing.T) {
+	input := `<html lang="ja"><head>
+<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS">
+<title>  My
+ Page </title>
+<meta name="description" content=" About the page ">
+<meta name="keywords" content="a, b,,c">
+<meta name="robots" content="NoIndex, nofollow">
+<link rel="canonical" href="/canonical">
+<meta property="og:title" content="OG title">
+<meta property="og:image" content="1.png"><meta property="og:image" content="2.png"><meta property="og:image" content="3.png">
+<meta property="article:author" content="Author">
+<meta name="twitter:card" content="summary">
+<link rel="shortcut icon" href="/favicon.ico" sizes="16x16" type="image/x-icon">
+<link rel="apple-touch-icon" href="touch.png">
+<link rel="alternate" hreflang="en" href="/en/">
+<link rel="alternate" type="application/rss+xml" title="Feed" href="feed.xml">
+<link rel="stylesheet" href="main.css">
+</head><body><svg><title>Icon</title></svg></body></html>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc.Metadata = &Metadata{Source: "https://example.com/a/page.html", Encoding: "utf-8"}
+
+	expected := &PageMeta{
+		Title:       "My Page",
+		Canonical:   "https://example.com/canonical",
+		Description: "About the page",
+		Keywords:    []string{"a", "b", "c"},
+		Language:    "ja",
+		Charset:     "shift_jis",
+		Robots:      []string{"noindex", "nofollow"},
+		OpenGraph: Object{
+			{Key: "og:title", Value: "OG title"},
+			{Key: "og:image", Value: []string{"1.png", "2.png", "3.png"}},
+			{Key: "article:author", Value: "Author"},
+		},
+		Twitter: Object{{Key: "twitter:card", Value: "summary"}},
+		Icons: []*PageIcon{
+			{URL: "https://example.com/favicon.ico", Rel: "shortcut icon", Sizes: "16x16", Type: "image/x-icon"},
+			{URL: "https://example.com/a/touch.png", Rel: "apple-touch-icon"},
+		},
+		Alternates: []*PageAlternate{
+			{URL: "https://example.com/en/", Hreflang: "en"},
+			{URL: "https://example.com/a/feed.xml", Type: "application/rss+xml", Title: "Feed"},
+		},
+	}
+
+	meta := ExtractPageMeta(doc)
+	if !reflect.DeepEqual(meta, expected) {
+		data, _ := PageMetaToJSON(meta, Options{})
+		t.Errorf("Unexpected page metadata:\n%s", data)
+	}
+}
+
+// TestExtractPageMeta_Fallbacks tests the language and charset given outside the html element
+func TestExtractPageMeta_Fallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		metadata *Metadata
+		expected string
+	}{
+		{
+			name:     "Empty",
+			html:     "",
+			expected: `{}`,
+		},
+		{
+			name:     "Content-Language and meta charset",
+			html:     `<meta charset=" EUC-JP "><meta http-equiv="content-language" content="de">`,
+			expected: `{"language":"de","charset":"euc-jp"}`,
+		},
+		{
+			name:     "Detected encoding",
+			html:     `<title>T</title>`,
+			metadata: &Metadata{Source: "index.html", Encoding: "windows-1252"},
+			expected: `{"title":"T","charset":"windows-1252"}`,
+		},
+		{
+			name:     "Title of an svg and Microdata in the body",
+			html:     `<html><head></head><body><svg><title>Icon</title></svg><div itemscope><meta itemprop="description" content="Item"><link itemprop="url" rel="canonical" href="/item"></div></body></html>`,
+			expected: `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc.Metadata = tt.metadata
+
+			data, err := PageMetaToJSON(ExtractPageMeta(doc), Options{Compact: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, data)
+			}
+		})
+	}
+}
+
+// TestExtractPageMeta_Fragment tests a document without a head
+func TestExtractPageMeta_Fragment(t *testing.T) {
+	doc, err := ParseFragment(strings.NewReader(`<svg><title>Icon</title></svg><title>Page</title>`), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if title := ExtractPageMeta(doc).Title; title != "Page" {
+		t.Errorf("Expected the title outside the svg, got %q", title)
+	}
+}
@@ -0,0 +1,149 @@
+package hj
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots holds the rules of a robots.txt file that apply to one crawler
+type Robots struct {
+	rules []robotsRule
+	// CrawlDelay is the wait between requests asked for by the Crawl-delay line
+	CrawlDelay time.Duration
+}
+
+// robotsRule is an Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsGroup is a group of lines for one or more user agents
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// ParseRobots reads a robots.txt file as in RFC 9309 and returns the rules of
+// the group for userAgent, or of the group for all crawlers ("*") when no
+// group names it. The user agent is matched by its product token, the part
+// before the first "/" or space, such as "hj" for DefaultUserAgent.
+func ParseRobots(r io.Reader, userAgent string) (*Robots, error) {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var groups []*robotsGroup
+	var group *robotsGroup
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines start a single group
+			if group == nil || len(group.rules) > 0 || group.crawlDelay > 0 {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if group != nil && value != "" {
+				group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); group != nil && err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The groups naming the crawler are combined, and the "*" groups are
+	// used only when there are none
+	robots := &Robots{}
+	for _, name := range []string{token, "*"} {
+		matched := false
+		for _, g := range groups {
+			if slices.Contains(g.agents, name) {
+				matched = true
+				robots.rules = append(robots.rules, g.rules...)
+				robots.CrawlDelay = max(robots.CrawlDelay, g.crawlDelay)
+			}
+		}
+		if matched {
+			break
+		}
+	}
+	return robots, nil
+}
+
+// Allowed reports whether a path, with its query if any, may be fetched.
+// The longest matching rule decides, and Allow wins when an Allow and a
+// Disallow rule are equally long. A nil Robots allows everything.
+func (r *Robots) Allowed(path string) bool {
+	if r == nil || path == "/robots.txt" {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	allowed, length := true, -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > length || (len(rule.pattern) == length && rule.allow) {
+			allowed, length = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// matchRobotsPattern reports whether a path starts with a robots.txt
+// pattern, where "*" matches any characters and a final "$" matches the
+// end of the path
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+
+	// Taking the first match of each part leaves the most for the ones after it
+	for _, part := range parts[1 : len(parts)-1] {
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
@@ -0,0 +1,104 @@
+package hj
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseRobots tests choosing the group of a crawler and matching paths
+func TestParseRobots(t *testing.T) {
+	robotsTxt := `# Example
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Disallow: /search*q=
+Crawl-delay: 2
+
+User-agent: OtherBot
+User-agent: hj
+Disallow: /
+Allow: /docs/
+Crawl-delay: 0.5
+
+User-agent: Blocked
+Disallow:
+`
+
+	tests := []struct {
+		name      string
+		userAgent string
+		delay     time.Duration
+		allowed   []string
+		denied    []string
+	}{
+		{
+			name:      "Group for all crawlers",
+			userAgent: "somebot/1.0",
+			delay:     2 * time.Second,
+			allowed:   []string{"/", "/index.html", "/private/public.html", "/file.pdf?x=1", "/search?page=2", "/robots.txt"},
+			denied:    []string{"/private/", "/private/a.html", "/file.pdf", "/a/b.pdf", "/search?x=1&q=go"},
+		},
+		{
+			name:      "Group naming the crawler",
+			userAgent: DefaultUserAgent,
+			delay:     500 * time.Millisecond,
+			allowed:   []string{"/docs/", "/docs/a.html", "/robots.txt"},
+			denied:    []string{"/", "/private/public.html", "/doc"},
+		},
+		{
+			name:      "Group without rules",
+			userAgent: "Blocked",
+			allowed:   []string{"/", "/private/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			robots, err := ParseRobots(strings.NewReader(robotsTxt), tt.userAgent)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if robots.CrawlDelay != tt.delay {
+				t.Errorf("Expected crawl delay %v, got %v", tt.delay, robots.CrawlDelay)
+			}
+			for _, path := range tt.allowed {
+				if !robots.Allowed(path) {
+					t.Errorf("Expected %s to be allowed", path)
+				}
+			}
+			for _, path := range tt.denied {
+				if robots.Allowed(path) {
+					t.Errorf("Expected %s to be disallowed", path)
+				}
+			}
+		})
+	}
+}
+
+// TestMatchRobotsPattern tests the wildcards of robots.txt patterns
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/folder/any.php?x", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"*", "/anything", true},
+	}
+
+	for _, tt := range tests {
+		if result := matchRobotsPattern(tt.pattern, tt.path); result != tt.expected {
+			t.Errorf("matchRobotsPattern(%q, %q) = %v, expected %v", tt.pattern, tt.path, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package hj
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selector is a compiled CSS selector list such as "div#content > p.lead, ul li"
+type Selector []complexSelector
+
+// complexSelector is a chain of compound selectors joined by combinators.
+// combinators[i] joins compounds[i] and compounds[i+1].
+type complexSelector struct {
+	compounds   []compoundSelector
+	combinators []byte
+}
+
+// compoundSelector is a sequence of simple selectors that all apply to one element
+type compoundSelector struct {
+	tag        string // empty for the universal selector
+	id         string
+	classes    []string
+	attributes []attributeSelector
+	nth        []nthSelector
+}
+
+// attributeSelector matches an attribute such as [href^="https:"]
+type attributeSelector struct {
+	name     string
+	operator string // empty when only the presence of the attribute is tested
+	value    string
+}
+
+// nthSelector matches elements at position a*n+b among their element siblings
+type nthSelector struct {
+	a, b     int
+	fromLast bool
+}
+
+// CompileSelector parses a CSS selector list.
+// It supports type, universal, id, class and attribute selectors, the
+// descendant, child (>), next sibling (+) and subsequent sibling (~)
+// combinators, and the :nth-child, :nth-last-child, :first-child,
+// :last-child and :only-child pseudo-classes.
+func CompileSelector(selector string) (Selector, error) {
+	p := &selectorParser{s: selector}
+	var list Selector
+	for {
+		complex, err := p.parseComplex()
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		list = append(list, complex)
+
+		p.skipSpace()
+		if p.eof() {
+			return list, nil
+		}
+		if p.s[p.pos] != ',' {
+			return nil, fmt.Errorf("invalid selector %q: unexpected %q", selector, p.s[p.pos])
+		}
+		p.pos++
+	}
+}
+
+// Select returns the elements of doc matching the CSS selector in document order.
+// See CompileSelector for the supported syntax.
+func Select(doc *Document, selector string) ([]*Node, error) {
+	sel, err := CompileSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Select(doc), nil
+}
+
+// Select returns the elements of doc matching s in document order
+func (s Selector) Select(doc *Document) []*Node {
+	var matches []*Node
+	siblings := newSiblingCache(doc)
+	walkElements(doc.Children, func(n *Node) {
+		if s.match(siblings, n) {
+			matches = append(matches, n)
+		}
+	})
+	return matches
+}
+
+// Match reports whether the element n of doc matches s
+func (s Selector) Match(doc *Document, n *Node) bool {
+	return s.match(newSiblingCache(doc), n)
+}
+
+// match reports whether the element n matches s, finding its siblings in siblings
+func (s Selector) match(siblings *siblingCache, n *Node) bool {
+	for _, complex := range s {
+		if complex.match(siblings, n, len(complex.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// siblingCache keeps the element siblings of the elements of a document
+// and the position of each element among them, so that matching many
+// siblings against positions and sibling combinators takes linear time.
+// It is used for one Select call, while the document does not change.
+type siblingCache struct {
+	doc      *Document
+	siblings map[*Node][]*Node // keyed by the parent, nil for the top-level nodes
+	index    map[*Node]int
+	preceded map[precededKey]bool
+}
+
+// precededKey identifies a compound selector of a complex selector and an element
+type precededKey struct {
+	compounds *compoundSelector
+	i         int
+	n         *Node
+}
+
+func newSiblingCache(doc *Document) *siblingCache {
+	return &siblingCache{doc: doc, siblings: map[*Node][]*Node{}, index: map[*Node]int{}, preceded: map[precededKey]bool{}}
+}
+
+// of returns the element siblings of n, including n, and the index of n among them
+func (c *siblingCache) of(n *Node) ([]*Node, int) {
+	siblings, ok := c.siblings[n.Parent]
+	if !ok {
+		siblings = elementSiblings(c.doc, n)
+		c.siblings[n.Parent] = siblings
+		for i, s := range siblings {
+			c.index[s] = i
+		}
+	}
+	return siblings, c.index[n]
+}
+
+// walkElements calls fn for every element in nodes and their descendants in document order
+func walkElements(nodes []*Node, fn func(*Node)) {
+	for _, n := range nodes {
+		if n.Type == ElementNode {
+			fn(n)
+			walkElements(n.Children, fn)
+		}
+	}
+}
+
+// elementSiblings returns the elements sharing the parent of n, including n.
+// Top-level nodes of a fragment are siblings of each other.
+func elementSiblings(doc *Document, n *Node) []*Node {
+	nodes := doc.Children
+	if n.Parent != nil {
+		nodes = n.Parent.Children
+	}
+	var siblings []*Node
+	for _, c := range nodes {
+		if c.Type == ElementNode {
+			siblings = append(siblings, c)
+		}
+	}
+	return siblings
+}
+
+// match reports whether n matches the compound selector at index i and the
+// compounds before it match the elements related by the combinators
+func (c complexSelector) match(siblings *siblingCache, n *Node, i int) bool {
+	if !c.compounds[i].match(siblings, n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	switch c.combinators[i-1] {
+	case '>':
+		return n.Parent != nil && c.match(siblings, n.Parent, i-1)
+	case '+':
+		nodes, index := siblings.of(n)
+		return index > 0 && c.match(siblings, nodes[index-1], i-1)
+	case '~':
+		return c.preceded(siblings, n, i-1)
+	default:
+		for a := n.Parent; a != nil; a = a.Parent {
+			if c.match(siblings, a, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// preceded reports whether an earlier element sibling of n matches the
+// compound selector at index i and the compounds before it. The answers are
+// kept in siblings, so that the siblings before an element are only searched
+// as far as the first one with a known answer.
+func (c complexSelector) preceded(siblings *siblingCache, n *Node, i int) bool {
+	var pending []*Node
+	result := false
+	for m := n; ; {
+		if known, ok := siblings.preceded[precededKey{&c.compounds[0], i, m}]; ok {
+			result = known
+			break
+		}
+		pending = append(pending, m)
+		nodes, index := siblings.of(m)
+		if index <= 0 {
+			break
+		}
+		m = nodes[index-1]
+		if c.match(siblings, m, i) {
+			result = true
+			break
+		}
+	}
+	for _, m := range pending {
+		siblings.preceded[precededKey{&c.compounds[0], i, m}] = result
+	}
+	return result
+}
+
+// match reports whether the element n matches every simple selector of c
+func (c compoundSelector) match(siblings *siblingCache, n *Node) bool {
+	if n.Type != ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != n.Tag {
+		return false
+	}
+	if c.id != "" && c.id != n.ID {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(n.Attributes["class"])
+		for _, class := range c.classes {
+			if indexOfString(classes, class) < 0 {
+				return false
+			}
+		}
+	}
+	for _, attr := range c.attributes {
+		if !attr.match(n) {
+			return false
+		}
+	}
+	if len(c.nth) > 0 {
+		nodes, index := siblings.of(n)
+		for _, nth := range c.nth {
+			position := index + 1
+			if nth.fromLast {
+				position = len(nodes) - index
+			}
+			if !nth.match(position) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// indexOfString returns the index of s in list, or -1
+func indexOfString(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// match reports whether the attribute of n satisfies the selector
+func (a attributeSelector) match(n *Node) bool {
+	val, ok := n.Attr(a.name)
+	if !ok {
+		return false
+	}
+
+	switch a.operator {
+	case "":
+		return true
+	case "=":
+		return val == a.value
+	case "~=":
+		return indexOfString(strings.Fields(val), a.value) >= 0
+	case "|=":
+		return val == a.value || strings.HasPrefix(val, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(val, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(val, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(val, a.value)
+	}
+	return false
+}
+
+// match reports whether the 1-based position is a*n+b for some n >= 0
+func (s nthSelector) match(position int) bool {
+	if s.a == 0 {
+		return position == s.b
+	}
+	diff := position - s.b
+	return diff%s.a == 0 && diff/s.a >= 0
+}
+
+// selectorParser reads a selector string
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+// eof reports whether the whole selector has been read
+func (p *selectorParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+// skipSpace skips whitespace and reports whether any was found
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && strings.IndexByte(whitespaceChars, p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// parseComplex reads compound selectors joined by combinators
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var c complexSelector
+	p.skipSpace()
+	for {
+		compound, err := p.parseCompound()
+		if err != nil {
+			return c, err
+		}
+		c.compounds = append(c.compounds, compound)
+
+		space := p.skipSpace()
+		if p.eof() || p.s[p.pos] == ',' {
+			return c, nil
+		}
+		combinator := byte(' ')
+		switch p.s[p.pos] {
+		case '>', '+', '~':
+			combinator = p.s[p.pos]
+			p.pos++
+			p.skipSpace()
+		default:
+			if !space {
+				return c, fmt.Errorf("unexpected %q", p.s[p.pos])
+			}
+		}
+		c.combinators = append(c.combinators, combinator)
+	}
+}
+
+// parseCompound reads a sequence of simple selectors without whitespace between them
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	start := p.pos
+
+	if !p.eof() && p.s[p.pos] == '*' {
+		p.pos++
+	} else if name := p.parseIdent(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+
+	for !p.eof() {
+		switch p.s[p.pos] {
+		case '#':
+			p.pos++
+			c.id = p.parseIdent()
+			if c.id == "" {
+				return c, fmt.Errorf("missing id after #")
+			}
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if class == "" {
+				return c, fmt.Errorf("missing class name after .")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			p.pos++
+			attr, err := p.parseAttribute()
+			if err != nil {
+				return c, err
+			}
+			c.attributes = append(c.attributes, attr)
+		case ':':
+			p.pos++
+			nth, err := p.parsePseudoClass()
+			if err != nil {
+				return c, err
+			}
+			c.nth = append(c.nth, nth...)
+		default:
+			if p.pos == start {
+				return c, fmt.Errorf("unexpected %q", p.s[p.pos])
+			}
+			return c, nil
+		}
+	}
+	if p.pos == start {
+		return c, fmt.Errorf("empty selector")
+	}
+	return c, nil
+}
+
+// parseIdent reads a CSS identifier, resolving backslash escapes
+func (p *selectorParser) parseIdent() string {
+	var b strings.Builder
+	for !p.eof() {
+		ch := p.s[p.pos]
+		switch {
+		case ch == '\\' && p.pos+1 < len(p.s):
+			b.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+		case ch == '-' || ch == '_' || ch >= 0x80 ||
+			('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9'):
+			b.WriteByte(ch)
+			p.pos++
+		default:
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+// parseAttribute reads an attribute selector after the opening bracket
+func (p *selectorParser) parseAttribute() (attributeSelector, error) {
+	var a attributeSelector
+	p.skipSpace()
+	a.name = strings.ToLower(p.parseIdent())
+	if a.name == "" {
+		return a, fmt.Errorf("missing attribute name")
+	}
+	p.skipSpace()
+	if p.eof() {
+		return a, fmt.Errorf("unterminated attribute selector")
+	}
+	if p.s[p.pos] == ']' {
+		p.pos++
+		return a, nil
+	}
+
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			a.operator = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if a.operator == "" {
+		return a, fmt.Errorf("unknown attribute operator at %q", p.s[p.pos:])
+	}
+
+	p.skipSpace()
+	if !p.eof() && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+		quote := p.s[p.pos]
+		end := strings.IndexByte(p.s[p.pos+1:], quote)
+		if end < 0 {
+			return a, fmt.Errorf("unterminated string")
+		}
+		a.value = p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else {
+		a.value = p.parseIdent()
+	}
+
+	p.skipSpace()
+	if p.eof() || p.s[p.pos] != ']' {
+		return a, fmt.Errorf("unterminated attribute selector")
+	}
+	p.pos++
+	return a, nil
+}
+
+// parsePseudoClass reads a pseudo-class after the colon
+func (p *selectorParser) parsePseudoClass() ([]nthSelector, error) {
+	name := strings.ToLower(p.parseIdent())
+	switch name {
+	case "first-child":
+		return []nthSelector{{b: 1}}, nil
+	case "last-child":
+		return []nthSelector{{b: 1, fromLast: true}}, nil
+	case "only-child":
+		return []nthSelector{{b: 1}, {b: 1, fromLast: true}}, nil
+	case "nth-child", "nth-last-child":
+	default:
+		return nil, fmt.Errorf("unsupported pseudo-class :%s", name)
+	}
+
+	if p.eof() || p.s[p.pos] != '(' {
+		return nil, fmt.Errorf("missing argument of :%s", name)
+	}
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated argument of :%s", name)
+	}
+	nth, err := parseNth(p.s[p.pos+1 : p.pos+end])
+	if err != nil {
+		return nil, err
+	}
+	p.pos += end + 1
+	nth.fromLast = name == "nth-last-child"
+	return []nthSelector{nth}, nil
+}
+
+// parseNth parses the an+b argument of :nth-child, including odd and even
+func parseNth(arg string) (nthSelector, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(arg), ""))
+	switch s {
+	case "odd":
+		return nthSelector{a: 2, b: 1}, nil
+	case "even":
+		return nthSelector{a: 2, b: 0}, nil
+	}
+
+	var nth nthSelector
+	var err error
+	before, after, found := strings.Cut(s, "n")
+	if !found {
+		nth.b, err = strconv.Atoi(s)
+		if err != nil {
+			return nth, fmt.Errorf("invalid :nth-child argument %q", arg)
+		}
+		return nth, nil
+	}
+
+	switch before {
+	case "", "+":
+		nth.a = 1
+	case "-":
+		nth.a = -1
+	default:
+		if nth.a, err = strconv.Atoi(before); err != nil {
+			return nth, fmt.Errorf("invalid :nth-child argument %q", arg)
+		}
+	}
+	if after != "" {
+		if after[0] != '+' && after[0] != '-' {
+			return nth, fmt.Errorf("invalid :nth-child argument %q", arg)
+		}
+		if nth.b, err = strconv.Atoi(after); err != nil {
+			return nth, fmt.Errorf("invalid :nth-child argument %q", arg)
+		}
+	}
+	return nth, nil
+}
@@ -0,0 +1,127 @@
+package hj
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSelect tests selecting elements with CSS selectors
+func TestSelect(t *testing.T) {
+	input := `<html><head><title>Title</title></head><body>
+<div id="content" class="main wide">
+  <p class="lead">First</p>
+  <p>Second</p>
+  <span lang="en-US">Third</span>
+  <p data-x="abc">Fourth</p>
+</div>
+<ul><li>1</li><li>2</li><li>3</li><li>4</li><li>5</li></ul>
+<a href="https://example.com/a.pdf">A</a><a href="/b">B</a>
+</body></html>`
+
+	doc, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"title", []string{"Title"}},
+		{"div#content > p.lead", []string{"First"}},
+		{"#content p", []string{"First", "Second", "Fourth"}},
+		{"div.main.wide > *:first-child", []string{"First"}},
+		{"body > p", nil},
+		{"p.lead + p", []string{"Second"}},
+		{"p.lead ~ p", []string{"Second", "Fourth"}},
+		{"p.lead ~ span + p", []string{"Fourth"}},
+		{"p ~ span ~ p, li:nth-child(2) ~ li ~ li", []string{"Fourth", "4", "5"}},
+		{"span ~ li, p ~ p ~ p ~ p", nil},
+		{"[lang|=en]", []string{"Third"}},
+		{`p[data-x="abc"]`, []string{"Fourth"}},
+		{"[data-x^=a], [data-x$=c], [data-x*=b]", []string{"Fourth"}},
+		{"[class~=wide]", []string{"First Second Third Fourth"}},
+		{"a[href$='.pdf']", []string{"A"}},
+		{"li:nth-child(2)", []string{"2"}},
+		{"li:nth-child(odd)", []string{"1", "3", "5"}},
+		{"li:nth-child(2n)", []string{"2", "4"}},
+		{"li:nth-child(-n + 2)", []string{"1", "2"}},
+		{"li:nth-last-child(1)", []string{"5"}},
+		{"LI:last-child", []string{"5"}},
+		{"title:only-child", []string{"Title"}},
+		{"ul li:nth-child(n+4)", []string{"4", "5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			nodes, err := Select(doc, tt.selector)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var texts []string
+			for _, n := range nodes {
+				texts = append(texts, nodeText(n))
+			}
+			if strings.Join(texts, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %q, got %q", tt.expected, texts)
+			}
+		})
+	}
+}
+
+// nodeText returns the trimmed text of the element children of n joined by spaces
+func nodeText(n *Node) string {
+	var parts []string
+	for _, c := range n.Children {
+		switch c.Type {
+		case TextNode:
+			if text := strings.TrimSpace(c.Text); text != "" {
+				parts = append(parts, text)
+			}
+		case ElementNode:
+			parts = append(parts, nodeText(c))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// TestSelect_Fragment tests that top-level fragment nodes are siblings
+func TestSelect_Fragment(t *testing.T) {
+	doc, err := ParseFragment(strings.NewReader("<li>a</li><li>b</li><li>c</li>"), "ul")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	nodes, err := Select(doc, "li + li:last-child")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nodes) != 1 || nodeText(nodes[0]) != "c" {
+		t.Errorf("Expected the last li, got %v", nodes)
+	}
+}
+
+// TestCompileSelector_Errors tests invalid selectors
+func TestCompileSelector_Errors(t *testing.T) {
+	selectors := []string{
+		"",
+		"div,",
+		"div >",
+		"#",
+		"div.",
+		"[href",
+		"[href=\"a]",
+		"[href!=a]",
+		"p:hover",
+		"li:nth-child(x)",
+		"li:nth-child(2n+)",
+		"div)",
+	}
+
+	for _, selector := range selectors {
+		if _, err := CompileSelector(selector); err == nil {
+			t.Errorf("Expected error for %q", selector)
+		}
+	}
+}
@@ -0,0 +1,638 @@
+package hj
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrNotWellFormed is returned when HTML cannot be streamed because the HTML
+// parser would restructure it, for example by closing an open <p> or by adding
+// missing <tbody> or <head> elements. Such input has to be converted with the
+// tree-based HTMLtoJSONWithOptions instead.
+var ErrNotWellFormed = errors.New("HTML is not well-formed for streaming")
+
+// whitespaceChars are the characters HTML treats as whitespace
+const whitespaceChars = " \t\n\f\r"
+
+// voidElements lists the elements that never have an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "basefont": true, "bgsound": true, "br": true,
+	"col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"keygen": true, "link": true, "meta": true, "param": true, "source": true,
+	"track": true, "wbr": true,
+}
+
+// headElements lists the elements allowed inside <head>
+var headElements = map[string]bool{
+	"base": true, "basefont": true, "bgsound": true, "link": true, "meta": true,
+	"noframes": true, "noscript": true, "script": true, "style": true, "title": true,
+}
+
+// closesParagraph lists the start tags that close an open <p>
+var closesParagraph = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"center": true, "details": true, "dialog": true, "dir": true, "div": true,
+	"dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "header": true, "hgroup": true, "main": true, "menu": true,
+	"nav": true, "ol": true, "p": true, "search": true, "section": true,
+	"summary": true, "ul": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "pre": true, "listing": true, "form": true,
+	"li": true, "dd": true, "dt": true, "table": true, "hr": true, "xmp": true,
+}
+
+// specialElements lists the elements the HTML parser treats as special
+var specialElements = map[string]bool{
+	"address": true, "applet": true, "area": true, "article": true, "aside": true,
+	"base": true, "basefont": true, "bgsound": true, "blockquote": true,
+	"body": true, "br": true, "button": true, "caption": true, "center": true,
+	"col": true, "colgroup": true, "dd": true, "details": true, "dir": true,
+	"div": true, "dl": true, "dt": true, "embed": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"frame": true, "frameset": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "head": true, "header": true,
+	"hgroup": true, "hr": true, "html": true, "iframe": true, "img": true,
+	"input": true, "keygen": true, "li": true, "link": true, "listing": true,
+	"main": true, "marquee": true, "menu": true, "meta": true, "nav": true,
+	"noembed": true, "noframes": true, "noscript": true, "object": true,
+	"ol": true, "p": true, "param": true, "plaintext": true, "pre": true,
+	"script": true, "search": true, "section": true, "select": true,
+	"source": true, "style": true, "summary": true, "table": true,
+	"tbody": true, "td": true, "template": true, "textarea": true,
+	"tfoot": true, "th": true, "thead": true, "title": true, "tr": true,
+	"track": true, "ul": true, "wbr": true, "xmp": true,
+}
+
+// scopeElements lists the elements that end the default scope of the HTML parser
+var scopeElements = map[string]bool{
+	"applet": true, "caption": true, "html": true, "table": true, "td": true,
+	"th": true, "marquee": true, "object": true, "template": true,
+}
+
+// restructuredElements lists the start tags that are never streamed because
+// the HTML parser renames, moves or drops them, or parses them in another namespace
+var restructuredElements = map[string]bool{
+	"html": true, "head": true, "body": true, "frameset": true, "frame": true,
+	"image": true, "isindex": true, "plaintext": true, "svg": true, "math": true,
+	"template": true, "caption": true, "col": true, "colgroup": true,
+	"tbody": true, "thead": true, "tfoot": true, "tr": true, "td": true,
+	"th": true,
+}
+
+// tableChildren lists the start tags allowed directly inside table elements
+var tableChildren = map[string]map[string]bool{
+	"table":    {"caption": true, "colgroup": true, "thead": true, "tbody": true, "tfoot": true, "script": true, "style": true},
+	"thead":    {"tr": true, "script": true, "style": true},
+	"tbody":    {"tr": true, "script": true, "style": true},
+	"tfoot":    {"tr": true, "script": true, "style": true},
+	"tr":       {"td": true, "th": true, "script": true, "style": true},
+	"colgroup": {"col": true},
+	"select":   {"option": true, "optgroup": true, "script": true},
+	"optgroup": {"option": true, "script": true},
+	"option":   {"script": true},
+}
+
+// streamElement is an element that is open while streaming
+type streamElement struct {
+	tag    string
+	prefix string // indentation of the line the element map starts on
+	fields int    // number of fields written to the element object
+	items  int    // number of items written to the child array
+	fresh  bool   // no child token has been read yet
+
+	// text is the text content in the default mode, or the text that
+	// has not been written yet in mixed content mode
+	text    strings.Builder
+	hasText bool
+}
+
+// Stream states, following the insertion modes of the HTML parser
+const (
+	streamBeforeHTML = iota
+	streamBeforeHead
+	streamInHead
+	streamAfterHead
+	streamInBody
+	streamAfterBody
+	streamAfterHTML
+)
+
+// streamConverter converts tokens to JSON as elements open and close
+type streamConverter struct {
+	z     *html.Tokenizer
+	w     *bufio.Writer
+	opts  Options
+	stack []*streamElement
+	state int
+	text  strings.Builder
+}
+
+// StreamHTMLtoJSON reads HTML from r and writes JSON to w as elements close,
+// keeping only the open elements in memory. For well-formed documents the
+// output is byte-identical to HTMLtoJSONWithOptions.
+//
+// A document is well-formed when it has explicit <html>, <head> and <body>
+// elements, every element except void elements is closed in order, and
+// nothing would be moved, added or dropped by the HTML parser. Otherwise an
+// error wrapping ErrNotWellFormed is returned after part of the output has
+// been written, so use CheckWellFormed first when a fallback is needed.
+//
+// The Lossless, Fragment and WhitespacePreserve options are not supported.
+func StreamHTMLtoJSON(r io.Reader, w io.Writer, opts Options) error {
+	if opts.Lossless || opts.Fragment || opts.whitespace() == WhitespacePreserve {
+		return fmt.Errorf("streaming does not support lossless, fragment or preserved whitespace output")
+	}
+
+	c := &streamConverter{
+		z:    html.NewTokenizer(r),
+		w:    bufio.NewWriter(w),
+		opts: opts,
+	}
+	if err := c.run(); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// CheckWellFormed reports whether StreamHTMLtoJSON can convert the HTML read
+// from r. It returns an error wrapping ErrNotWellFormed when it cannot.
+func CheckWellFormed(r io.Reader) error {
+	return StreamHTMLtoJSON(r, io.Discard, Options{Compact: true})
+}
+
+// notWellFormed returns an error wrapping ErrNotWellFormed
+func notWellFormed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrNotWellFormed, fmt.Sprintf(format, args...))
+}
+
+// run reads all tokens and writes the JSON output
+func (c *streamConverter) run() error {
+	for {
+		tt := c.z.Next()
+		if tt == html.TextToken {
+			c.text.Write(c.z.Text())
+			continue
+		}
+		if err := c.flushText(); err != nil {
+			return err
+		}
+
+		switch tt {
+		case html.ErrorToken:
+			if c.z.Err() != io.EOF {
+				return fmt.Errorf("failed to parse HTML: %v", c.z.Err())
+			}
+			return c.finish()
+
+		case html.DoctypeToken:
+			if c.state != streamBeforeHTML {
+				return notWellFormed("misplaced doctype")
+			}
+
+		case html.CommentToken:
+			c.comment(string(c.z.Text()))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := c.z.Token()
+			if tt == html.SelfClosingTagToken && !voidElements[tok.Data] {
+				return notWellFormed("self-closing <%s/>", tok.Data)
+			}
+			if err := c.startTag(tok); err != nil {
+				return err
+			}
+
+		case html.EndTagToken:
+			name, _ := c.z.TagName()
+			if err := c.endTag(string(name)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// top returns the current element, or nil outside <html>
+func (c *streamConverter) top() *streamElement {
+	if len(c.stack) == 0 {
+		return nil
+	}
+	return c.stack[len(c.stack)-1]
+}
+
+// hasAncestor reports whether tag is open, searching from the current element
+// until an element in stop is reached
+func (c *streamConverter) hasAncestor(tag string, stop map[string]bool) bool {
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i].tag == tag {
+			return true
+		}
+		if stop[c.stack[i].tag] {
+			return false
+		}
+	}
+	return false
+}
+
+// flushText handles the text read since the last non-text token
+func (c *streamConverter) flushText() error {
+	if c.text.Len() == 0 {
+		return nil
+	}
+	text := c.text.String()
+	c.text.Reset()
+
+	e := c.top()
+	if e == nil || c.state == streamAfterBody {
+		// Only whitespace is allowed outside <html> and after </body>
+		if strings.Trim(text, whitespaceChars) != "" {
+			return notWellFormed("text outside body")
+		}
+		return nil
+	}
+
+	switch e.tag {
+	case "html", "head", "table", "thead", "tbody", "tfoot", "tr", "colgroup":
+		if strings.Trim(text, whitespaceChars) != "" {
+			return notWellFormed("text in <%s>", e.tag)
+		}
+	case "pre", "listing", "textarea":
+		// The HTML parser drops a newline at the start of these elements
+		if e.fresh {
+			text = strings.TrimPrefix(text, "\r")
+			text = strings.TrimPrefix(text, "\n")
+		}
+	}
+	if strings.Contains(text, "\x00") {
+		return notWellFormed("NUL character in text")
+	}
+	if text == "" {
+		return nil
+	}
+	e.fresh = false
+
+	if c.opts.mixedContent() {
+		c.mixedText(e, text)
+	} else if e.items == 0 {
+		if normalized, ok := normalizeText(text, c.opts.whitespace()); ok {
+			e.text.WriteString(normalized)
+			e.hasText = true
+		}
+	}
+	return nil
+}
+
+// mixedText merges text into the pending text of e the same way mixedContentToJSON does
+func (c *streamConverter) mixedText(e *streamElement, text string) {
+	policy := c.opts.whitespace()
+	normalized, ok := normalizeText(text, policy)
+	if !ok {
+		return
+	}
+	if e.hasText {
+		normalized, _ = normalizeText(e.text.String()+normalized, policy)
+		e.text.Reset()
+	}
+	e.text.WriteString(normalized)
+	e.hasText = true
+}
+
+// comment writes a comment when comments are kept
+func (c *streamConverter) comment(data string) {
+	e := c.top()
+	if e == nil || c.state == streamAfterHTML {
+		// Comments outside <html> are not part of the output
+		return
+	}
+	e.fresh = false
+	if !c.opts.keepComments() {
+		return
+	}
+
+	// The HTML parser reads <?target data?> as a bogus comment
+	if strings.HasPrefix(data, "?") {
+		data = "?" + strings.TrimSuffix(strings.TrimPrefix(data, "?"), "?") + "?"
+	}
+	c.openItem(e)
+	c.writeValue(map[string]string{"#comment": data}, c.itemPrefix(e))
+}
+
+// startTag validates and opens an element
+func (c *streamConverter) startTag(tok html.Token) error {
+	tag := tok.Data
+	e := c.top()
+
+	switch c.state {
+	case streamBeforeHTML:
+		if tag != "html" {
+			return notWellFormed("missing <html>")
+		}
+		c.state = streamBeforeHead
+		c.open(tok)
+		return nil
+	case streamBeforeHead:
+		if tag != "head" {
+			return notWellFormed("missing <head>")
+		}
+		c.state = streamInHead
+		c.open(tok)
+		return nil
+	case streamAfterHead:
+		if tag != "body" {
+			return notWellFormed("missing <body>")
+		}
+		c.state = streamInBody
+		c.open(tok)
+		return nil
+	case streamAfterBody, streamAfterHTML:
+		return notWellFormed("<%s> after </body>", tag)
+	}
+
+	if err := c.checkStartTag(e, tag); err != nil {
+		return err
+	}
+	c.open(tok)
+	if voidElements[tag] {
+		c.close()
+	}
+	return nil
+}
+
+// checkStartTag returns an error when the HTML parser would not simply add
+// an element named tag to the current element e
+func (c *streamConverter) checkStartTag(e *streamElement, tag string) error {
+	if e.tag == "head" {
+		if !headElements[tag] {
+			return notWellFormed("<%s> in <head>", tag)
+		}
+		return nil
+	}
+
+	// Elements inside tables and selects are restricted
+	for _, ancestor := range []string{"select", "option", "optgroup"} {
+		if c.hasAncestor(ancestor, nil) && !tableChildren[e.tag][tag] {
+			return notWellFormed("<%s> in <%s>", tag, e.tag)
+		}
+	}
+	if allowed, ok := tableChildren[e.tag]; ok {
+		if !allowed[tag] {
+			return notWellFormed("<%s> in <%s>", tag, e.tag)
+		}
+		return nil
+	}
+	if restructuredElements[tag] {
+		return notWellFormed("<%s> outside its context", tag)
+	}
+
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		switch e.tag {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			return notWellFormed("<%s> in <%s>", tag, e.tag)
+		}
+	case "li", "dd", "dt":
+		for i := len(c.stack) - 1; i >= 0; i-- {
+			ancestor := c.stack[i].tag
+			if ancestor == tag || (tag != "li" && (ancestor == "dd" || ancestor == "dt")) {
+				return notWellFormed("<%s> in <%s>", tag, ancestor)
+			}
+			if specialElements[ancestor] && ancestor != "address" && ancestor != "div" && ancestor != "p" {
+				break
+			}
+		}
+	case "a":
+		markers := map[string]bool{"applet": true, "caption": true, "marquee": true, "object": true, "td": true, "th": true, "template": true}
+		if c.hasAncestor("a", markers) {
+			return notWellFormed("<a> in <a>")
+		}
+	case "button", "nobr":
+		if c.hasAncestor(tag, scopeElements) {
+			return notWellFormed("<%s> in <%s>", tag, tag)
+		}
+	case "form":
+		if c.hasAncestor("form", nil) {
+			return notWellFormed("<form> in <form>")
+		}
+	case "option", "optgroup":
+		if e.tag == "option" {
+			return notWellFormed("<%s> in <option>", tag)
+		}
+	case "rb", "rp", "rt", "rtc":
+		switch e.tag {
+		case "dd", "dt", "li", "optgroup", "option", "p", "rb", "rp", "rt", "rtc":
+			return notWellFormed("<%s> in <%s>", tag, e.tag)
+		}
+	}
+
+	if closesParagraph[tag] {
+		buttonScope := map[string]bool{"button": true}
+		for t := range scopeElements {
+			buttonScope[t] = true
+		}
+		if c.hasAncestor("p", buttonScope) {
+			return notWellFormed("<%s> in <p>", tag)
+		}
+	}
+	return nil
+}
+
+// endTag validates and closes the current element
+func (c *streamConverter) endTag(tag string) error {
+	e := c.top()
+
+	switch {
+	case c.state == streamAfterHTML:
+		return notWellFormed("</%s> after </html>", tag)
+	case c.state == streamAfterBody && tag == "html":
+		c.close()
+		c.state = streamAfterHTML
+		return nil
+	case e == nil || e.tag != tag || voidElements[tag] || tag == "html":
+		return notWellFormed("unexpected </%s>", tag)
+	}
+
+	c.close()
+	switch tag {
+	case "head":
+		c.state = streamAfterHead
+	case "body":
+		c.state = streamAfterBody
+	}
+	return nil
+}
+
+// finish closes the elements left open at the end of the input
+func (c *streamConverter) finish() error {
+	if c.state < streamInBody {
+		return notWellFormed("missing <body>")
+	}
+	for len(c.stack) > 0 {
+		c.close()
+	}
+	return nil
+}
+
+// indent returns n levels of indentation
+func (c *streamConverter) indent(n int) string {
+	if c.opts.Compact {
+		return ""
+	}
+	return strings.Repeat(c.opts.indent(), n)
+}
+
+// newline writes a line break followed by prefix
+func (c *streamConverter) newline(prefix string) {
+	if !c.opts.Compact {
+		c.w.WriteString("\n")
+		c.w.WriteString(prefix)
+	}
+}
+
+// writeKey writes an object key and the separator after it
+func (c *streamConverter) writeKey(key string) {
+	c.writeValue(key, "")
+	if c.opts.Compact {
+		c.w.WriteString(":")
+	} else {
+		c.w.WriteString(": ")
+	}
+}
+
+// writeValue writes v as JSON whose first line starts at prefix
+func (c *streamConverter) writeValue(v interface{}, prefix string) {
+	var data []byte
+	if c.opts.Compact {
+		data, _ = json.Marshal(v)
+	} else {
+		data, _ = json.MarshalIndent(v, prefix, c.opts.indent())
+	}
+	c.w.Write(data)
+}
+
+// itemPrefix returns the indentation of the items in the child array of e
+func (c *streamConverter) itemPrefix(e *streamElement) string {
+	return e.prefix + c.indent(3)
+}
+
+// openField starts a field of the element object of e
+func (c *streamConverter) openField(e *streamElement, name string) {
+	if e.fields > 0 {
+		c.w.WriteString(",")
+	}
+	c.newline(e.prefix + c.indent(2))
+	c.writeKey(name)
+	e.fields++
+}
+
+// openItem starts an item of the child array of e
+func (c *streamConverter) openItem(e *streamElement) {
+	if !c.opts.mixedContent() {
+		// Text is dropped once an element has element or comment children
+		e.text.Reset()
+		e.hasText = false
+	} else if e.hasText {
+		// Pending text comes before the new item
+		text := e.text.String()
+		if e.items == 0 && c.opts.whitespace() == WhitespaceCollapse {
+			text = strings.TrimLeft(text, " ")
+		}
+		e.text.Reset()
+		e.hasText = false
+		c.openItem(e)
+		c.writeValue(text, "")
+	}
+
+	if e.items == 0 {
+		c.openField(e, "child")
+		c.w.WriteString("[")
+	} else {
+		c.w.WriteString(",")
+	}
+	c.newline(c.itemPrefix(e))
+	e.items++
+}
+
+// open writes the start of an element and pushes it on the stack
+func (c *streamConverter) open(tok html.Token) {
+	var id string
+	attributes := make(map[string]string)
+	for _, attr := range tok.Attr {
+		if attr.Key == "id" {
+			id = attr.Val
+			continue
+		}
+		attributes[attr.Key] = attr.Val
+	}
+	if id != "" && (c.opts.KeyStyle != KeyTagID || c.opts.Attributes == AttributesAll) {
+		attributes["id"] = id
+	}
+	if c.opts.Attributes == AttributesNone {
+		attributes = nil
+	}
+
+	key := tok.Data
+	if c.opts.KeyStyle == KeyTagID {
+		key = generateElementKey(tok.Data, id)
+	}
+
+	prefix := ""
+	if parent := c.top(); parent != nil {
+		parent.fresh = false
+		c.openItem(parent)
+		prefix = c.itemPrefix(parent)
+	}
+
+	e := &streamElement{tag: tok.Data, prefix: prefix, fresh: true}
+	c.stack = append(c.stack, e)
+
+	c.w.WriteString("{")
+	c.newline(prefix + c.indent(1))
+	c.writeKey(key)
+	c.w.WriteString("{")
+	if len(attributes) > 0 {
+		c.openField(e, "attributes")
+		c.writeValue(attributes, prefix+c.indent(2))
+	}
+}
+
+// close writes the end of the current element and pops it from the stack
+func (c *streamConverter) close() {
+	e := c.top()
+	c.stack = c.stack[:len(c.stack)-1]
+
+	if e.hasText {
+		text := e.text.String()
+		if c.opts.whitespace() == WhitespaceCollapse {
+			if c.opts.mixedContent() {
+				text = strings.TrimRight(text, " ")
+				if e.items == 0 {
+					text = strings.TrimLeft(text, " ")
+				}
+			} else {
+				text = strings.TrimSpace(collapseWhitespace(text))
+			}
+		}
+		if e.items > 0 {
+			c.w.WriteString(",")
+			c.newline(c.itemPrefix(e))
+			c.writeValue(text, "")
+		} else {
+			c.openField(e, "child")
+			c.writeValue(text, "")
+		}
+	}
+
+	if e.items > 0 {
+		c.newline(e.prefix + c.indent(2))
+		c.w.WriteString("]")
+	}
+	if e.fields > 0 {
+		c.newline(e.prefix + c.indent(1))
+	}
+	c.w.WriteString("}")
+	c.newline(e.prefix)
+	c.w.WriteString("}")
+}
@@ -0,0 +1,106 @@
+package hj
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestStreamHTMLtoJSON tests that streaming output matches the tree-based conversion
+func TestStreamHTMLtoJSON(t *testing.T) {
+	sample, err := os.ReadFile("sample.html")
+	if err != nil {
+		t.Fatalf("Failed to read sample.html: %v", err)
+	}
+
+	inputs := []string{
+		string(sample),
+		`<!DOCTYPE html><!-- top --><html lang="en"><head><meta charset="utf-8"><title>A &amp; B</title><style>p > a {}</style></head>
+<body class="main">
+  <div id="content">Hello <b>world</b><!-- note -->!<br>
+    <ul><li><a href="/a">A</a></li><li id="b">B</li></ul>
+    <table><thead><tr><th>h</th></tr></thead><tbody><tr><td>1</td><td>2</td></tr></tbody></table>
+    <pre>
+  code</pre>
+    <p>a <?pi data?> b</p>
+    <select><optgroup label="g"><option value="1">One</option></optgroup></select>
+  </div>
+</body><!-- after body -->
+</html>
+`,
+		`<html><head></head><body><p id="">x</p><p>open`,
+	}
+	options := []Options{
+		{},
+		{MixedContent: true},
+		{KeepComments: true},
+		{MixedContent: true, KeepComments: true, Whitespace: WhitespaceTrim},
+		{Whitespace: WhitespaceCollapse},
+		{Compact: true, KeyStyle: KeyTag},
+		{Indent: "\t", Attributes: AttributesAll},
+		{Attributes: AttributesNone},
+	}
+
+	for _, input := range inputs {
+		for _, opts := range options {
+			expected, err := HTMLtoJSONWithOptions(strings.NewReader(input), opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var out bytes.Buffer
+			if err := StreamHTMLtoJSON(strings.NewReader(input), &out, opts); err != nil {
+				t.Fatalf("Unexpected error for %q: %v", input, err)
+			}
+			if out.String() != expected {
+				t.Errorf("Options %+v, input %q\nExpected:\n%s\nGot:\n%s", opts, input, expected, out.String())
+			}
+		}
+	}
+}
+
+// TestCheckWellFormed tests detection of input the HTML parser would restructure
+func TestCheckWellFormed(t *testing.T) {
+	tests := []struct {
+		name       string
+		html       string
+		wellFormed bool
+	}{
+		{"Complete document", "<html><head></head><body><p>x</p></body></html>", true},
+		{"Unclosed elements at end", "<html><head></head><body><div><p>x", true},
+		{"Missing html", "<head></head><body></body>", false},
+		{"Missing body", "<html><head></head><p>x</p></html>", false},
+		{"Implied p end", "<html><head></head><body><p>a<div>b</div></p></body></html>", false},
+		{"Mismatched end tag", "<html><head></head><body><b><i>x</b></i></body></html>", false},
+		{"Missing tbody", "<html><head></head><body><table><tr><td>1</td></tr></table></body></html>", false},
+		{"Text in table", "<html><head></head><body><table>x</table></body></html>", false},
+		{"Nested list item", "<html><head></head><body><ul><li>a<li>b</ul></body></html>", false},
+		{"Self-closing div", "<html><head></head><body><div/></body></html>", false},
+		{"Body element in head", "<html><head><p>x</p></head><body></body></html>", false},
+		{"Text after body", "<html><head></head><body></body>x</html>", false},
+		{"Foreign content", "<html><head></head><body><svg></svg></body></html>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckWellFormed(strings.NewReader(tt.html))
+			if tt.wellFormed && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tt.wellFormed && !errors.Is(err, ErrNotWellFormed) {
+				t.Errorf("Expected ErrNotWellFormed, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStreamHTMLtoJSON_UnsupportedOptions tests options that need the document tree
+func TestStreamHTMLtoJSON_UnsupportedOptions(t *testing.T) {
+	for _, opts := range []Options{{Lossless: true}, {Fragment: true}, {Whitespace: WhitespacePreserve}} {
+		if err := StreamHTMLtoJSON(strings.NewReader("<html></html>"), &bytes.Buffer{}, opts); err == nil {
+			t.Errorf("Expected error for options %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package hj
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// StructuredData holds the structured data embedded in a document
+type StructuredData struct {
+	// JSONLD holds the parsed content of each application/ld+json script
+	JSONLD []interface{} `json:"jsonld"`
+	// Microdata holds the top-level Microdata items
+	Microdata []*StructuredItem `json:"microdata"`
+	// RDFa holds the top-level RDFa Lite items
+	RDFa []*StructuredItem `json:"rdfa"`
+	// Errors describes the JSON-LD scripts that could not be parsed
+	Errors []string `json:"errors,omitempty"`
+}
+
+// StructuredItem is a Microdata or RDFa item. Properties maps each property
+// name to its values in document order, which are strings or nested items.
+type StructuredItem struct {
+	Type       []string `json:"type,omitempty"`
+	ID         string   `json:"id,omitempty"`
+	Properties Object   `json:"properties"`
+}
+
+// add appends a value of the named property
+func (item *StructuredItem) add(name string, value interface{}) {
+	for i, f := range item.Properties {
+		if f.Key == name {
+			item.Properties[i].Value = append(f.Value.([]interface{}), value)
+			return
+		}
+	}
+	item.Properties = append(item.Properties, Field{Key: name, Value: []interface{}{value}})
+}
+
+// urlProperties lists the attribute holding the value of a property by element,
+// for the elements whose value is a URL
+var urlProperties = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"audio":  "src",
+	"embed":  "src",
+	"iframe": "src",
+	"img":    "src",
+	"source": "src",
+	"track":  "src",
+	"video":  "src",
+	"object": "data",
+}
+
+// ExtractStructuredData returns the JSON-LD, Microdata and RDFa Lite data of a document.
+// URLs in Microdata and RDFa values are resolved against the base URL of the document.
+func ExtractStructuredData(doc *Document) *StructuredData {
+	data := &StructuredData{
+		JSONLD:    []interface{}{},
+		Microdata: []*StructuredItem{},
+		RDFa:      []*StructuredItem{},
+	}
+	paths := newElementPaths(doc)
+
+	walkElements(doc.Children, func(n *Node) {
+		if n.Tag != "script" {
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(n.Attributes["type"])
+		if err != nil || mediaType != "application/ld+json" {
+			return
+		}
+		v, err := decodeOrderedJSON([]byte(textContent(n)))
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("invalid JSON-LD in %s: %v", paths.path(n), err))
+			return
+		}
+		data.JSONLD = append(data.JSONLD, v)
+	})
+
+	m := newMicrodataReader(doc)
+	walkElements(doc.Children, func(n *Node) {
+		if hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+			data.Microdata = append(data.Microdata, m.item(n, map[*Node]bool{}))
+		}
+	})
+
+	data.RDFa = extractRDFa(doc)
+	return data
+}
+
+// StructuredDataToJSON writes structured data as JSON
+func StructuredDataToJSON(data *StructuredData, opts Options) ([]byte, error) {
+	return marshalJSON(data, opts)
+}
+
+// hasAttr reports whether n has the named attribute
+func hasAttr(n *Node, name string) bool {
+	_, ok := n.Attributes[name]
+	return ok
+}
+
+// microdataReader builds Microdata items following the WHATWG algorithm
+type microdataReader struct {
+	base  *url.URL
+	ids   map[string]*Node
+	order map[*Node]int
+}
+
+// newMicrodataReader indexes the elements of a document by id and position
+func newMicrodataReader(doc *Document) *microdataReader {
+	m := &microdataReader{
+		base:  doc.BaseURL(),
+		ids:   map[string]*Node{},
+		order: map[*Node]int{},
+	}
+	walkElements(doc.Children, func(n *Node) {
+		m.order[n] = len(m.order)
+		if n.ID != "" && m.ids[n.ID] == nil {
+			m.ids[n.ID] = n
+		}
+	})
+	return m
+}
+
+// item builds the item of an element with itemscope. Items being built are
+// in visiting, and items referring back to them are left out.
+func (m *microdataReader) item(n *Node, visiting map[*Node]bool) *StructuredItem {
+	visiting[n] = true
+	defer delete(visiting, n)
+
+	item := &StructuredItem{Type: strings.Fields(n.Attributes["itemtype"]), Properties: Object{}}
+	if id, ok := n.Attributes["itemid"]; ok {
+		item.ID = resolveURL(m.base, id)
+	}
+
+	for _, p := range m.properties(n) {
+		var value interface{}
+		if hasAttr(p, "itemscope") {
+			if visiting[p] {
+				continue
+			}
+			value = m.item(p, visiting)
+		} else {
+			value = m.value(p)
+		}
+		for _, name := range strings.Fields(p.Attributes["itemprop"]) {
+			item.add(name, value)
+		}
+	}
+	return item
+}
+
+// properties returns the property elements of an item in document order:
+// the descendants with itemprop and those of the elements named by itemref,
+// without descending into nested items
+func (m *microdataReader) properties(root *Node) []*Node {
+	pending := append([]*Node{}, root.Children...)
+	for _, id := range strings.Fields(root.Attributes["itemref"]) {
+		if n := m.ids[id]; n != nil {
+			pending = append(pending, n)
+		}
+	}
+
+	var props []*Node
+	seen := map[*Node]bool{root: true}
+	for len(pending) > 0 {
+		n := pending[0]
+		pending = pending[1:]
+		if n.Type != ElementNode || seen[n] {
+			continue
+		}
+		seen[n] = true
+		if !hasAttr(n, "itemscope") {
+			pending = append(pending, n.Children...)
+		}
+		if strings.Trim(n.Attributes["itemprop"], whitespaceChars) != "" {
+			props = append(props, n)
+		}
+	}
+
+	sort.SliceStable(props, func(i, j int) bool { return m.order[props[i]] < m.order[props[j]] })
+	return props
+}
+
+// value returns the value of a property element that is not an item
+func (m *microdataReader) value(n *Node) string {
+	switch n.Tag {
+	case "meta":
+		return n.Attributes["content"]
+	case "data", "meter":
+		return n.Attributes["value"]
+	case "time":
+		if datetime, ok := n.Attributes["datetime"]; ok {
+			return datetime
+		}
+	}
+	if attribute, ok := urlProperties[n.Tag]; ok {
+		if ref, ok := n.Attributes[attribute]; ok {
+			return resolveURL(m.base, ref)
+		}
+		return ""
+	}
+	return strings.Join(strings.Fields(textContent(n)), " ")
+}
+
+// rdfaContext holds the vocabulary, prefixes and current item in scope while reading RDFa
+type rdfaContext struct {
+	vocab    string
+	prefixes map[string]string
+	item     *StructuredItem
+}
+
+// rdfaInitialPrefixes lists the prefixes predefined by the RDFa initial context that are used with RDFa Lite
+var rdfaInitialPrefixes = map[string]string{
+	"schema": "http://schema.org/",
+	"og":     "http://ogp.me/ns#",
+	"dc":     "http://purl.org/dc/terms/",
+	"foaf":   "http://xmlns.com/foaf/0.1/",
+	"rdfs":   "http://www.w3.org/2000/01/rdf-schema#",
+	"xsd":    "http://www.w3.org/2001/XMLSchema#",
+}
+
+// extractRDFa returns the top-level RDFa Lite items of a document: the
+// elements with typeof that are not the value of a property of another item
+func extractRDFa(doc *Document) []*StructuredItem {
+	base := doc.BaseURL()
+	items := []*StructuredItem{}
+
+	var walk func(nodes []*Node, ctx rdfaContext)
+	walk = func(nodes []*Node, ctx rdfaContext) {
+		for _, n := range nodes {
+			if n.Type != ElementNode {
+				continue
+			}
+			local := ctx
+			if vocab, ok := n.Attributes["vocab"]; ok {
+				local.vocab = strings.Trim(vocab, whitespaceChars)
+			}
+			if prefix, ok := n.Attributes["prefix"]; ok {
+				local.prefixes = parseRDFaPrefixes(prefix, ctx.prefixes)
+			}
+
+			var item *StructuredItem
+			if typeOf, ok := n.Attributes["typeof"]; ok {
+				item = &StructuredItem{Properties: Object{}}
+				for _, t := range strings.Fields(typeOf) {
+					item.Type = append(item.Type, local.expand(t))
+				}
+				if resource, ok := n.Attributes["resource"]; ok {
+					item.ID = resolveURL(base, resource)
+				}
+			}
+
+			property := strings.Fields(n.Attributes["property"])
+			switch {
+			case len(property) > 0 && ctx.item != nil:
+				var value interface{} = item
+				if item == nil {
+					value = rdfaValue(n, base)
+				}
+				for _, name := range property {
+					ctx.item.add(name, value)
+				}
+			case item != nil:
+				items = append(items, item)
+			}
+
+			if item != nil {
+				local.item = item
+			}
+			walk(n.Children, local)
+		}
+	}
+	walk(doc.Children, rdfaContext{prefixes: rdfaInitialPrefixes})
+	return items
+}
+
+// expand returns the IRI of a type given as a term, a prefixed name or an IRI
+func (ctx rdfaContext) expand(term string) string {
+	if prefix, name, ok := strings.Cut(term, ":"); ok {
+		if iri, ok := ctx.prefixes[prefix]; ok && !strings.HasPrefix(name, "//") {
+			return iri + name
+		}
+		return term
+	}
+	if ctx.vocab != "" {
+		return ctx.vocab + term
+	}
+	return term
+}
+
+// parseRDFaPrefixes adds the "name: IRI" pairs of a prefix attribute to the prefixes in scope
+func parseRDFaPrefixes(attr string, inherited map[string]string) map[string]string {
+	prefixes := make(map[string]string, len(inherited))
+	for name, iri := range inherited {
+		prefixes[name] = iri
+	}
+	fields := strings.Fields(attr)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if name, ok := strings.CutSuffix(fields[i], ":"); ok {
+			prefixes[strings.ToLower(name)] = fields[i+1]
+		}
+	}
+	return prefixes
+}
+
+// rdfaValue returns the value of a property element that is not an item:
+// its content, the URL it refers to, or its text
+func rdfaValue(n *Node, base *url.URL) string {
+	if content, ok := n.Attributes["content"]; ok {
+		return content
+	}
+	if resource, ok := n.Attributes["resource"]; ok {
+		return resolveURL(base, resource)
+	}
+	if attribute, ok := urlProperties[n.Tag]; ok {
+		if ref, ok := n.Attributes[attribute]; ok {
+			return resolveURL(base, ref)
+		}
+	}
+	if datetime, ok := n.Attributes["datetime"]; ok && n.Tag == "time" {
+		return datetime
+	}
+	return strings.Join(strings.Fields(textContent(n)), " ")
+}
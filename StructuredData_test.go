@@ -0,0 +1,99 @@
+package hj
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestExtractStructuredData tests reading JSON-LD, Microdata and RDFa as compact JSON
+func TestExtractStructuredData(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "No structured data",
+			input:    `<p>Hello</p>`,
+			expected: `{"jsonld":[],"microdata":[],"rdfa":[]}`,
+		},
+		{
+			name: "JSON-LD",
+			input: `<script type="application/ld+json">{"@context": "https://schema.org", "@type": "Product", "name": "Shoe", "offers": {"price": 9.5}}</script>
+<script type="Application/LD+JSON; charset=utf-8">[1, 2]</script>
+<script type="application/json">{"ignored": true}</script>
+<script>var ignored = 1;</script>`,
+			expected: `{"jsonld":[{"@context":"https://schema.org","@type":"Product","name":"Shoe","offers":{"price":9.5}},[1,2]],"microdata":[],"rdfa":[]}`,
+		},
+		{
+			name:     "Invalid JSON-LD",
+			input:    `<script type="application/ld+json">{"name": }</script>`,
+			expected: `{"jsonld":[],"microdata":[],"rdfa":[],"errors":["invalid JSON-LD in /html/head/script: failed to parse JSON: missing value after object key"]}`,
+		},
+		{
+			name: "Microdata values",
+			input: `<div itemscope itemtype="https://schema.org/Product" itemid="/products/1">
+<h1 itemprop="name">  Running
+ shoe </h1>
+<img itemprop="image" src="shoe.png">
+<a itemprop="url sameAs" href="/shoe">Shoe</a>
+<meta itemprop="sku" content="S-1">
+<data itemprop="gtin" value="0123">GTIN</data>
+<time itemprop="releaseDate" datetime="2024-01-02">January 2</time>
+<span itemprop="color">Red</span><span itemprop="color">Blue</span>
+</div>`,
+			expected: `{"jsonld":[],"microdata":[{"type":["https://schema.org/Product"],"id":"https://example.com/products/1","properties":{"name":["Running shoe"],"image":["https://example.com/shop/shoe.png"],"url":["https://example.com/shoe"],"sameAs":["https://example.com/shoe"],"sku":["S-1"],"gtin":["0123"],"releaseDate":["2024-01-02"],"color":["Red","Blue"]}}],"rdfa":[]}`,
+		},
+		{
+			name: "Microdata nested items and itemref",
+			input: `<div itemscope itemtype="https://schema.org/Product" itemref="brand missing">
+<span itemprop="name">Shoe</span>
+<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+<span itemprop="price">9.50</span>
+</div>
+</div>
+<p id="brand" itemprop="brand">ACME</p>
+<div itemscope><span itemprop="name">Other</span></div>`,
+			expected: `{"jsonld":[],"microdata":[{"type":["https://schema.org/Product"],"properties":{"name":["Shoe"],"offers":[{"type":["https://schema.org/Offer"],"properties":{"price":["9.50"]}}],"brand":["ACME"]}},{"properties":{"name":["Other"]}}],"rdfa":[]}`,
+		},
+		{
+			name: "Microdata itemref cycle",
+			input: `<div itemscope><div id="p" itemprop="p" itemscope itemref="q"></div></div>
+<div id="q" itemprop="q" itemscope itemref="p"></div>`,
+			expected: `{"jsonld":[],"microdata":[{"properties":{"p":[{"properties":{"q":[{"properties":{}}]}}]}}],"rdfa":[]}`,
+		},
+		{
+			name: "RDFa Lite",
+			input: `<div vocab="https://schema.org/" typeof="Person" resource="#me">
+<span property="name">Alice</span>
+<a property="url" href="/alice">Home</a>
+<span property="jobTitle" content="Engineer">Works on things</span>
+<div property="address" typeof="PostalAddress">
+<span property="addressLocality">Tokyo</span>
+</div>
+<div typeof="Thing"><span property="name">Separate</span></div>
+</div>
+<p prefix="ex: https://example.org/ns#" typeof="ex:Note schema:CreativeWork"><span property="text">Note</span></p>
+<span property="name">Ignored</span>`,
+			expected: `{"jsonld":[],"microdata":[],"rdfa":[{"type":["https://schema.org/Person"],"id":"https://example.com/shop/page.html#me","properties":{"name":["Alice"],"url":["https://example.com/alice"],"jobTitle":["Engineer"],"address":[{"type":["https://schema.org/PostalAddress"],"properties":{"addressLocality":["Tokyo"]}}]}},{"type":["https://schema.org/Thing"],"properties":{"name":["Separate"]}},{"type":["https://example.org/ns#Note","http://schema.org/CreativeWork"],"properties":{"text":["Note"]}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc.Metadata = &Metadata{Source: "https://example.com/shop/page.html"}
+
+			result, err := StructuredDataToJSON(ExtractStructuredData(doc), Options{Compact: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Result mismatch\nExpected: %s\nActual:   %s", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package hj
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Table is an HTML table with its cells laid out in a grid.
+// Cells spanning several rows or columns are repeated in each of them,
+// and all rows have the same number of columns.
+type Table struct {
+	ID      string `json:"id,omitempty"`
+	Caption string `json:"caption,omitempty"`
+	// Headers holds a name for each column, made from the header rows
+	Headers []string `json:"headers,omitempty"`
+	// HeaderRows holds the rows of thead, or the leading rows of th cells without a thead
+	HeaderRows [][]string `json:"-"`
+	Rows       [][]string `json:"rows"`
+	// Footer holds the rows of tfoot
+	Footer [][]string `json:"footer,omitempty"`
+}
+
+// Limits on spans, as defined by the HTML table model
+const (
+	maxColspan = 1000
+	maxRowspan = 65534
+)
+
+// ExtractTables returns the tables of the document in document order.
+// Nested tables are returned as tables of their own and left out of the
+// text of the cells containing them.
+func ExtractTables(doc *Document) []*Table {
+	var tables []*Table
+	walkElements(doc.Children, func(n *Node) {
+		if n.Tag == "table" {
+			tables = append(tables, newTable(n))
+		}
+	})
+	return tables
+}
+
+// newTable lays out the rows of a table element
+func newTable(n *Node) *Table {
+	t := &Table{ID: n.ID, Rows: [][]string{}}
+
+	var head, body, foot [][]string
+	var rows []*Node
+	// Rows directly in the table form a group of their own
+	flush := func() {
+		body = append(body, tableGrid(rows)...)
+		rows = nil
+	}
+	for _, c := range n.Children {
+		if c.Type != ElementNode {
+			continue
+		}
+		switch c.Tag {
+		case "caption":
+			if t.Caption == "" {
+				t.Caption = cellText(c)
+			}
+		case "tr":
+			rows = append(rows, c)
+		case "thead", "tbody", "tfoot":
+			flush()
+			grid := tableGrid(childElements(c, "tr"))
+			switch {
+			case c.Tag == "thead" && head == nil:
+				head = grid
+			case c.Tag == "tfoot":
+				foot = append(foot, grid...)
+			default:
+				body = append(body, grid...)
+			}
+		}
+	}
+	flush()
+
+	// Without a thead, leading rows of header cells are the header rows
+	if head == nil {
+		header := 0
+		for _, tr := range tableRowNodes(n) {
+			if !headerRow(tr) || header >= len(body) {
+				break
+			}
+			header++
+		}
+		if header > 0 {
+			head, body = body[:header], body[header:]
+		}
+	}
+
+	width := 0
+	for _, grid := range [][][]string{head, body, foot} {
+		for _, row := range grid {
+			width = max(width, len(row))
+		}
+	}
+	t.HeaderRows = padRows(head, width)
+	t.Rows = append(t.Rows, padRows(body, width)...)
+	t.Footer = padRows(foot, width)
+	t.Headers = combineHeaders(t.HeaderRows, width)
+	return t
+}
+
+// tableRowNodes returns the rows of a table outside thead and tfoot in order
+func tableRowNodes(n *Node) []*Node {
+	var rows []*Node
+	for _, c := range n.Children {
+		switch {
+		case c.Type != ElementNode:
+		case c.Tag == "tr":
+			rows = append(rows, c)
+		case c.Tag == "tbody":
+			rows = append(rows, childElements(c, "tr")...)
+		}
+	}
+	return rows
+}
+
+// headerRow reports whether all cells of a row are th cells
+func headerRow(tr *Node) bool {
+	cells := 0
+	for _, c := range tr.Children {
+		if c.Type != ElementNode {
+			continue
+		}
+		if c.Tag == "td" {
+			return false
+		}
+		if c.Tag == "th" {
+			cells++
+		}
+	}
+	return cells > 0
+}
+
+// childElements returns the child elements of n with the given tag
+func childElements(n *Node, tag string) []*Node {
+	var elements []*Node
+	for _, c := range n.Children {
+		if c.Type == ElementNode && c.Tag == tag {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// tableGrid lays out the cells of the rows of a row group, expanding
+// rowspan and colspan. Row spans do not extend past the end of the group.
+func tableGrid(rows []*Node) [][]string {
+	grid := make([][]string, len(rows))
+	filled := make([][]bool, len(rows))
+
+	for r, tr := range rows {
+		col := 0
+		for _, cell := range tr.Children {
+			if cell.Type != ElementNode || (cell.Tag != "td" && cell.Tag != "th") {
+				continue
+			}
+			// Skip the columns taken by cells spanning from rows above
+			for col < len(filled[r]) && filled[r][col] {
+				col++
+			}
+
+			colspan := spanAttr(cell, "colspan", 1, maxColspan)
+			rowspan := spanAttr(cell, "rowspan", 0, maxRowspan)
+			if rowspan == 0 {
+				// rowspan="0" spans to the end of the group
+				rowspan = len(rows) - r
+			}
+			text := cellText(cell)
+
+			for dr := 0; dr < rowspan && r+dr < len(rows); dr++ {
+				row := r + dr
+				for len(grid[row]) < col+colspan {
+					grid[row] = append(grid[row], "")
+					filled[row] = append(filled[row], false)
+				}
+				for dc := 0; dc < colspan; dc++ {
+					grid[row][col+dc] = text
+					filled[row][col+dc] = true
+				}
+			}
+			col += colspan
+		}
+	}
+	return grid
+}
+
+// spanAttr returns the value of a colspan or rowspan attribute, which is 1
+// when missing or invalid and clamped to lower and upper
+func spanAttr(n *Node, name string, lower, upper int) int {
+	value, ok := n.Attributes[name]
+	if !ok {
+		return 1
+	}
+	span, err := strconv.Atoi(strings.Trim(value, whitespaceChars))
+	if err != nil || span < lower {
+		return 1
+	}
+	if span > upper {
+		return upper
+	}
+	return span
+}
+
+// cellText returns the text of a cell with whitespace collapsed, leaving
+// out nested tables, scripts and styles
+func cellText(n *Node) string {
+	var b strings.Builder
+	var appendCellText func(n *Node)
+	appendCellText = func(n *Node) {
+		for _, c := range n.Children {
+			switch {
+			case c.Type == TextNode:
+				b.WriteString(c.Text)
+			case c.Type == ElementNode && c.Tag == "br":
+				b.WriteByte(' ')
+			case c.Type == ElementNode && c.Tag != "table":
+				appendCellText(c)
+			}
+		}
+	}
+	appendCellText(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// padRows extends each row to width columns with empty cells
+func padRows(rows [][]string, width int) [][]string {
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// combineHeaders names each column by joining the distinct texts of its
+// header cells from top to bottom, such as "Price / Min" for a "Price"
+// cell spanning "Min" and "Max"
+func combineHeaders(rows [][]string, width int) []string {
+	if len(rows) == 0 {
+		return nil
+	}
+	headers := make([]string, width)
+	for col := range headers {
+		var parts []string
+		for _, row := range rows {
+			text := row[col]
+			if text != "" && (len(parts) == 0 || parts[len(parts)-1] != text) {
+				parts = append(parts, text)
+			}
+		}
+		headers[col] = strings.Join(parts, " / ")
+	}
+	return headers
+}
+
+// Keys returns the names used for the columns in Records: the headers, with
+// "column N" for columns without a header and a number added to repeated names
+func (t *Table) Keys() []string {
+	width := len(t.Headers)
+	if width == 0 && len(t.Rows) > 0 {
+		width = len(t.Rows[0])
+	}
+
+	keys := make([]string, width)
+	seen := map[string]int{}
+	for i := range keys {
+		key := ""
+		if i < len(t.Headers) {
+			key = t.Headers[i]
+		}
+		if key == "" {
+			key = fmt.Sprintf("column %d", i+1)
+		}
+		// seen counts both the headers and the numbered names made from them,
+		// so that a numbered name never repeats a key used before
+		name := key
+		for n := seen[key]; seen[name] > 0; {
+			n++
+			name = fmt.Sprintf("%s %d", key, n)
+		}
+		seen[key]++
+		if name != key {
+			seen[name]++
+		}
+		keys[i] = name
+	}
+	return keys
+}
+
+// Records returns the body rows as objects keyed by Keys
+func (t *Table) Records() []Object {
+	keys := t.Keys()
+	records := make([]Object, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		record := make(Object, len(keys))
+		for i, key := range keys {
+			record[i] = Field{Key: key, Value: row[i]}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// WriteCSV writes the table as CSV: the headers if there are any, the body
+// rows and the footer rows
+func (t *Table) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if t.Headers != nil {
+		cw.Write(t.Headers)
+	}
+	cw.WriteAll(append(append([][]string{}, t.Rows...), t.Footer...))
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return nil
+}
+
+// TablesToJSON writes tables as JSON. With records set, the body rows are
+// written as objects keyed by the column names instead of arrays.
+func TablesToJSON(tables []*Table, records bool, opts Options) ([]byte, error) {
+	items := make([]interface{}, len(tables))
+	for i, t := range tables {
+		if !records {
+			items[i] = t
+			continue
+		}
+		obj := Object{}
+		if t.ID != "" {
+			obj = append(obj, Field{Key: "id", Value: t.ID})
+		}
+		if t.Caption != "" {
+			obj = append(obj, Field{Key: "caption", Value: t.Caption})
+		}
+		obj = append(obj, Field{Key: "headers", Value: t.Keys()}, Field{Key: "rows", Value: t.Records()})
+		if len(t.Footer) > 0 {
+			obj = append(obj, Field{Key: "footer", Value: t.Footer})
+		}
+		items[i] = obj
+	}
+	return marshalJSON(items, opts)
+}
+
+// WriteTablesCSV writes tables as CSV, separated by empty lines
+func WriteTablesCSV(w io.Writer, tables []*Table) error {
+	var buf bytes.Buffer
+	for i, t := range tables {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		if err := t.WriteCSV(&buf); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,177 @@
+package hj
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExtractTables tests laying out tables with spans and row groups
+func TestExtractTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected []*Table
+	}{
+		{
+			name: "Header row without thead",
+			html: `<table><tr><th>Name</th><th>Price</th></tr><tr><td>A</td><td> 1 <b>00</b></td></tr></table>`,
+			expected: []*Table{{
+				Headers:    []string{"Name", "Price"},
+				HeaderRows: [][]string{{"Name", "Price"}},
+				Rows:       [][]string{{"A", "1 00"}},
+			}},
+		},
+		{
+			name: "Multiple header rows and spans",
+			html: `<table id="prices"><caption> Prices </caption>` +
+				`<thead><tr><th rowspan="2">Item</th><th colspan="2">Price</th></tr><tr><th>Min</th><th>Max</th></tr></thead>` +
+				`<tfoot><tr><td>Total</td><td colspan="2">9</td></tr></tfoot>` +
+				`<tbody><tr><td rowspan="2">A</td><td>1</td><td>2</td></tr><tr><td colspan="2">3<br>4</td></tr><tr><td>B</td></tr></tbody></table>`,
+			expected: []*Table{{
+				ID:         "prices",
+				Caption:    "Prices",
+				Headers:    []string{"Item", "Price / Min", "Price / Max"},
+				HeaderRows: [][]string{{"Item", "Price", "Price"}, {"Item", "Min", "Max"}},
+				Rows:       [][]string{{"A", "1", "2"}, {"A", "3 4", "3 4"}, {"B", "", ""}},
+				Footer:     [][]string{{"Total", "9", "9"}},
+			}},
+		},
+		{
+			name: "Row spans end with the row group",
+			html: `<table><tbody><tr><td rowspan="5">a</td><td>b</td></tr></tbody><tbody><tr><td>c</td><td rowspan="0">d</td></tr><tr><td>e</td></tr></tbody></table>`,
+			expected: []*Table{{
+				Rows: [][]string{{"a", "b"}, {"c", "d"}, {"e", "d"}},
+			}},
+		},
+		{
+			name: "Invalid spans",
+			html: `<table><tr><td colspan="0">a</td><td rowspan="x" colspan=" 2 ">b</td></tr></table>`,
+			expected: []*Table{{
+				Rows: [][]string{{"a", "b", "b"}},
+			}},
+		},
+		{
+			name: "Nested table",
+			html: `<table><tr><td>a<table><tr><td>n</td></tr></table></td></tr></table>`,
+			expected: []*Table{
+				{Rows: [][]string{{"a"}}},
+				{Rows: [][]string{{"n"}}},
+			},
+		},
+		{
+			name:     "No tables",
+			html:     `<p>text</p>`,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			tables := ExtractTables(doc)
+			if len(tables) != len(tt.expected) {
+				t.Fatalf("Expected %d tables, got %d", len(tt.expected), len(tables))
+			}
+			for i, table := range tables {
+				if !reflect.DeepEqual(table, tt.expected[i]) {
+					t.Errorf("Expected %+v, got %+v", tt.expected[i], table)
+				}
+			}
+		})
+	}
+}
+
+// TestTable_Records tests the column names of row objects
+func TestTable_Records(t *testing.T) {
+	table := &Table{
+		Headers: []string{"a", "", "a"},
+		Rows:    [][]string{{"1", "2", "3"}},
+	}
+	if keys := table.Keys(); !reflect.DeepEqual(keys, []string{"a", "column 2", "a 2"}) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	records := table.Records()
+	expected := []Object{{{Key: "a", Value: "1"}, {Key: "column 2", Value: "2"}, {Key: "a 2", Value: "3"}}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected %v, got %v", expected, records)
+	}
+
+	// Tables without headers are keyed by column number
+	table = &Table{Rows: [][]string{{"x", "y"}}}
+	if keys := table.Keys(); !reflect.DeepEqual(keys, []string{"column 1", "column 2"}) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	// Numbered names never repeat a header or another numbered name
+	headers := [][]string{
+		{"A", "A", "A 2"},
+		{"A 2", "A", "A", "A"},
+		{"column 2", "", "column 2"},
+	}
+	expectedKeys := [][]string{
+		{"A", "A 2", "A 2 2"},
+		{"A 2", "A", "A 3", "A 4"},
+		{"column 2", "column 2 2", "column 2 3"},
+	}
+	for i, h := range headers {
+		table = &Table{Headers: h}
+		if keys := table.Keys(); !reflect.DeepEqual(keys, expectedKeys[i]) {
+			t.Errorf("Keys of %q: expected %q, got %q", h, expectedKeys[i], keys)
+		}
+	}
+}
+
+// TestTablesToJSON tests writing tables with rows as arrays and objects
+func TestTablesToJSON(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<table><caption>C</caption><tr><th>k</th></tr><tr><td>v</td></tr><tfoot><tr><td>f</td></tr></tfoot></table>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tables := ExtractTables(doc)
+
+	data, err := TablesToJSON(tables, false, Options{Compact: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `[{"caption":"C","headers":["k"],"rows":[["v"]],"footer":[["f"]]}]`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	data, err = TablesToJSON(tables, true, Options{Compact: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = `[{"caption":"C","headers":["k"],"rows":[{"k":"v"}],"footer":[["f"]]}]`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	data, err = TablesToJSON(nil, false, Options{})
+	if err != nil || string(data) != "[]" {
+		t.Errorf("Expected empty array, got %s (%v)", data, err)
+	}
+}
+
+// TestWriteTablesCSV tests writing tables as CSV
+func TestWriteTablesCSV(t *testing.T) {
+	tables := []*Table{
+		{Headers: []string{"Name", "Note"}, Rows: [][]string{{"A", `say "hi", bye`}}, Footer: [][]string{{"Total", ""}}},
+		{Rows: [][]string{{"1"}}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTablesCSV(&buf, tables); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "Name,Note\nA,\"say \"\"hi\"\", bye\"\nTotal,\n\n1\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
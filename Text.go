@@ -0,0 +1,623 @@
+package hj
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// TextEncoder writes the visible text of a document. Blocks such as
+// paragraphs and headings are separated by blank lines, list items get
+// bullets or numbers, tables are laid out in columns, and scripts, styles,
+// templates and elements with the hidden attribute are left out.
+type TextEncoder struct{}
+
+// MarkdownEncoder writes a document as CommonMark, with headings, links,
+// images, emphasis, code, lists and block quotes in Markdown syntax.
+// Tables are written as GitHub Flavored Markdown tables.
+type MarkdownEncoder struct{}
+
+// Encode writes the document held in v as text. Text next to elements
+// is only kept in output written with Options.MixedContent or Options.Lossless.
+func (e TextEncoder) Encode(w io.Writer, v interface{}) error {
+	return encodeDocumentValue(w, v, e)
+}
+
+// EncodeDocument writes the visible text of doc
+func (e TextEncoder) EncodeDocument(w io.Writer, doc *Document) error {
+	return renderText(w, doc, false)
+}
+
+// Encode writes the document held in v as Markdown. Text next to elements
+// is only kept in output written with Options.MixedContent or Options.Lossless.
+func (e MarkdownEncoder) Encode(w io.Writer, v interface{}) error {
+	return encodeDocumentValue(w, v, e)
+}
+
+// EncodeDocument writes doc as Markdown. Links and images are resolved
+// against the base URL of the document.
+func (e MarkdownEncoder) EncodeDocument(w io.Writer, doc *Document) error {
+	return renderText(w, doc, true)
+}
+
+// encodeDocumentValue rebuilds the document held in v and writes it with enc
+func encodeDocumentValue(w io.Writer, v interface{}, enc DocumentEncoder) error {
+	doc, err := documentFromValue(plainValue(v))
+	if err != nil {
+		return err
+	}
+	return enc.EncodeDocument(w, doc)
+}
+
+// renderText writes doc as text, or as Markdown when markdown is set
+func renderText(w io.Writer, doc *Document, markdown bool) error {
+	r := &textRenderer{w: newTextWriter(), markdown: markdown, base: doc.BaseURL()}
+	r.nodes(doc.Children)
+	_, err := io.WriteString(w, r.w.String())
+	return err
+}
+
+// textBlockTags lists the elements that start on a line of their own
+var textBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "caption": true, "details": true,
+	"dialog": true, "dd": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "header": true, "hgroup": true, "legend": true, "main": true,
+	"nav": true, "p": true, "section": true, "summary": true, "tr": true,
+}
+
+// textParagraphTags lists the block elements separated from other blocks by a blank line
+var textParagraphTags = map[string]bool{
+	"p": true, "blockquote": true, "dl": true, "figure": true, "hgroup": true,
+}
+
+// textHiddenTags lists the elements whose content is not rendered
+var textHiddenTags = map[string]bool{
+	"head": true, "script": true, "style": true, "template": true, "noscript": true,
+	"select": true, "datalist": true,
+}
+
+// textRenderer renders the nodes of a document to a textWriter
+type textRenderer struct {
+	w        *textWriter
+	markdown bool
+	base     *url.URL
+	// lists holds the number of the next item of each list being rendered,
+	// or -1 for unordered lists
+	lists []int
+}
+
+// nodes renders nodes in order
+func (r *textRenderer) nodes(nodes []*Node) {
+	for _, n := range nodes {
+		switch n.Type {
+		case TextNode:
+			r.w.text(n.Text, r.escape)
+		case ElementNode:
+			r.element(n)
+		}
+	}
+}
+
+// escape escapes text for Markdown, leaving plain text as it is
+func (r *textRenderer) escape(s string, lineStart bool) string {
+	if !r.markdown {
+		return s
+	}
+	return escapeMarkdown(s, lineStart)
+}
+
+// block renders the children of n on lines of their own, separated from
+// the surrounding blocks by blank lines when paragraph is set. Every block
+// is a paragraph in Markdown, where single line breaks do not end one.
+func (r *textRenderer) block(n *Node, paragraph bool) {
+	lines := 1
+	if paragraph || r.markdown {
+		lines = 2
+	}
+	r.w.breakLines(lines)
+	r.nodes(n.Children)
+	r.w.breakLines(lines)
+}
+
+// element renders an element and its content
+func (r *textRenderer) element(n *Node) {
+	if _, hidden := n.Attributes["hidden"]; hidden || textHiddenTags[n.Tag] {
+		return
+	}
+
+	switch n.Tag {
+	case "br":
+		r.w.hardBreak = r.markdown
+		r.w.lineBreak()
+
+	case "hr":
+		r.w.breakLines(2)
+		r.w.write("---")
+		r.w.breakLines(2)
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.w.breakLines(2)
+		if r.markdown {
+			level, _ := strconv.Atoi(n.Tag[1:])
+			r.w.write(strings.Repeat("#", level) + " " + r.inlineText(n))
+		} else {
+			r.nodes(n.Children)
+		}
+		r.w.breakLines(2)
+
+	case "pre":
+		r.preformatted(n)
+
+	case "ul", "ol", "menu":
+		r.list(n)
+
+	case "li":
+		r.listItem(n)
+
+	case "blockquote":
+		prefix := r.w.prefix
+		r.w.breakLines(2)
+		if r.markdown {
+			r.w.prefix += "> "
+		} else {
+			r.w.prefix += "    "
+		}
+		r.nodes(n.Children)
+		r.w.breakLines(2)
+		r.w.prefix = prefix
+
+	case "table":
+		r.w.breakLines(2)
+		if r.markdown {
+			r.markdownTable(newTable(n))
+		} else {
+			r.textTable(newTable(n))
+		}
+		r.w.breakLines(2)
+
+	case "a":
+		href, ok := n.Attributes["href"]
+		if !r.markdown || !ok || strings.HasPrefix(strings.ToLower(strings.Trim(href, whitespaceChars)), "javascript:") {
+			r.nodes(n.Children)
+			return
+		}
+		text, ok := r.inline(n)
+		if !ok {
+			r.nodes(n.Children)
+			return
+		}
+		if text == "" {
+			text = escapeMarkdown(href, false)
+		}
+		r.w.inline(n, "["+text+"]("+markdownDestination(resolveURL(r.base, href))+")")
+
+	case "img":
+		src, ok := n.Attributes["src"]
+		if r.markdown && ok {
+			r.w.write("![" + escapeMarkdown(strings.Join(strings.Fields(n.Attributes["alt"]), " "), false) + "](" +
+				markdownDestination(resolveURL(r.base, src)) + ")")
+		}
+
+	case "strong", "b":
+		r.emphasis(n, "**")
+
+	case "em", "i":
+		r.emphasis(n, "*")
+
+	case "code", "kbd", "samp", "tt":
+		if !r.markdown {
+			r.nodes(n.Children)
+			return
+		}
+		r.w.inline(n, markdownCodeSpan(strings.Join(strings.Fields(textContent(n)), " ")))
+
+	default:
+		if textBlockTags[n.Tag] {
+			r.block(n, textParagraphTags[n.Tag])
+			return
+		}
+		r.nodes(n.Children)
+	}
+}
+
+// inline renders the children of n in the same format on a single line.
+// It returns false when the content does not fit on one line.
+func (r *textRenderer) inline(n *Node) (string, bool) {
+	sub := &textRenderer{w: newTextWriter(), markdown: r.markdown, base: r.base}
+	sub.nodes(n.Children)
+	text := sub.w.b.String()
+	return text, !strings.Contains(text, "\n")
+}
+
+// inlineText renders the children of n on a single line, joining the lines
+// of content that does not fit on one
+func (r *textRenderer) inlineText(n *Node) string {
+	text, _ := r.inline(n)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// emphasis renders the content of n between Markdown delimiters
+func (r *textRenderer) emphasis(n *Node, delimiter string) {
+	if !r.markdown {
+		r.nodes(n.Children)
+		return
+	}
+	text, ok := r.inline(n)
+	if !ok || text == "" {
+		r.nodes(n.Children)
+		return
+	}
+	r.w.inline(n, delimiter+text+delimiter)
+}
+
+// preformatted renders a pre element keeping its whitespace, as a fenced
+// code block in Markdown with the language taken from a "language-" class
+func (r *textRenderer) preformatted(n *Node) {
+	text := strings.TrimSuffix(textContent(n), "\n")
+	r.w.breakLines(2)
+	if !r.markdown {
+		r.w.preformatted(text)
+		r.w.breakLines(2)
+		return
+	}
+
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	language := ""
+	if code := firstChildElement(n, "code"); code != nil {
+		for _, class := range strings.Fields(code.Attributes["class"]) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				language = lang
+				break
+			}
+		}
+	}
+	r.w.write(fence + language)
+	r.w.lineBreak()
+	r.w.preformatted(text)
+	r.w.lineBreak()
+	r.w.write(fence)
+	r.w.breakLines(2)
+}
+
+// list renders a list, numbering the items of ordered lists from the start attribute
+func (r *textRenderer) list(n *Node) {
+	lines := 2
+	if len(r.lists) > 0 {
+		lines = 1
+	}
+	next := -1
+	if n.Tag == "ol" {
+		next = 1
+		if start, err := strconv.Atoi(strings.Trim(n.Attributes["start"], whitespaceChars)); err == nil {
+			next = start
+		}
+	}
+
+	r.w.breakLines(lines)
+	r.lists = append(r.lists, next)
+	r.nodes(n.Children)
+	r.lists = r.lists[:len(r.lists)-1]
+	r.w.breakLines(lines)
+}
+
+// listItem renders a list item after its bullet or number, indenting its
+// following lines to line up with the first
+func (r *textRenderer) listItem(n *Node) {
+	marker := "* "
+	if r.markdown {
+		marker = "- "
+	}
+	if last := len(r.lists) - 1; last >= 0 && r.lists[last] >= 0 {
+		marker = strconv.Itoa(r.lists[last]) + ". "
+		r.lists[last]++
+	}
+
+	prefix := r.w.prefix
+	r.w.breakLines(1)
+	r.w.marker = prefix + marker
+	r.w.prefix = prefix + strings.Repeat(" ", len(marker))
+	r.nodes(n.Children)
+	if r.w.marker != "" {
+		// An empty item still gets its bullet
+		r.w.marker = ""
+		r.w.prefix = prefix
+		r.w.write(strings.TrimRight(marker, " "))
+	}
+	r.w.breakLines(1)
+	r.w.prefix = prefix
+}
+
+// textTable lays out a table in columns separated by two spaces, with a
+// line of dashes under the header rows
+func (r *textRenderer) textTable(t *Table) {
+	rows := append(append(append([][]string{}, t.HeaderRows...), t.Rows...), t.Footer...)
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for col, cell := range row {
+			widths[col] = max(widths[col], textWidth(cell))
+		}
+	}
+
+	if t.Caption != "" {
+		r.w.write(t.Caption)
+		r.w.lineBreak()
+	}
+	writeRow := func(row []string) {
+		var b strings.Builder
+		for col, cell := range row {
+			if col > 0 {
+				b.WriteString("  ")
+			}
+			b.WriteString(cell + strings.Repeat(" ", widths[col]-textWidth(cell)))
+		}
+		r.w.write(strings.TrimRight(b.String(), " "))
+		r.w.lineBreak()
+	}
+	for i, row := range rows {
+		writeRow(row)
+		if i == len(t.HeaderRows)-1 {
+			rule := make([]string, len(widths))
+			for col, w := range widths {
+				rule[col] = strings.Repeat("-", max(w, 1))
+			}
+			writeRow(rule)
+		}
+	}
+}
+
+// markdownTable writes a table as a GitHub Flavored Markdown table. The
+// first row is the header when the table has no header rows.
+func (r *textRenderer) markdownTable(t *Table) {
+	header, rows := t.Headers, append(append([][]string{}, t.Rows...), t.Footer...)
+	if header == nil {
+		if len(rows) == 0 || len(rows[0]) == 0 {
+			return
+		}
+		header, rows = rows[0], rows[1:]
+	}
+
+	if t.Caption != "" {
+		r.w.write(escapeMarkdown(t.Caption, true))
+		r.w.breakLines(2)
+	}
+	writeRow := func(row []string) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.ReplaceAll(escapeMarkdown(cell, false), "|", `\|`)
+		}
+		r.w.write("| " + strings.Join(cells, " | ") + " |")
+		r.w.lineBreak()
+	}
+	writeRow(header)
+	r.w.write("|" + strings.Repeat(" --- |", len(header)))
+	r.w.lineBreak()
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
+
+// textWidth returns the number of columns text takes in a terminal,
+// counting wide East Asian characters as two
+func textWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// escapeMarkdown escapes the characters of text that Markdown would read
+// as syntax, including list and heading markers at the start of a line
+func escapeMarkdown(s string, lineStart bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_[]<>", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	escaped := b.String()
+	if !lineStart || escaped == "" {
+		return escaped
+	}
+
+	if strings.ContainsRune("#-+=~", rune(escaped[0])) {
+		return `\` + escaped
+	}
+	digits := len(escaped) - len(strings.TrimLeft(escaped, "0123456789"))
+	if digits > 0 && digits < len(escaped) && (escaped[digits] == '.' || escaped[digits] == ')') {
+		return escaped[:digits] + `\` + escaped[digits:]
+	}
+	return escaped
+}
+
+// markdownDestination returns a URL as the destination of a Markdown link,
+// in angle brackets when it contains spaces or parentheses
+func markdownDestination(u string) string {
+	if !strings.ContainsAny(u, " ()<>") {
+		return u
+	}
+	return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(u) + ">"
+}
+
+// markdownCodeSpan returns text as a Markdown code span, using more
+// backticks than any run of backticks in the text
+func markdownCodeSpan(text string) string {
+	if text == "" {
+		return ""
+	}
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+// textWriter lays out text in lines and blocks. Whitespace in text is
+// collapsed, and the line breaks requested between blocks are only written
+// before the next text, so that output never starts or ends with empty lines.
+type textWriter struct {
+	b strings.Builder
+	// lines is the number of line breaks to write before the next text
+	lines int
+	// space is set when a space is due before the next text on the same line
+	space bool
+	// lineStart is set when the next text starts a line
+	lineStart bool
+	// prefix is written at the start of every line, such as "> " in block quotes
+	prefix string
+	// marker is written instead of prefix at the start of the next line, such as "1. "
+	marker string
+	// linePrefix is the prefix of the last line written
+	linePrefix string
+	// hardBreak is set when a single line break is written as a Markdown hard line break
+	hardBreak bool
+}
+
+// newTextWriter returns a textWriter at the start of the first line
+func newTextWriter() *textWriter {
+	return &textWriter{lineStart: true}
+}
+
+// String returns the text written so far, ending with a newline unless it is empty
+func (w *textWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := strings.Join(lines, "\n")
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// breakLines requests n line breaks before the next text: 1 to start a new
+// line and 2 to leave a blank line
+func (w *textWriter) breakLines(n int) {
+	if w.b.Len() > 0 && n > w.lines {
+		w.lines = n
+	}
+	w.space = false
+}
+
+// lineBreak requests one more line break before the next text, as a br element does
+func (w *textWriter) lineBreak() {
+	if w.b.Len() > 0 && w.lines < 2 {
+		w.lines++
+	}
+	w.space = false
+}
+
+// atLineStart reports whether the next text starts a line
+func (w *textWriter) atLineStart() bool {
+	return w.lineStart || w.lines > 0
+}
+
+// flush writes the line breaks due before the next text
+func (w *textWriter) flush() {
+	if w.lines == 0 {
+		return
+	}
+	if w.hardBreak && w.lines == 1 {
+		w.b.WriteByte('\\')
+	}
+	// Blank lines only keep the prefix shared by the lines around them,
+	// so that they do not extend a block quote being entered or left
+	blank := w.prefix
+	for !strings.HasPrefix(w.linePrefix, blank) {
+		blank = blank[:len(blank)-1]
+	}
+	for i := 1; i < w.lines; i++ {
+		w.b.WriteString("\n" + strings.TrimRight(blank, " "))
+	}
+	w.b.WriteString("\n")
+	w.lines = 0
+	w.lineStart = true
+}
+
+// write writes s as it is after the due line breaks, prefix and space
+func (w *textWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	w.flush()
+	switch {
+	case w.lineStart && w.marker != "":
+		w.b.WriteString(w.marker)
+		w.marker = ""
+		w.linePrefix = w.prefix
+	case w.lineStart:
+		w.b.WriteString(w.prefix)
+		w.linePrefix = w.prefix
+	case w.space:
+		w.b.WriteByte(' ')
+	}
+	w.lineStart = false
+	w.space = false
+	w.hardBreak = false
+	w.b.WriteString(s)
+}
+
+// text writes text with its whitespace collapsed, passing each word to escape
+func (w *textWriter) text(s string, escape func(s string, lineStart bool) string) {
+	isSpace := func(r rune) bool { return strings.ContainsRune(whitespaceChars, r) }
+	words := strings.FieldsFunc(s, isSpace)
+	if s != "" && isSpace(rune(s[0])) {
+		w.space = true
+	}
+	for i, word := range words {
+		if i > 0 {
+			w.space = true
+		}
+		w.write(escape(word, w.atLineStart()))
+	}
+	if len(words) > 0 && isSpace(rune(s[len(s)-1])) {
+		w.space = true
+	}
+}
+
+// inline writes s, rendered from the content of n, keeping the spaces at the edges of the content
+func (w *textWriter) inline(n *Node, s string) {
+	text := textContent(n)
+	if text != "" && strings.ContainsRune(whitespaceChars, rune(text[0])) {
+		w.space = true
+	}
+	w.write(s)
+	if text != "" && strings.ContainsRune(whitespaceChars, rune(text[len(text)-1])) {
+		w.space = true
+	}
+}
+
+// preformatted writes text keeping its whitespace and line breaks
+func (w *textWriter) preformatted(text string) {
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			w.flush()
+			w.b.WriteString("\n")
+			w.lineStart = true
+		}
+		if line == "" {
+			continue
+		}
+		w.space = false
+		w.write(line)
+	}
+}
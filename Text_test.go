@@ -0,0 +1,151 @@
+package hj
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestTextEncoder tests rendering the visible text of documents
+func TestTextEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Paragraphs and line breaks",
+			input:    "<h1>Title</h1><p>Some   <b>bold</b>\ntext<br>next line</p><div>one</div><div>two</div>",
+			expected: "Title\n\nSome bold text\nnext line\n\none\ntwo\n",
+		},
+		{
+			name:     "Hidden elements",
+			input:    `<p>shown</p><script>x()</script><style>p{}</style><template><p>t</p></template><p hidden>h</p><select><option>o</option></select>`,
+			expected: "shown\n",
+		},
+		{
+			name:     "Lists",
+			input:    `<ul><li>One</li><li>Two<ol start="3"><li>Three</li><li>Four</li></ol></li><li></li></ul>`,
+			expected: "* One\n* Two\n  3. Three\n  4. Four\n*\n",
+		},
+		{
+			name:     "Table",
+			input:    `<table><caption>Prices</caption><tr><th>Name</th><th>Price</th></tr><tr><td>りんご</td><td>100</td></tr><tr><td colspan="2">Total</td></tr></table>`,
+			expected: "Prices\nName    Price\n------  -----\nりんご  100\nTotal   Total\n",
+		},
+		{
+			name:     "Preformatted text and quotes",
+			input:    "<p>Code:</p><pre>  a\n\n  b</pre><blockquote><p>quoted</p></blockquote>",
+			expected: "Code:\n\n  a\n\n  b\n\n    quoted\n",
+		},
+		{
+			name:     "Empty document",
+			input:    "<!-- comment -->",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseFragment(strings.NewReader(tt.input), "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := doc.Encode(&buf, TextEncoder{}, Options{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+// TestMarkdownEncoder tests rendering documents as Markdown
+func TestMarkdownEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Headings and inline markup",
+			input:    `<h2>Sub <em>title</em></h2><p>A <strong>bold</strong> <a href="/docs">link</a>, <code>a` + "`" + `b</code> and <img src="a(1).png" alt="pic">.</p>`,
+			expected: "## Sub *title*\n\nA **bold** [link](https://example.com/docs), ``a`b`` and ![pic](<https://example.com/a(1).png>).\n",
+		},
+		{
+			name:     "Escaping",
+			input:    `<p>1. *not* [a] list<br># not a heading</p>`,
+			expected: "1\\. \\*not\\* \\[a\\] list\\\n\\# not a heading\n",
+		},
+		{
+			name:     "Lists",
+			input:    `<ul><li>One</li><li>Two<ol><li>Nested</li></ol></li></ul><p>After</p>`,
+			expected: "- One\n- Two\n  1. Nested\n\nAfter\n",
+		},
+		{
+			name:     "Code block",
+			input:    "<pre><code class=\"language-go\">x := 1\n```\n</code></pre>",
+			expected: "````go\nx := 1\n```\n````\n",
+		},
+		{
+			name:     "Block quote",
+			input:    `<p>Before</p><blockquote><p>One</p><p>Two</p></blockquote><p>After</p>`,
+			expected: "Before\n\n> One\n>\n> Two\n\nAfter\n",
+		},
+		{
+			name:     "Table",
+			input:    `<table><thead><tr><th>Name</th><th>Note</th></tr></thead><tr><td>a|b</td><td>*x*</td></tr></table>`,
+			expected: "| Name | Note |\n| --- | --- |\n| a\\|b | \\*x\\* |\n",
+		},
+		{
+			name:     "Table without a header",
+			input:    `<table><tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr></table>`,
+			expected: "| a | b |\n| --- | --- |\n| c | d |\n",
+		},
+		{
+			name:     "Rule and divisions",
+			input:    `<div>one</div><hr><div>two</div>`,
+			expected: "one\n\n---\n\ntwo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseFragment(strings.NewReader(tt.input), "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc.Metadata = &Metadata{Source: "https://example.com/index.html"}
+			var buf bytes.Buffer
+			if err := doc.Encode(&buf, MarkdownEncoder{}, Options{}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+// TestTextEncoder_Transcode tests rendering text from JSON produced by hj
+func TestTextEncoder_Transcode(t *testing.T) {
+	input := `[{"p":{"child":["Hello ",{"b":{"child":"world"}},"!"]}},{"ul":{"child":[{"li":{"child":"item"}}]}}]`
+
+	var buf bytes.Buffer
+	if err := Transcode(&buf, []byte(input), TextEncoder{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "Hello world!\n\n* item\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := Transcode(&buf, []byte(input), MarkdownEncoder{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "Hello **world**!\n\n- item\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,1407 @@
+package hj
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// XPathNode is a node selected by an XPath expression.
+// Node is nil for the root node of the document. For an attribute node,
+// Node is the element that has the attribute and Attribute is its name.
+type XPathNode struct {
+	Node      *Node
+	Attribute string
+}
+
+// XPath is a compiled XPath 1.0 expression
+type XPath struct {
+	source string
+	expr   xpathExpr
+}
+
+// CompileXPath parses an XPath 1.0 expression.
+// All axes, node tests, predicates, operators and the functions of the
+// XPath 1.0 core library are supported. Variables and namespaces are not.
+func CompileXPath(expr string) (*XPath, error) {
+	tokens, err := tokenizeXPath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath %q: %v", expr, err)
+	}
+
+	p := &xpathParser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err == nil && p.peek().kind != xpathEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath %q: %v", expr, err)
+	}
+	return &XPath{source: expr, expr: e}, nil
+}
+
+// EvaluateXPath evaluates an XPath 1.0 expression with the root of doc as the
+// context node. The result is a []XPathNode in document order, a string,
+// a float64 or a bool, depending on the expression.
+func EvaluateXPath(doc *Document, expr string) (interface{}, error) {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return x.Evaluate(doc)
+}
+
+// Evaluate evaluates x with the root of doc as the context node.
+// See EvaluateXPath for the result types.
+func (x *XPath) Evaluate(doc *Document) (interface{}, error) {
+	c := &xpathContext{state: &xpathState{doc: doc}, position: 1, size: 1}
+	result, err := x.expr.eval(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate XPath %q: %v", x.source, err)
+	}
+	return result, nil
+}
+
+// XPathToJSON evaluates an XPath expression and writes the result as JSON text.
+// A node-set is written as an array in which elements are hj JSON elements,
+// attributes and text are strings, and comments are {"#comment": "text"}.
+// Strings, numbers and booleans are written as JSON values.
+func (d *Document) XPathToJSON(expr string, opts Options) ([]byte, error) {
+	result, err := EvaluateXPath(d, expr)
+	if err != nil {
+		return nil, err
+	}
+	return d.marshal(d.xpathResultToJSON(result, opts), opts)
+}
+
+// xpathResultToJSON converts an XPath result to the JSON structure
+func (d *Document) xpathResultToJSON(result interface{}, opts Options) interface{} {
+	switch v := result.(type) {
+	case []XPathNode:
+		items := []interface{}{}
+		for _, n := range v {
+			var item interface{}
+			switch {
+			case n.Node == nil:
+				item = d.toJSON(opts)
+			case n.Attribute != "":
+				item = n.Value()
+			case n.Node.Type == CommentNode || n.Node.Type == ProcessingInstructionNode:
+				// Comments are written when they are selected explicitly
+				commentOpts := opts
+				commentOpts.KeepComments = true
+				item = nodeToJSON(n.Node, commentOpts)
+			default:
+				item = nodeToJSON(n.Node, opts)
+			}
+			if item != nil {
+				items = append(items, item)
+			}
+		}
+		return items
+	case float64:
+		// NaN and infinity have no JSON representation
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return xpathNumberToString(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Value returns the string-value of the node as defined by XPath
+func (n XPathNode) Value() string {
+	switch {
+	case n.Node == nil:
+		return ""
+	case n.Attribute != "":
+		val, _ := n.Node.Attr(n.Attribute)
+		return val
+	}
+
+	switch n.Node.Type {
+	case ElementNode:
+		var b strings.Builder
+		appendText(&b, n.Node)
+		return b.String()
+	case ProcessingInstructionNode:
+		_, data := splitProcessingInstruction(n.Node.Text)
+		return data
+	default:
+		return n.Node.Text
+	}
+}
+
+// appendText writes the text of all text descendants of n to b
+func appendText(b *strings.Builder, n *Node) {
+	for _, c := range n.Children {
+		switch c.Type {
+		case TextNode, RawTextNode:
+			b.WriteString(c.Text)
+		case ElementNode:
+			appendText(b, c)
+		}
+	}
+}
+
+// splitProcessingInstruction splits the text of a processing instruction into its target and data
+func splitProcessingInstruction(text string) (string, string) {
+	i := strings.IndexAny(text, whitespaceChars)
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], strings.TrimLeft(text[i:], whitespaceChars)
+}
+
+// attributeNames returns the attribute names of an element in document order,
+// with id first and the others sorted
+func attributeNames(n *Node) []string {
+	var names []string
+	if n.ID != "" {
+		names = append(names, "id")
+	}
+	keys := make([]string, 0, len(n.Attributes))
+	for key := range n.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return append(names, keys...)
+}
+
+// xpathState holds what is shared by all contexts of one evaluation
+type xpathState struct {
+	doc   *Document
+	order map[*Node]int
+}
+
+// xpathContext is the context an expression is evaluated in
+type xpathContext struct {
+	state    *xpathState
+	node     XPathNode
+	position int
+	size     int
+}
+
+// with returns a context for n at the given position
+func (c *xpathContext) with(n XPathNode, position, size int) *xpathContext {
+	return &xpathContext{state: c.state, node: n, position: position, size: size}
+}
+
+// orderKey returns the position of n in document order
+func (s *xpathState) orderKey(n XPathNode) (int, int) {
+	if n.Node == nil {
+		return -1, 0
+	}
+	if s.order == nil {
+		s.order = make(map[*Node]int)
+		var walk func(nodes []*Node)
+		walk = func(nodes []*Node) {
+			for _, c := range nodes {
+				s.order[c] = len(s.order)
+				walk(c.Children)
+			}
+		}
+		walk(s.doc.Children)
+	}
+	if n.Attribute == "" {
+		return s.order[n.Node], 0
+	}
+	return s.order[n.Node], indexOfString(attributeNames(n.Node), n.Attribute) + 1
+}
+
+// sortNodes sorts nodes in document order and removes duplicates
+func (s *xpathState) sortNodes(nodes []XPathNode) []XPathNode {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		ai, aj := s.orderKey(nodes[i])
+		bi, bj := s.orderKey(nodes[j])
+		return ai < bi || (ai == bi && aj < bj)
+	})
+	result := nodes[:0]
+	for i, n := range nodes {
+		if i == 0 || n != nodes[i-1] {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// children returns the child nodes of n, leaving out doctypes
+func (s *xpathState) children(n XPathNode) []XPathNode {
+	if n.Attribute != "" {
+		return nil
+	}
+	nodes := s.doc.Children
+	if n.Node != nil {
+		nodes = n.Node.Children
+	}
+	var children []XPathNode
+	for _, c := range nodes {
+		if c.Type != DoctypeNode {
+			children = append(children, XPathNode{Node: c})
+		}
+	}
+	return children
+}
+
+// parent returns the parent of n and false for the root node
+func (s *xpathState) parent(n XPathNode) (XPathNode, bool) {
+	switch {
+	case n.Node == nil:
+		return XPathNode{}, false
+	case n.Attribute != "":
+		return XPathNode{Node: n.Node}, true
+	case n.Node.Parent == nil:
+		return XPathNode{}, true
+	}
+	return XPathNode{Node: n.Node.Parent}, true
+}
+
+// siblings returns the siblings of n before and after it.
+// The preceding siblings are in reverse document order.
+func (s *xpathState) siblings(n XPathNode) ([]XPathNode, []XPathNode) {
+	if n.Node == nil || n.Attribute != "" {
+		return nil, nil
+	}
+	parent, _ := s.parent(n)
+	children := s.children(parent)
+	for i, c := range children {
+		if c == n {
+			preceding := make([]XPathNode, 0, i)
+			for j := i - 1; j >= 0; j-- {
+				preceding = append(preceding, children[j])
+			}
+			return preceding, children[i+1:]
+		}
+	}
+	return nil, nil
+}
+
+// descendants returns the descendants of n in document order
+func (s *xpathState) descendants(n XPathNode) []XPathNode {
+	var result []XPathNode
+	for _, c := range s.children(n) {
+		result = append(result, c)
+		result = append(result, s.descendants(c)...)
+	}
+	return result
+}
+
+// axis returns the nodes on the axis from n. Nodes on reverse axes
+// are returned in reverse document order.
+func (s *xpathState) axis(axis string, n XPathNode) []XPathNode {
+	switch axis {
+	case "self":
+		return []XPathNode{n}
+	case "child":
+		return s.children(n)
+	case "descendant":
+		return s.descendants(n)
+	case "descendant-or-self":
+		return append([]XPathNode{n}, s.descendants(n)...)
+	case "parent":
+		if parent, ok := s.parent(n); ok {
+			return []XPathNode{parent}
+		}
+		return nil
+	case "ancestor", "ancestor-or-self":
+		var result []XPathNode
+		if axis == "ancestor-or-self" {
+			result = append(result, n)
+		}
+		for a, ok := s.parent(n); ok; a, ok = s.parent(a) {
+			result = append(result, a)
+		}
+		return result
+	case "following-sibling":
+		_, following := s.siblings(n)
+		return following
+	case "preceding-sibling":
+		preceding, _ := s.siblings(n)
+		return preceding
+	case "following":
+		var result []XPathNode
+		if n.Attribute != "" {
+			n = XPathNode{Node: n.Node}
+			result = s.descendants(n)
+		}
+		for ok := true; ok; n, ok = s.parent(n) {
+			_, following := s.siblings(n)
+			for _, sibling := range following {
+				result = append(result, sibling)
+				result = append(result, s.descendants(sibling)...)
+			}
+		}
+		return result
+	case "preceding":
+		var result []XPathNode
+		if n.Attribute != "" {
+			n = XPathNode{Node: n.Node}
+		}
+		for ok := true; ok; n, ok = s.parent(n) {
+			preceding, _ := s.siblings(n)
+			for _, sibling := range preceding {
+				descendants := s.descendants(sibling)
+				for i := len(descendants) - 1; i >= 0; i-- {
+					result = append(result, descendants[i])
+				}
+				result = append(result, sibling)
+			}
+		}
+		return result
+	case "attribute":
+		if n.Node == nil || n.Attribute != "" || n.Node.Type != ElementNode {
+			return nil
+		}
+		var result []XPathNode
+		for _, name := range attributeNames(n.Node) {
+			result = append(result, XPathNode{Node: n.Node, Attribute: name})
+		}
+		return result
+	}
+	// The namespace axis is always empty
+	return nil
+}
+
+// xpathExpr is a node of a parsed XPath expression
+type xpathExpr interface {
+	eval(c *xpathContext) (interface{}, error)
+}
+
+// xpathNodeTest selects nodes on an axis by name or type
+type xpathNodeTest struct {
+	kind string // "name", "node", "text", "comment" or "processing-instruction"
+	name string // name or "*" for name tests, target for processing instructions
+}
+
+// match reports whether n passes the test. Name tests select attributes on
+// the attribute axis and elements on every other axis.
+func (t xpathNodeTest) match(n XPathNode, attributeAxis bool) bool {
+	if t.kind == "node" {
+		return true
+	}
+	if n.Node == nil {
+		return false
+	}
+	if n.Attribute != "" {
+		return t.kind == "name" && attributeAxis && (t.name == "*" || t.name == n.Attribute)
+	}
+
+	switch t.kind {
+	case "name":
+		return !attributeAxis && n.Node.Type == ElementNode && (t.name == "*" || t.name == n.Node.Tag)
+	case "text":
+		return n.Node.Type == TextNode || n.Node.Type == RawTextNode
+	case "comment":
+		return n.Node.Type == CommentNode
+	case "processing-instruction":
+		if n.Node.Type != ProcessingInstructionNode {
+			return false
+		}
+		target, _ := splitProcessingInstruction(n.Node.Text)
+		return t.name == "" || t.name == target
+	}
+	return false
+}
+
+// xpathStep is one step of a location path such as child::p[1]
+type xpathStep struct {
+	axis       string
+	test       xpathNodeTest
+	predicates []xpathExpr
+}
+
+// apply returns the nodes selected by the step from each input node in document order
+func (s xpathStep) apply(c *xpathContext, input []XPathNode) ([]XPathNode, error) {
+	var result []XPathNode
+	for _, n := range input {
+		var nodes []XPathNode
+		for _, candidate := range c.state.axis(s.axis, n) {
+			if s.test.match(candidate, s.axis == "attribute") {
+				nodes = append(nodes, candidate)
+			}
+		}
+		nodes, err := filterNodes(c, nodes, s.predicates)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, nodes...)
+	}
+	return c.state.sortNodes(result), nil
+}
+
+// filterNodes keeps the nodes matching every predicate. Positions are
+// counted in the order of nodes.
+func filterNodes(c *xpathContext, nodes []XPathNode, predicates []xpathExpr) ([]XPathNode, error) {
+	for _, predicate := range predicates {
+		var kept []XPathNode
+		for i, n := range nodes {
+			v, err := predicate.eval(c.with(n, i+1, len(nodes)))
+			if err != nil {
+				return nil, err
+			}
+			if number, ok := v.(float64); ok {
+				if number == float64(i+1) {
+					kept = append(kept, n)
+				}
+			} else if xpathBoolean(v) {
+				kept = append(kept, n)
+			}
+		}
+		nodes = kept
+	}
+	return nodes, nil
+}
+
+// xpathPath is a location path, optionally starting from a filter expression
+type xpathPath struct {
+	filter   xpathExpr // nil for location paths
+	absolute bool
+	steps    []xpathStep
+}
+
+func (p *xpathPath) eval(c *xpathContext) (interface{}, error) {
+	nodes := []XPathNode{c.node}
+	switch {
+	case p.filter != nil:
+		v, err := p.filter.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		if nodes, err = xpathNodeSet(v); err != nil {
+			return nil, err
+		}
+	case p.absolute:
+		nodes = []XPathNode{{}}
+	}
+
+	for _, step := range p.steps {
+		var err error
+		if nodes, err = step.apply(c, nodes); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// xpathFilter is a primary expression followed by predicates
+type xpathFilter struct {
+	primary    xpathExpr
+	predicates []xpathExpr
+}
+
+func (f *xpathFilter) eval(c *xpathContext) (interface{}, error) {
+	v, err := f.primary.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := xpathNodeSet(v)
+	if err != nil {
+		return nil, err
+	}
+	return filterNodes(c, nodes, f.predicates)
+}
+
+// xpathLiteral is a string or number literal
+type xpathLiteral struct {
+	value interface{}
+}
+
+func (l *xpathLiteral) eval(c *xpathContext) (interface{}, error) {
+	return l.value, nil
+}
+
+// xpathNegate is the unary minus operator
+type xpathNegate struct {
+	expr xpathExpr
+}
+
+func (n *xpathNegate) eval(c *xpathContext) (interface{}, error) {
+	v, err := n.expr.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	return -xpathNumber(v), nil
+}
+
+// xpathBinary is a binary operator
+type xpathBinary struct {
+	op          string
+	left, right xpathExpr
+}
+
+func (b *xpathBinary) eval(c *xpathContext) (interface{}, error) {
+	left, err := b.left.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// The right operand of "and" and "or" is only evaluated when needed
+	switch b.op {
+	case "and":
+		if !xpathBoolean(left) {
+			return false, nil
+		}
+	case "or":
+		if xpathBoolean(left) {
+			return true, nil
+		}
+	}
+
+	right, err := b.right.eval(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b.op {
+	case "and", "or":
+		return xpathBoolean(right), nil
+	case "|":
+		l, err := xpathNodeSet(left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := xpathNodeSet(right)
+		if err != nil {
+			return nil, err
+		}
+		return c.state.sortNodes(append(append([]XPathNode{}, l...), r...)), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return xpathCompare(b.op, left, right), nil
+	}
+
+	l, r := xpathNumber(left), xpathNumber(right)
+	switch b.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "div":
+		return l / r, nil
+	default: // mod
+		return math.Mod(l, r), nil
+	}
+}
+
+// xpathCompare compares two values with the rules for node-sets of XPath 1.0
+func xpathCompare(op string, left, right interface{}) bool {
+	l, lok := left.([]XPathNode)
+	r, rok := right.([]XPathNode)
+	switch {
+	case lok && rok:
+		for _, a := range l {
+			for _, b := range r {
+				if xpathCompareValues(op, a.Value(), b.Value()) {
+					return true
+				}
+			}
+		}
+		return false
+	case rok:
+		// Swap the operands so that the node-set is on the left
+		swapped := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+		if s, ok := swapped[op]; ok {
+			op = s
+		}
+		return xpathCompare(op, right, left)
+	case lok:
+		if b, ok := right.(bool); ok {
+			return xpathCompareValues(op, len(l) > 0, b)
+		}
+		for _, a := range l {
+			var value interface{} = a.Value()
+			if _, ok := right.(float64); ok {
+				value = xpathNumber(value)
+			}
+			if xpathCompareValues(op, value, right) {
+				return true
+			}
+		}
+		return false
+	}
+	return xpathCompareValues(op, left, right)
+}
+
+// xpathCompareValues compares two values that are not node-sets
+func xpathCompareValues(op string, left, right interface{}) bool {
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, lbool := left.(bool)
+		_, rbool := right.(bool)
+		_, lnum := left.(float64)
+		_, rnum := right.(float64)
+		switch {
+		case lbool || rbool:
+			equal = xpathBoolean(left) == xpathBoolean(right)
+		case lnum || rnum:
+			l, r := xpathNumber(left), xpathNumber(right)
+			if op == "!=" {
+				return l != r
+			}
+			return l == r
+		default:
+			equal = xpathString(left) == xpathString(right)
+		}
+		return equal == (op == "=")
+	}
+
+	l, r := xpathNumber(left), xpathNumber(right)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+// xpathNodeSet returns v as a node-set
+func xpathNodeSet(v interface{}) ([]XPathNode, error) {
+	nodes, ok := v.([]XPathNode)
+	if !ok {
+		return nil, fmt.Errorf("expression does not evaluate to a node-set")
+	}
+	return nodes, nil
+}
+
+// xpathString converts a value to a string as the string() function does
+func xpathString(v interface{}) string {
+	switch v := v.(type) {
+	case []XPathNode:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].Value()
+	case float64:
+		return xpathNumberToString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// xpathNumber converts a value to a number as the number() function does
+func xpathNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+
+	s := strings.Trim(xpathString(v), " \t\r\n")
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits == "." || strings.Trim(digits, "0123456789.") != "" || strings.Count(digits, ".") > 1 {
+		return math.NaN()
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return n
+}
+
+// xpathBoolean converts a value to a boolean as the boolean() function does
+func xpathBoolean(v interface{}) bool {
+	switch v := v.(type) {
+	case []XPathNode:
+		return len(v) > 0
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case bool:
+		return v
+	}
+	return false
+}
+
+// xpathNumberToString formats a number as XPath does, without exponents
+func xpathNumberToString(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		return "-Infinity"
+	case n == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// xpathFunctions lists the functions of the core library with their minimum
+// and maximum number of arguments (-1 for no limit)
+var xpathFunctions = map[string][2]int{
+	"last": {0, 0}, "position": {0, 0}, "count": {1, 1}, "id": {1, 1},
+	"local-name": {0, 1}, "namespace-uri": {0, 1}, "name": {0, 1},
+	"string": {0, 1}, "concat": {2, -1}, "starts-with": {2, 2}, "contains": {2, 2},
+	"substring-before": {2, 2}, "substring-after": {2, 2}, "substring": {2, 3},
+	"string-length": {0, 1}, "normalize-space": {0, 1}, "translate": {3, 3},
+	"boolean": {1, 1}, "not": {1, 1}, "true": {0, 0}, "false": {0, 0}, "lang": {1, 1},
+	"number": {0, 1}, "sum": {1, 1}, "floor": {1, 1}, "ceiling": {1, 1}, "round": {1, 1},
+}
+
+// xpathCall is a function call
+type xpathCall struct {
+	name string
+	args []xpathExpr
+}
+
+func (f *xpathCall) eval(c *xpathContext) (interface{}, error) {
+	args := make([]interface{}, len(f.args))
+	for i, arg := range f.args {
+		v, err := arg.eval(c)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	// Functions taking an optional argument default to the context node
+	if len(args) == 0 {
+		switch f.name {
+		case "local-name", "namespace-uri", "name", "string", "string-length", "normalize-space", "number":
+			args = append(args, []XPathNode{c.node})
+		}
+	}
+
+	switch f.name {
+	case "last":
+		return float64(c.size), nil
+	case "position":
+		return float64(c.position), nil
+	case "count", "sum", "local-name", "namespace-uri", "name":
+		nodes, err := xpathNodeSet(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s(): %v", f.name, err)
+		}
+		return xpathNodeSetFunction(f.name, nodes), nil
+	case "id":
+		return c.state.elementsByID(args[0]), nil
+	case "string":
+		return xpathString(args[0]), nil
+	case "concat":
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(xpathString(arg))
+		}
+		return b.String(), nil
+	case "starts-with":
+		return strings.HasPrefix(xpathString(args[0]), xpathString(args[1])), nil
+	case "contains":
+		return strings.Contains(xpathString(args[0]), xpathString(args[1])), nil
+	case "substring-before":
+		before, _, found := strings.Cut(xpathString(args[0]), xpathString(args[1]))
+		if !found {
+			return "", nil
+		}
+		return before, nil
+	case "substring-after":
+		_, after, _ := strings.Cut(xpathString(args[0]), xpathString(args[1]))
+		return after, nil
+	case "substring":
+		return xpathSubstring(args), nil
+	case "string-length":
+		return float64(utf8.RuneCountInString(xpathString(args[0]))), nil
+	case "normalize-space":
+		return strings.Join(strings.Fields(xpathString(args[0])), " "), nil
+	case "translate":
+		return xpathTranslate(xpathString(args[0]), xpathString(args[1]), xpathString(args[2])), nil
+	case "boolean":
+		return xpathBoolean(args[0]), nil
+	case "not":
+		return !xpathBoolean(args[0]), nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "lang":
+		return c.state.lang(c.node, xpathString(args[0])), nil
+	case "number":
+		return xpathNumber(args[0]), nil
+	case "floor":
+		return math.Floor(xpathNumber(args[0])), nil
+	case "ceiling":
+		return math.Ceil(xpathNumber(args[0])), nil
+	default: // round
+		n := xpathNumber(args[0])
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return n, nil
+		}
+		return math.Floor(n + 0.5), nil
+	}
+}
+
+// xpathNodeSetFunction evaluates the functions taking a node-set
+func xpathNodeSetFunction(name string, nodes []XPathNode) interface{} {
+	switch name {
+	case "count":
+		return float64(len(nodes))
+	case "sum":
+		var sum float64
+		for _, n := range nodes {
+			sum += xpathNumber(n.Value())
+		}
+		return sum
+	case "namespace-uri":
+		return ""
+	}
+
+	// local-name() and name() are the same without namespaces
+	if len(nodes) == 0 || nodes[0].Node == nil {
+		return ""
+	}
+	n := nodes[0]
+	switch {
+	case n.Attribute != "":
+		return n.Attribute
+	case n.Node.Type == ElementNode:
+		return n.Node.Tag
+	case n.Node.Type == ProcessingInstructionNode:
+		target, _ := splitProcessingInstruction(n.Node.Text)
+		return target
+	}
+	return ""
+}
+
+// xpathSubstring implements substring() with the rounding rules of XPath 1.0
+func xpathSubstring(args []interface{}) string {
+	runes := []rune(xpathString(args[0]))
+	start := math.Floor(xpathNumber(args[1]) + 0.5)
+	end := math.Inf(1)
+	if len(args) > 2 {
+		end = start + math.Floor(xpathNumber(args[2])+0.5)
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		if position := float64(i + 1); position >= start && position < end {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// xpathTranslate replaces the characters of s found in from with the
+// character at the same position in to, removing them when to is shorter
+func xpathTranslate(s, from, to string) string {
+	fromRunes, toRunes := []rune(from), []rune(to)
+	var b strings.Builder
+	for _, r := range s {
+		i := indexOfRune(fromRunes, r)
+		switch {
+		case i < 0:
+			b.WriteRune(r)
+		case i < len(toRunes):
+			b.WriteRune(toRunes[i])
+		}
+	}
+	return b.String()
+}
+
+// indexOfRune returns the index of the first r in runes, or -1
+func indexOfRune(runes []rune, r rune) int {
+	for i, v := range runes {
+		if v == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// elementsByID returns the elements whose id is one of the whitespace
+// separated tokens in the string-value of v
+func (s *xpathState) elementsByID(v interface{}) []XPathNode {
+	var ids []string
+	if nodes, ok := v.([]XPathNode); ok {
+		for _, n := range nodes {
+			ids = append(ids, strings.Fields(n.Value())...)
+		}
+	} else {
+		ids = strings.Fields(xpathString(v))
+	}
+
+	var result []XPathNode
+	walkElements(s.doc.Children, func(n *Node) {
+		if n.ID != "" && indexOfString(ids, n.ID) >= 0 {
+			result = append(result, XPathNode{Node: n})
+		}
+	})
+	return result
+}
+
+// lang reports whether the language of n given by the nearest lang
+// attribute is lang or a sublanguage of it
+func (s *xpathState) lang(n XPathNode, lang string) bool {
+	for a, ok := n, true; ok; a, ok = s.parent(a) {
+		if a.Node == nil || a.Attribute != "" {
+			continue
+		}
+		if val, found := a.Node.Attr("lang"); found {
+			val, lang = strings.ToLower(val), strings.ToLower(lang)
+			return val == lang || strings.HasPrefix(val, lang+"-")
+		}
+	}
+	return false
+}
+
+// Token kinds of the XPath lexer
+const (
+	xpathEOF = iota
+	xpathNumberToken
+	xpathLiteralToken
+	xpathNameToken
+	xpathOperatorToken
+	xpathSymbolToken
+)
+
+// xpathToken is a token of an XPath expression
+type xpathToken struct {
+	kind  int
+	value string
+}
+
+// tokenizeXPath splits an expression into tokens. Following the XPath 1.0
+// lexical rules, "*" and the names and, or, div and mod are operators only
+// when they follow a token that can end an operand.
+func tokenizeXPath(expr string) ([]xpathToken, error) {
+	var tokens []xpathToken
+	operandEnded := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		last := tokens[len(tokens)-1]
+		switch last.kind {
+		case xpathOperatorToken:
+			return false
+		case xpathSymbolToken:
+			return last.value == ")" || last.value == "]" || last.value == "." || last.value == ".."
+		}
+		return true
+	}
+
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case strings.IndexByte(whitespaceChars, ch) >= 0:
+			i++
+		case ch == '"' || ch == '\'':
+			end := strings.IndexByte(expr[i+1:], ch)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			tokens = append(tokens, xpathToken{xpathLiteralToken, expr[i+1 : i+1+end]})
+			i += end + 2
+		case isDigit(ch) || (ch == '.' && i+1 < len(expr) && isDigit(expr[i+1])):
+			start := i
+			for i < len(expr) && isDigit(expr[i]) {
+				i++
+			}
+			if i < len(expr) && expr[i] == '.' {
+				i++
+				for i < len(expr) && isDigit(expr[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, xpathToken{xpathNumberToken, expr[start:i]})
+		case ch == '*':
+			if operandEnded() {
+				tokens = append(tokens, xpathToken{xpathOperatorToken, "*"})
+			} else {
+				tokens = append(tokens, xpathToken{xpathNameToken, "*"})
+			}
+			i++
+		case isNameStart(ch):
+			start := i
+			for i < len(expr) && isNameChar(expr[i]) {
+				i++
+			}
+			// A prefixed name such as svg:rect or svg:*
+			if i+1 < len(expr) && expr[i] == ':' && expr[i+1] != ':' {
+				if expr[i+1] == '*' {
+					i += 2
+				} else if isNameStart(expr[i+1]) {
+					i++
+					for i < len(expr) && isNameChar(expr[i]) {
+						i++
+					}
+				}
+			}
+			name := expr[start:i]
+			if operandEnded() {
+				switch name {
+				case "and", "or", "div", "mod":
+					tokens = append(tokens, xpathToken{xpathOperatorToken, name})
+					continue
+				}
+				return nil, fmt.Errorf("unexpected %q", name)
+			}
+			tokens = append(tokens, xpathToken{xpathNameToken, name})
+		case ch == '$':
+			return nil, fmt.Errorf("variables are not supported")
+		default:
+			op := ""
+			for _, candidate := range []string{"//", "::", "..", "!=", "<=", ">=", "/", "|", "+", "-", "=", "<", ">", "(", ")", "[", "]", ".", "@", ","} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", ch)
+			}
+			kind := xpathSymbolToken
+			switch op {
+			case "//", "/", "|", "+", "-", "=", "!=", "<", "<=", ">", ">=":
+				kind = xpathOperatorToken
+			}
+			tokens = append(tokens, xpathToken{kind, op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// isDigit reports whether ch is an ASCII digit
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// isNameStart reports whether ch can start an XML name
+func isNameStart(ch byte) bool {
+	return ch == '_' || ch >= 0x80 || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+// isNameChar reports whether ch can appear in an XML name
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || isDigit(ch) || ch == '-' || ch == '.'
+}
+
+// xpathAxes lists the axis names
+var xpathAxes = map[string]bool{
+	"ancestor": true, "ancestor-or-self": true, "attribute": true, "child": true,
+	"descendant": true, "descendant-or-self": true, "following": true,
+	"following-sibling": true, "namespace": true, "parent": true,
+	"preceding": true, "preceding-sibling": true, "self": true,
+}
+
+// xpathNodeTypes lists the node type tests
+var xpathNodeTypes = map[string]bool{
+	"comment": true, "text": true, "processing-instruction": true, "node": true,
+}
+
+// xpathParser is a recursive descent parser of XPath 1.0 expressions
+type xpathParser struct {
+	tokens []xpathToken
+	pos    int
+}
+
+// peek returns the token at offset from the current token
+func (p *xpathParser) peekAt(offset int) xpathToken {
+	if p.pos+offset >= len(p.tokens) {
+		return xpathToken{kind: xpathEOF}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+// peek returns the current token
+func (p *xpathParser) peek() xpathToken {
+	return p.peekAt(0)
+}
+
+// next returns the current token and advances past it
+func (p *xpathParser) next() xpathToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept advances past the current token when it has the given kind and value
+func (p *xpathParser) accept(kind int, value string) bool {
+	if t := p.peek(); t.kind == kind && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect advances past the given symbol or returns an error
+func (p *xpathParser) expect(value string) error {
+	if !p.accept(xpathSymbolToken, value) {
+		if t := p.peek(); t.kind != xpathEOF {
+			return fmt.Errorf("expected %q, found %q", value, t.value)
+		}
+		return fmt.Errorf("expected %q at end of expression", value)
+	}
+	return nil
+}
+
+// parseExpr parses an expression
+func (p *xpathParser) parseExpr() (xpathExpr, error) {
+	return p.parseBinary(0)
+}
+
+// xpathPrecedence lists the binary operators from the lowest precedence
+var xpathPrecedence = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+// parseBinary parses left-associative binary operators at the given precedence level
+func (p *xpathParser) parseBinary(level int) (xpathExpr, error) {
+	if level == len(xpathPrecedence) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != xpathOperatorToken || indexOfString(xpathPrecedence[level], t.value) < 0 {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &xpathBinary{op: t.value, left: left, right: right}
+	}
+}
+
+// parseUnary parses a union expression with optional unary minus signs
+func (p *xpathParser) parseUnary() (xpathExpr, error) {
+	if p.accept(xpathOperatorToken, "-") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &xpathNegate{expr: e}, nil
+	}
+
+	left, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(xpathOperatorToken, "|") {
+		right, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		left = &xpathBinary{op: "|", left: left, right: right}
+	}
+	return left, nil
+}
+
+// descendantOrSelf is the step "//" abbreviates
+var descendantOrSelf = xpathStep{axis: "descendant-or-self", test: xpathNodeTest{kind: "node"}}
+
+// parsePath parses a location path or a filter expression followed by steps
+func (p *xpathParser) parsePath() (xpathExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == xpathOperatorToken && t.value == "/":
+		p.pos++
+		path := &xpathPath{absolute: true}
+		if !p.atStep() {
+			return path, nil
+		}
+		return path, p.parseSteps(path)
+	case t.kind == xpathOperatorToken && t.value == "//":
+		p.pos++
+		path := &xpathPath{absolute: true, steps: []xpathStep{descendantOrSelf}}
+		return path, p.parseSteps(path)
+	case t.kind == xpathLiteralToken || t.kind == xpathNumberToken || (t.kind == xpathSymbolToken && t.value == "(") ||
+		(t.kind == xpathNameToken && p.peekAt(1).value == "(" && !xpathNodeTypes[t.value]):
+		filter, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		next := p.peek()
+		if next.kind != xpathOperatorToken || (next.value != "/" && next.value != "//") {
+			return filter, nil
+		}
+		path := &xpathPath{filter: filter}
+		if p.next().value == "//" {
+			path.steps = append(path.steps, descendantOrSelf)
+		}
+		return path, p.parseSteps(path)
+	}
+
+	path := &xpathPath{}
+	return path, p.parseSteps(path)
+}
+
+// atStep reports whether the current token can start a step
+func (p *xpathParser) atStep() bool {
+	t := p.peek()
+	return t.kind == xpathNameToken || (t.kind == xpathSymbolToken && (t.value == "." || t.value == ".." || t.value == "@"))
+}
+
+// parseSteps parses a relative location path and appends its steps to path
+func (p *xpathParser) parseSteps(path *xpathPath) error {
+	for {
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, step)
+
+		switch {
+		case p.accept(xpathOperatorToken, "/"):
+		case p.accept(xpathOperatorToken, "//"):
+			path.steps = append(path.steps, descendantOrSelf)
+		default:
+			return nil
+		}
+	}
+}
+
+// parseStep parses a step with its axis, node test and predicates
+func (p *xpathParser) parseStep() (xpathStep, error) {
+	if p.accept(xpathSymbolToken, ".") {
+		return xpathStep{axis: "self", test: xpathNodeTest{kind: "node"}}, nil
+	}
+	if p.accept(xpathSymbolToken, "..") {
+		return xpathStep{axis: "parent", test: xpathNodeTest{kind: "node"}}, nil
+	}
+
+	step := xpathStep{axis: "child"}
+	if p.accept(xpathSymbolToken, "@") {
+		step.axis = "attribute"
+	} else if t := p.peek(); t.kind == xpathNameToken && p.peekAt(1).value == "::" {
+		if !xpathAxes[t.value] {
+			return step, fmt.Errorf("unknown axis %q", t.value)
+		}
+		step.axis = t.value
+		p.pos += 2
+	}
+
+	t := p.next()
+	if t.kind != xpathNameToken {
+		if t.kind == xpathEOF {
+			return step, fmt.Errorf("missing node test at end of expression")
+		}
+		return step, fmt.Errorf("expected node test, found %q", t.value)
+	}
+	if xpathNodeTypes[t.value] && p.accept(xpathSymbolToken, "(") {
+		step.test.kind = t.value
+		if t.value == "processing-instruction" && p.peek().kind == xpathLiteralToken {
+			step.test.name = p.next().value
+		}
+		if err := p.expect(")"); err != nil {
+			return step, err
+		}
+	} else {
+		// HTML element and attribute names are lower case
+		step.test = xpathNodeTest{kind: "name", name: strings.ToLower(t.value)}
+	}
+
+	predicates, err := p.parsePredicates()
+	if err != nil {
+		return step, err
+	}
+	step.predicates = predicates
+	return step, nil
+}
+
+// parsePredicates parses any number of [expr] predicates
+func (p *xpathParser) parsePredicates() ([]xpathExpr, error) {
+	var predicates []xpathExpr
+	for p.accept(xpathSymbolToken, "[") {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, e)
+	}
+	return predicates, nil
+}
+
+// parseFilter parses a primary expression with optional predicates
+func (p *xpathParser) parseFilter() (xpathExpr, error) {
+	primary, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	predicates, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	if len(predicates) == 0 {
+		return primary, nil
+	}
+	return &xpathFilter{primary: primary, predicates: predicates}, nil
+}
+
+// parsePrimary parses a literal, number, parenthesized expression or function call
+func (p *xpathParser) parsePrimary() (xpathExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case xpathLiteralToken:
+		return &xpathLiteral{value: t.value}, nil
+	case xpathNumberToken:
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.value)
+		}
+		return &xpathLiteral{value: n}, nil
+	case xpathSymbolToken:
+		// Only "(" starts a filter expression
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+
+	arity, ok := xpathFunctions[t.value]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s()", t.value)
+	}
+	p.pos++ // "("
+	call := &xpathCall{name: t.value}
+	if !p.accept(xpathSymbolToken, ")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.accept(xpathSymbolToken, ")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(call.args) < arity[0] || (arity[1] >= 0 && len(call.args) > arity[1]) {
+		return nil, fmt.Errorf("wrong number of arguments for %s()", t.value)
+	}
+	return call, nil
+}
@@ -0,0 +1,206 @@
+package hj
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// xpathTestHTML is the document used by the XPath tests
+const xpathTestHTML = `<html lang="en"><head><title>Title</title></head><body>
+<div id="content" class="main">
+  <p class="lead">First</p>
+  <p>Second <b>bold</b></p>
+  <!-- note -->
+  <p data-n="3">Third</p>
+</div>
+<ul><li>1</li><li>2</li><li>3</li></ul>
+<a href="/a">A</a><a href="https://example.com/b" lang="de-AT">B</a>
+</body></html>`
+
+// TestEvaluateXPath_NodeSets tests location paths returning node-sets
+func TestEvaluateXPath_NodeSets(t *testing.T) {
+	doc, err := Parse(strings.NewReader(xpathTestHTML))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"/html/head/title", []string{"Title"}},
+		{"//p", []string{"First", "Second bold", "Third"}},
+		{"//div[@id='content']/p[2]", []string{"Second bold"}},
+		{"//p[last()]", []string{"Third"}},
+		{"//p[position() < 3][2]", []string{"Second bold"}},
+		{"//p[@class]", []string{"First"}},
+		{"//p[b]", []string{"Second bold"}},
+		{"//p/text()", []string{"First", "Second ", "Third"}},
+		{"//a/@href", []string{"/a", "https://example.com/b"}},
+		{"//@*[. = 'main']", []string{"main"}},
+		{"//li[. = 2]", []string{"2"}},
+		{"//li[. > 1 and . != 3]", []string{"2"}},
+		{"//p[contains(., 'ir')]", []string{"First", "Third"}},
+		{"//p[starts-with(normalize-space(), 'Sec')]", []string{"Second bold"}},
+		{"//b/ancestor::*[1]", []string{"Second bold"}},
+		{"//b/ancestor::div/@id", []string{"content"}},
+		{"//p[1]/following-sibling::p", []string{"Second bold", "Third"}},
+		{"//p[3]/preceding-sibling::p[1]", []string{"Second bold"}},
+		{"//p[2]/preceding::*[1]", []string{"First"}},
+		{"//p[2]/following::li[2]", []string{"2"}},
+		{"//div/comment()", []string{" note "}},
+		{"//li[2]/..", []string{"123"}},
+		{"//li | //title", []string{"Title", "1", "2", "3"}},
+		{"(//li)[last()]", []string{"3"}},
+		{"id('content')/p[@data-n = 3]", []string{"Third"}},
+		{"//a[lang('de')]", []string{"B"}},
+		{"//*[lang('EN')][self::title]", []string{"Title"}},
+		{"//P[@DATA-N]", []string{"Third"}},
+		{"child::html/descendant-or-self::li[not(preceding-sibling::li)]", []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := EvaluateXPath(doc, tt.expr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			nodes, ok := result.([]XPathNode)
+			if !ok {
+				t.Fatalf("Expected node-set, got %T", result)
+			}
+
+			var values []string
+			for _, n := range nodes {
+				values = append(values, n.Value())
+			}
+			if strings.Join(values, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %q, got %q", tt.expected, values)
+			}
+		})
+	}
+}
+
+// TestEvaluateXPath_Values tests expressions returning strings, numbers and booleans
+func TestEvaluateXPath_Values(t *testing.T) {
+	doc, err := Parse(strings.NewReader(xpathTestHTML))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"count(//p)", 3.0},
+		{"sum(//li)", 6.0},
+		{"string(//title)", "Title"},
+		{"name(//*[@id])", "div"},
+		{"local-name(//a/@href)", "href"},
+		{"concat(//li[1], '-', //li[3])", "1-3"},
+		{"substring('12345', 1.5, 2.6)", "234"},
+		{"substring('12345', 0, 3)", "12"},
+		{"substring-before('2024-01-02', '-')", "2024"},
+		{"substring-after('2024-01-02', '-')", "01-02"},
+		{"string-length('日本語')", 3.0},
+		{"translate('bar', 'abc', 'AB')", "BAr"},
+		{"normalize-space('  a   b ')", "a b"},
+		{"7 mod 3 + 10 div 4 * 2", 6.0},
+		{"-(1 - 3)", 2.0},
+		{"round(2.5) + floor(-1.5) + ceiling(1.2)", 3.0},
+		{"number('abc') = number('abc')", false},
+		{"1 div 0", math.Inf(1)},
+		{"boolean(//table) or true()", true},
+		{"not(//p)", false},
+		{"//li = 3", true},
+		{"//li != 1", true},
+		{"3 > //li", true},
+		{"//p = 'Third'", true},
+		{"//li = //p", false},
+		{"2 = true()", true},
+		{"'abc' < 'abd'", false},
+		{"string(1 div 0)", "Infinity"},
+		{"string(0.5 * 3)", "1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := EvaluateXPath(doc, tt.expr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v (%T), got %v (%T)", tt.expected, tt.expected, result, result)
+			}
+		})
+	}
+}
+
+// TestDocument_XPathToJSON tests writing XPath results as JSON
+func TestDocument_XPathToJSON(t *testing.T) {
+	doc, err := Parse(strings.NewReader(xpathTestHTML))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"//p[b]", `[{"p":{"child":[{"b":{"child":"bold"}}]}}]`},
+		{"//a/@href", `["/a","https://example.com/b"]`},
+		{"//p/text()", `["First","Second","Third"]`},
+		{"//div/comment()", `[{"#comment":" note "}]`},
+		{"//table", `[]`},
+		{"count(//li)", `3`},
+		{"string(//title)", `"Title"`},
+		{"//li = 2", `true`},
+		{"0 div 0", `"NaN"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			data, err := doc.XPathToJSON(tt.expr, Options{Compact: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, data)
+			}
+		})
+	}
+}
+
+// TestCompileXPath_Errors tests invalid expressions
+func TestCompileXPath_Errors(t *testing.T) {
+	exprs := []string{
+		"",
+		"//",
+		"//p[",
+		"//p[1",
+		"foo::p",
+		"unknown()",
+		"count()",
+		"concat('a')",
+		"$var",
+		"'unterminated",
+		"//p)",
+		"1 2",
+		"//p/#",
+	}
+
+	for _, expr := range exprs {
+		if _, err := CompileXPath(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+
+	doc, err := Parse(strings.NewReader("<p>x</p>"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := EvaluateXPath(doc, "count('a')"); err == nil {
+		t.Errorf("Expected error when a string is used as a node-set")
+	}
+}
@@ -1,13 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	hj "github.com/HARMONICOM/hj"
+	"golang.org/x/net/html/atom"
 )
 
 // showHelp displays the help message
@@ -18,17 +37,652 @@ func showHelp() {
 	fmt.Println("Usage:")
 	fmt.Println("  hj [HTMLfilePath|URL]     - Read HTML from file or URL and convert to JSON")
 	fmt.Println("  cat file.html | hj -      - Read HTML from stdin and convert to JSON")
+	fmt.Println("  hj a.html 'docs/*.html'   - Convert several inputs into one JSON object keyed by input")
+	fmt.Println("  hj crawl <URL> [options]  - Crawl a website and output one JSON line per page")
 	fmt.Println("  hj --help                 - Show this help message")
 	fmt.Println("")
+	fmt.Println("Options:")
+	fmt.Println("  -r, --reverse             - Read JSON produced by hj and convert it back to HTML")
+	fmt.Println("  --lossless                - Keep doctype, comments, whitespace and raw text")
+	fmt.Println("  --fragment [context]      - Parse an HTML fragment inside a context element (default: body)")
+	fmt.Println("  --encoding <name>         - Read the input in this character encoding instead of detecting it")
+	fmt.Println("  --metadata                - Add the source and detected encoding to the output")
+	fmt.Println("  --select <selector>       - Output an array of the elements matching a CSS selector")
+	fmt.Println("  --xpath <expression>      - Output the result of an XPath 1.0 expression")
+	fmt.Println("  --format <name>           - Output format: json, json-compact, yaml, toml, xml, cbor, msgpack, text or markdown (default: json)")
+	fmt.Println("  --ndjson                  - Output one JSON object per element with its path, depth and direct text")
+	fmt.Println("  --tables [mode]           - Output the tables with rows as arrays (rows), objects (objects) or CSV (csv)")
+	fmt.Println("  --forms                   - Output the forms with their action, method and controls")
+	fmt.Println("  --links                   - Output the URLs of links, images, scripts and other resources")
+	fmt.Println("  --meta                    - Output the title, description, OpenGraph, Twitter card and other page metadata")
+	fmt.Println("  --structured-data         - Output the JSON-LD, Microdata and RDFa structured data")
+	fmt.Println("  --article                 - Output the title, byline, date, lead image and main content of an article")
+	fmt.Println("  -h, --help                - Show this help message")
+	fmt.Println("")
+	fmt.Println("HTTP options:")
+	fmt.Println("  --connect-timeout <time>  - Time allowed to connect, in seconds or with a unit such as 500ms (default: 30)")
+	fmt.Println("  --read-timeout <time>     - Time allowed to wait for data from the server (default: 60)")
+	fmt.Println("  -H, --header <header>     - Send an extra header such as 'Accept-Language: ja' (repeatable)")
+	fmt.Println("  --user-agent <string>     - Send this User-Agent header")
+	fmt.Println("  --cookies <file>          - Send the cookies in a Netscape cookies.txt file")
+	fmt.Println("  --user <user:password>    - Authenticate with HTTP basic authentication")
+	fmt.Println("  --bearer <token>          - Authenticate with a bearer token")
+	fmt.Println("  --proxy <url>             - Use an HTTP or HTTPS proxy (default: HTTP_PROXY and HTTPS_PROXY)")
+	fmt.Println("  --cacert <file>           - Verify servers with the CA certificates in a PEM file")
+	fmt.Println("  --insecure                - Do not verify the TLS certificates of servers")
+	fmt.Println("  --retries <n>             - Retry network errors, 429 and 5xx responses up to n times (default: 0)")
+	fmt.Println("  --retry-wait <time>       - Wait before the first retry, doubled for each retry after it (default: 1)")
+	fmt.Println("  --max-retry-wait <time>   - Longest wait between retries, including Retry-After (default: 30)")
+	fmt.Println("  --allow-http-errors       - Convert the page sent with an HTTP error status instead of failing")
+	fmt.Println("")
+	fmt.Println("Batch options:")
+	fmt.Println("  --input-list <file>       - Also convert the files and URLs listed one per line in a file (- for stdin)")
+	fmt.Println("  -j, --jobs <n>            - Convert up to n inputs at once (default: number of CPUs)")
+	fmt.Println("  --out-dir <dir>           - Write the output of each input to its own file in a directory")
+	fmt.Println("  --lines                   - Output one JSON line per input with its source and result")
+	fmt.Println("  -R, --recursive           - Convert the .html and .htm files in directories and their subdirectories")
+	fmt.Println("  --include <pattern>       - Convert the files in directories matching a pattern such as '*.xhtml' instead (repeatable)")
+	fmt.Println("  --exclude <pattern>       - Skip the files and directories matching a pattern such as 'drafts/*' (repeatable)")
+	fmt.Println("  --force                   - Convert inputs even when their file in --out-dir is newer than them")
+	fmt.Println("")
+	fmt.Println("Crawl options:")
+	fmt.Println("  --depth <n>               - Follow links up to n steps away from the start page (default: 3)")
+	fmt.Println("  --max-pages <n>           - Stop after n pages, or 0 for no limit (default: 100)")
+	fmt.Println("  --delay <time>            - Wait between requests, or the Crawl-delay of robots.txt if longer (default: 1)")
+	fmt.Println("  --ignore-robots           - Crawl without reading robots.txt")
+	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  hj index.html")
 	fmt.Println("  hj https://example.com")
 	fmt.Println("  cat test.html | hj -")
+	fmt.Println("  hj index.html | hj --reverse -")
+	fmt.Println("  echo '<li>a</li><li>b</li>' | hj --fragment ul -")
+	fmt.Println("  hj --select 'div#content > p.lead' index.html")
+	fmt.Println("  hj --xpath '//a/@href' index.html")
+	fmt.Println("  hj --format yaml index.html")
+	fmt.Println("  hj --format markdown --select article https://example.com/news/1")
+	fmt.Println("  hj --format cbor index.html | hj --reverse --format cbor -")
+	fmt.Println("  hj --ndjson index.html > elements.ndjson")
+	fmt.Println("  hj --tables csv index.html")
+	fmt.Println("  hj --forms https://example.com/login")
+	fmt.Println("  hj --links https://example.com | jq -r '.[].url'")
+	fmt.Println("  hj --structured-data product.html | jq '.jsonld'")
+	fmt.Println("  hj --article https://example.com/news/1 | jq '.content'")
+	fmt.Println("  hj -H 'Accept-Language: ja' --cookies cookies.txt --read-timeout 10 https://example.com/account")
+	fmt.Println("  hj --retries 3 --allow-http-errors https://example.com/missing")
+	fmt.Println("  hj --jobs 8 --out-dir out 'pages/*.html'")
+	fmt.Println("  hj --input-list urls.txt --lines --meta > meta.ndjson")
+	fmt.Println("  hj --recursive ./site --exclude 'drafts' --out-dir ./json")
+	fmt.Println("  hj crawl --depth 2 --max-pages 50 https://example.com > site.ndjson")
   fmt.Println("")
 }
 
-// getHTML retrieves HTML from file, URL, or stdin
-func getHTML(input string) (string, error) {
+// config holds the options given on the command line
+type config struct {
+	input    string
+	inputs   []string
+	help     bool
+	reverse  bool
+	lossless bool
+
+	fragment        bool
+	fragmentContext string
+
+	encoding string
+	metadata bool
+
+	selector string
+	xpath    string
+
+	format string
+	ndjson bool
+	tables string
+	forms  bool
+	links  bool
+	meta   bool
+
+	structuredData bool
+	article        bool
+
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	headers        []string
+	userAgent      string
+	cookies        string
+	user           string
+	bearer         string
+	proxy          string
+	cacert         string
+	insecure       bool
+
+	retries         int
+	retryWait       time.Duration
+	maxRetryWait    time.Duration
+	allowHTTPErrors bool
+
+	inputList string
+	jobs      int
+	outDir    string
+	lines     bool
+	recursive bool
+	include   []string
+	exclude   []string
+	force     bool
+
+	crawl        bool
+	depth        int
+	maxPages     int
+	delay        time.Duration
+	ignoreRobots bool
+}
+
+// Defaults of the crawl options
+const (
+	defaultCrawlDepth = 3
+	defaultCrawlPages = 100
+	defaultCrawlDelay = time.Second
+)
+
+// tableModes lists the output modes of --tables
+var tableModes = []string{"rows", "objects", "csv"}
+
+// parseArgs parses the command line arguments
+func parseArgs(args []string) (*config, error) {
+	cfg := &config{}
+	if len(args) > 0 && args[0] == "crawl" {
+		cfg.crawl = true
+		cfg.depth, cfg.maxPages, cfg.delay = defaultCrawlDepth, defaultCrawlPages, defaultCrawlDelay
+		args = args[1:]
+	}
+	var crawlOptions []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--help" || arg == "-h":
+			cfg.help = true
+		case arg == "--reverse" || arg == "-r":
+			cfg.reverse = true
+		case arg == "--lossless":
+			cfg.lossless = true
+		case arg == "--fragment" || strings.HasPrefix(arg, "--fragment="):
+			cfg.fragment = true
+			if context, ok := strings.CutPrefix(arg, "--fragment="); ok {
+				cfg.fragmentContext = context
+			} else if i+1 < len(args) && atom.Lookup([]byte(args[i+1])) != 0 && !fileExists(args[i+1]) {
+				// The context is optional, so only a known element name that is
+				// not also an input file, such as one named "main", is taken as it
+				i++
+				cfg.fragmentContext = args[i]
+			}
+		case arg == "--encoding" || strings.HasPrefix(arg, "--encoding="):
+			value, err := optionValue(args, &i, "--encoding")
+			if err != nil {
+				return nil, err
+			}
+			cfg.encoding = value
+		case arg == "--metadata":
+			cfg.metadata = true
+		case arg == "--select" || strings.HasPrefix(arg, "--select="):
+			value, err := optionValue(args, &i, "--select")
+			if err != nil {
+				return nil, err
+			}
+			cfg.selector = value
+		case arg == "--xpath" || strings.HasPrefix(arg, "--xpath="):
+			value, err := optionValue(args, &i, "--xpath")
+			if err != nil {
+				return nil, err
+			}
+			cfg.xpath = value
+		case arg == "--format" || strings.HasPrefix(arg, "--format="):
+			value, err := optionValue(args, &i, "--format")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := hj.LookupEncoder(value); err != nil {
+				return nil, err
+			}
+			cfg.format = value
+		case arg == "--ndjson":
+			cfg.ndjson = true
+		case arg == "--forms":
+			cfg.forms = true
+		case arg == "--links":
+			cfg.links = true
+		case arg == "--meta":
+			cfg.meta = true
+		case arg == "--structured-data":
+			cfg.structuredData = true
+		case arg == "--article":
+			cfg.article = true
+		case arg == "--connect-timeout" || strings.HasPrefix(arg, "--connect-timeout="):
+			value, err := optionValue(args, &i, "--connect-timeout")
+			if err != nil {
+				return nil, err
+			}
+			if cfg.connectTimeout, err = parseTimeout("--connect-timeout", value); err != nil {
+				return nil, err
+			}
+		case arg == "--read-timeout" || strings.HasPrefix(arg, "--read-timeout="):
+			value, err := optionValue(args, &i, "--read-timeout")
+			if err != nil {
+				return nil, err
+			}
+			if cfg.readTimeout, err = parseTimeout("--read-timeout", value); err != nil {
+				return nil, err
+			}
+		case arg == "-H" || arg == "--header" || strings.HasPrefix(arg, "--header="):
+			name := "--header"
+			if arg == "-H" {
+				name = "-H"
+			}
+			value, err := optionValue(args, &i, name)
+			if err != nil {
+				return nil, err
+			}
+			if key, _, ok := strings.Cut(value, ":"); !ok || strings.TrimSpace(key) == "" || strings.ContainsAny(strings.TrimSpace(key), " \t") {
+				return nil, fmt.Errorf("invalid header: %s", value)
+			}
+			cfg.headers = append(cfg.headers, value)
+		case arg == "--user-agent" || strings.HasPrefix(arg, "--user-agent="):
+			value, err := optionValue(args, &i, "--user-agent")
+			if err != nil {
+				return nil, err
+			}
+			cfg.userAgent = value
+		case arg == "--cookies" || strings.HasPrefix(arg, "--cookies="):
+			value, err := optionValue(args, &i, "--cookies")
+			if err != nil {
+				return nil, err
+			}
+			cfg.cookies = value
+		case arg == "--user" || strings.HasPrefix(arg, "--user="):
+			value, err := optionValue(args, &i, "--user")
+			if err != nil {
+				return nil, err
+			}
+			cfg.user = value
+		case arg == "--bearer" || strings.HasPrefix(arg, "--bearer="):
+			value, err := optionValue(args, &i, "--bearer")
+			if err != nil {
+				return nil, err
+			}
+			cfg.bearer = value
+		case arg == "--proxy" || strings.HasPrefix(arg, "--proxy="):
+			value, err := optionValue(args, &i, "--proxy")
+			if err != nil {
+				return nil, err
+			}
+			if proxy, err := url.Parse(value); err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https") || proxy.Host == "" {
+				return nil, fmt.Errorf("invalid proxy URL: %s", value)
+			}
+			cfg.proxy = value
+		case arg == "--cacert" || strings.HasPrefix(arg, "--cacert="):
+			value, err := optionValue(args, &i, "--cacert")
+			if err != nil {
+				return nil, err
+			}
+			cfg.cacert = value
+		case arg == "--insecure":
+			cfg.insecure = true
+		case arg == "--retries" || strings.HasPrefix(arg, "--retries="):
+			value, err := optionValue(args, &i, "--retries")
+			if err != nil {
+				return nil, err
+			}
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				return nil, fmt.Errorf("invalid --retries: %s", value)
+			}
+			cfg.retries = retries
+		case arg == "--retry-wait" || strings.HasPrefix(arg, "--retry-wait="):
+			value, err := optionValue(args, &i, "--retry-wait")
+			if err != nil {
+				return nil, err
+			}
+			if cfg.retryWait, err = parseTimeout("--retry-wait", value); err != nil {
+				return nil, err
+			}
+		case arg == "--max-retry-wait" || strings.HasPrefix(arg, "--max-retry-wait="):
+			value, err := optionValue(args, &i, "--max-retry-wait")
+			if err != nil {
+				return nil, err
+			}
+			if cfg.maxRetryWait, err = parseTimeout("--max-retry-wait", value); err != nil {
+				return nil, err
+			}
+		case arg == "--allow-http-errors":
+			cfg.allowHTTPErrors = true
+		case arg == "--tables" || strings.HasPrefix(arg, "--tables="):
+			cfg.tables = "rows"
+			if mode, ok := strings.CutPrefix(arg, "--tables="); ok {
+				if !slices.Contains(tableModes, mode) {
+					return nil, fmt.Errorf("unknown table mode: %s", mode)
+				}
+				cfg.tables = mode
+			} else if i+1 < len(args) && slices.Contains(tableModes, args[i+1]) {
+				// The mode is optional, so only a known mode name is taken as it
+				i++
+				cfg.tables = args[i]
+			}
+		case arg == "--input-list" || strings.HasPrefix(arg, "--input-list="):
+			value, err := optionValue(args, &i, "--input-list")
+			if err != nil {
+				return nil, err
+			}
+			cfg.inputList = value
+		case arg == "--jobs" || arg == "-j" || strings.HasPrefix(arg, "--jobs="):
+			name := "--jobs"
+			if arg == "-j" {
+				name = "-j"
+			}
+			value, err := optionValue(args, &i, name)
+			if err != nil {
+				return nil, err
+			}
+			jobs, err := strconv.Atoi(value)
+			if err != nil || jobs < 1 {
+				return nil, fmt.Errorf("invalid %s: %s", name, value)
+			}
+			cfg.jobs = jobs
+		case arg == "--out-dir" || strings.HasPrefix(arg, "--out-dir="):
+			value, err := optionValue(args, &i, "--out-dir")
+			if err != nil {
+				return nil, err
+			}
+			cfg.outDir = value
+		case arg == "--lines":
+			cfg.lines = true
+		case arg == "--recursive" || arg == "-R":
+			cfg.recursive = true
+		case arg == "--include" || strings.HasPrefix(arg, "--include="), arg == "--exclude" || strings.HasPrefix(arg, "--exclude="):
+			name, _, _ := strings.Cut(arg, "=")
+			value, err := optionValue(args, &i, name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := pathpkg.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid %s pattern: %s", name, value)
+			}
+			if name == "--include" {
+				cfg.include = append(cfg.include, value)
+			} else {
+				cfg.exclude = append(cfg.exclude, value)
+			}
+		case arg == "--force":
+			cfg.force = true
+		case arg == "--depth" || strings.HasPrefix(arg, "--depth="), arg == "--max-pages" || strings.HasPrefix(arg, "--max-pages="):
+			name, _, _ := strings.Cut(arg, "=")
+			value, err := optionValue(args, &i, name)
+			if err != nil {
+				return nil, err
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s: %s", name, value)
+			}
+			if name == "--depth" {
+				cfg.depth = n
+			} else {
+				cfg.maxPages = n
+			}
+			crawlOptions = append(crawlOptions, name)
+		case arg == "--delay" || strings.HasPrefix(arg, "--delay="):
+			value, err := optionValue(args, &i, "--delay")
+			if err != nil {
+				return nil, err
+			}
+			// A delay of 0 is allowed to crawl a site of one's own at full speed
+			if value == "0" {
+				cfg.delay = 0
+			} else if cfg.delay, err = parseTimeout("--delay", value); err != nil {
+				return nil, err
+			}
+			crawlOptions = append(crawlOptions, "--delay")
+		case arg == "--ignore-robots":
+			cfg.ignoreRobots = true
+			crawlOptions = append(crawlOptions, "--ignore-robots")
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			cfg.inputs = append(cfg.inputs, arg)
+		default:
+			return nil, fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if !cfg.crawl && len(crawlOptions) > 0 {
+		return nil, fmt.Errorf("%s can only be used with crawl", crawlOptions[0])
+	}
+	if cfg.crawl {
+		if option := cfg.crawlConflict(); option != "" {
+			return nil, fmt.Errorf("%s cannot be used with crawl", option)
+		}
+		if len(cfg.inputs) != 1 || !isURL(cfg.inputs[0]) {
+			return nil, fmt.Errorf("crawl needs one start URL")
+		}
+	}
+	if cfg.selector != "" && cfg.xpath != "" {
+		return nil, fmt.Errorf("--select and --xpath cannot be used together")
+	}
+	if cfg.user != "" && cfg.bearer != "" {
+		return nil, fmt.Errorf("--user and --bearer cannot be used together")
+	}
+	if cfg.cacert != "" && cfg.insecure {
+		return nil, fmt.Errorf("--cacert and --insecure cannot be used together")
+	}
+	if modes := cfg.outputModes(); len(modes) > 1 {
+		return nil, fmt.Errorf("%s and %s cannot be used together", modes[0], modes[1])
+	}
+	if cfg.ndjson && cfg.format != "" {
+		return nil, fmt.Errorf("--ndjson cannot be used with --format")
+	}
+	if cfg.tables == "csv" && cfg.format != "" {
+		return nil, fmt.Errorf("--tables csv cannot be used with --format")
+	}
+	if modes := cfg.outputModes(); len(modes) > 0 && cfg.documentEncoder() != nil {
+		return nil, fmt.Errorf("%s cannot be used with --format %s", modes[0], cfg.format)
+	}
+	if cfg.lines && cfg.outDir != "" {
+		return nil, fmt.Errorf("--lines and --out-dir cannot be used together")
+	}
+	if cfg.lines && !cfg.jsonOutput() {
+		return nil, fmt.Errorf("--lines cannot be used with --format %s", cfg.format)
+	}
+	if cfg.batch() && cfg.outDir == "" {
+		// Outputs that are not a JSON value cannot be combined
+		if option := cfg.textOutput(); option != "" {
+			return nil, fmt.Errorf("%s needs --out-dir to convert multiple inputs", option)
+		}
+	}
+	return cfg, nil
+}
+
+// outputModes returns the options selecting what is extracted from the document
+func (cfg *config) outputModes() []string {
+	var modes []string
+	if cfg.xpath != "" {
+		modes = append(modes, "--xpath")
+	}
+	if cfg.ndjson {
+		modes = append(modes, "--ndjson")
+	}
+	if cfg.tables != "" {
+		modes = append(modes, "--tables")
+	}
+	if cfg.forms {
+		modes = append(modes, "--forms")
+	}
+	if cfg.links {
+		modes = append(modes, "--links")
+	}
+	if cfg.meta {
+		modes = append(modes, "--meta")
+	}
+	if cfg.structuredData {
+		modes = append(modes, "--structured-data")
+	}
+	if cfg.article {
+		modes = append(modes, "--article")
+	}
+	return modes
+}
+
+// crawlConflict returns an option that selects an output or input that
+// crawl does not support, or "" when there is none
+func (cfg *config) crawlConflict() string {
+	if modes := cfg.outputModes(); len(modes) > 0 {
+		return modes[0]
+	}
+	switch {
+	case cfg.reverse:
+		return "--reverse"
+	case !cfg.jsonOutput():
+		return "--format " + cfg.format
+	case cfg.fragment:
+		return "--fragment"
+	case cfg.metadata:
+		return "--metadata"
+	case cfg.selector != "":
+		return "--select"
+	case cfg.inputList != "":
+		return "--input-list"
+	case cfg.outDir != "":
+		return "--out-dir"
+	case cfg.lines:
+		return "--lines"
+	case cfg.recursive:
+		return "--recursive"
+	case cfg.jobs != 0:
+		return "--jobs"
+	}
+	return ""
+}
+
+// batch reports whether several inputs are converted at once, as they are
+// for multiple inputs, globs, directories, an input list or an output directory
+func (cfg *config) batch() bool {
+	if cfg.crawl {
+		return false
+	}
+	if len(cfg.inputs) > 1 || cfg.inputList != "" || cfg.outDir != "" || cfg.lines || cfg.recursive {
+		return true
+	}
+	return len(cfg.inputs) == 1 && isGlob(cfg.inputs[0])
+}
+
+// textOutput returns the option selecting an output that is not a single
+// JSON value, such as HTML, NDJSON, CSV or text, or "" for JSON output
+func (cfg *config) textOutput() string {
+	switch {
+	case cfg.reverse:
+		return "--reverse"
+	case cfg.ndjson:
+		return "--ndjson"
+	case cfg.tables == "csv":
+		return "--tables csv"
+	case cfg.documentEncoder() != nil:
+		return "--format " + cfg.format
+	}
+	return ""
+}
+
+// withInput returns a copy of cfg converting input
+func (cfg *config) withInput(input string) *config {
+	c := *cfg
+	c.input = input
+	return &c
+}
+
+// fileExists reports whether a file or directory exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// optionValue returns the value of the option at args[*i] given as
+// "--name=value" or "--name value", advancing *i past a separate value
+func optionValue(args []string, i *int, name string) (string, error) {
+	if value, ok := strings.CutPrefix(args[*i], name+"="); ok {
+		return value, nil
+	}
+	if *i+1 >= len(args) {
+		return "", fmt.Errorf("option %s requires a value", name)
+	}
+	*i++
+	return args[*i], nil
+}
+
+// parseTimeout parses the value of a timeout option given in seconds, such
+// as "10" or "1.5", or as a duration with a unit, such as "500ms"
+func parseTimeout(name, value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, perr := strconv.ParseFloat(value, 64)
+		if perr != nil {
+			return 0, fmt.Errorf("invalid %s: %s", name, value)
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return timeout, nil
+}
+
+// fetcher returns the HTTP client configured by the command line options,
+// reading the cookie file and CA bundle when they are given
+func (cfg *config) fetcher() (*hj.Fetcher, error) {
+	fetcher := &hj.Fetcher{
+		ConnectTimeout: cfg.connectTimeout,
+		ReadTimeout:    cfg.readTimeout,
+		UserAgent:      cfg.userAgent,
+		BearerToken:    cfg.bearer,
+
+		Retries:          cfg.retries,
+		RetryWait:        cfg.retryWait,
+		MaxRetryWait:     cfg.maxRetryWait,
+		AllowErrorStatus: cfg.allowHTTPErrors,
+	}
+	for _, header := range cfg.headers {
+		if fetcher.Header == nil {
+			fetcher.Header = http.Header{}
+		}
+		key, value, _ := strings.Cut(header, ":")
+		fetcher.Header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	if cfg.proxy != "" {
+		fetcher.Proxy, _ = url.Parse(cfg.proxy)
+	}
+	if cfg.user != "" {
+		fetcher.Username, fetcher.Password, _ = strings.Cut(cfg.user, ":")
+	}
+	if cfg.cookies != "" {
+		jar, err := hj.LoadCookieFile(cfg.cookies)
+		if err != nil {
+			return nil, err
+		}
+		fetcher.Jar = jar
+	}
+	if cfg.cacert != "" {
+		pool, err := hj.LoadCertPool(cfg.cacert)
+		if err != nil {
+			return nil, err
+		}
+		fetcher.TLSConfig = &tls.Config{RootCAs: pool}
+	}
+	if cfg.insecure {
+		fetcher.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return fetcher, nil
+}
+
+// readInput reads raw content from file, URL, or stdin. URLs are fetched
+// with fetcher, or with the default settings when it is nil, and a warning
+// naming the input is written to errw for error pages read with
+// --allow-http-errors.
+// For URLs the Content-Type header of the response is returned as well.
+// The source of the content is returned last: the final URL after
+// redirects for URLs, or input itself otherwise.
+func readInput(input string, fetcher *hj.Fetcher, errw io.Writer) ([]byte, string, string, error) {
 	if input == "" {
 		showHelp()
 		os.Exit(0)
@@ -38,36 +692,779 @@ func getHTML(input string) (string, error) {
 		// Read from stdin
 		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			return "", fmt.Errorf("failed to read from stdin: %v", err)
+			return nil, "", "", fmt.Errorf("failed to read from stdin: %v", err)
 		}
-		return string(data), nil
+		return data, "", input, nil
 	}
 
-	if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+	if isURL(input) {
 		// Fetch HTML from URL
-		resp, err := http.Get(input)
+		if fetcher == nil {
+			fetcher = &hj.Fetcher{}
+		}
+		result, err := fetcher.Fetch(context.Background(), input)
 		if err != nil {
-			return "", fmt.Errorf("failed to fetch URL: %v", err)
+			return nil, "", "", err
+		}
+		if result.StatusCode != http.StatusOK {
+			// The page is converted when errors are allowed, but the status is still reported
+			fmt.Fprintf(errw, "Warning: %s: HTTP error: %d\n", input, result.StatusCode)
 		}
-		defer resp.Body.Close()
+		return result.Body, result.ContentType(), result.URL, nil
+	}
+
+	// Read from file
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read file: %v", err)
+	}
+	return data, "", input, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("HTTP error: %d", resp.StatusCode)
+// getHTML retrieves HTML from file, URL, or stdin and converts it to UTF-8.
+// The character encoding is detected unless it is given by encoding, and
+// URLs are fetched as in readInput, with warnings written to errw.
+// It returns the HTML, the name of the encoding that was used and the
+// source of the HTML, which is the final URL after redirects for URLs.
+func getHTML(input, encoding string, fetcher *hj.Fetcher, errw io.Writer) (string, string, string, error) {
+	data, contentType, source, err := readInput(input, fetcher, errw)
+	if err != nil {
+		return "", "", "", err
+	}
+	content, name, err := hj.DecodeHTML(data, contentType, encoding)
+	if err != nil {
+		return "", "", "", err
+	}
+	return content, name, source, nil
+}
+
+// options returns the conversion options selected on the command line
+func (cfg *config) options() hj.Options {
+	return hj.Options{
+		Lossless:        cfg.lossless,
+		Fragment:        cfg.fragment,
+		FragmentContext: cfg.fragmentContext,
+		Metadata:        cfg.metadata,
+		Compact:         cfg.format == "json-compact",
+	}
+}
+
+// jsonOutput reports whether the output format is JSON, which is written
+// as converted without going through an encoder
+func (cfg *config) jsonOutput() bool {
+	return cfg.format == "" || cfg.format == "json" || cfg.format == "json-compact"
+}
+
+// documentEncoder returns the encoder of the output format when it renders
+// the document itself, as text and markdown do, or nil otherwise
+func (cfg *config) documentEncoder() hj.Encoder {
+	enc, err := hj.LookupEncoder(cfg.format)
+	if err != nil {
+		return nil
+	}
+	if _, ok := enc.(hj.DocumentEncoder); !ok {
+		return nil
+	}
+	return enc
+}
+
+// convertHTML converts decoded HTML to JSON as selected on the command line
+func convertHTML(cfg *config, content, encoding string) ([]byte, error) {
+	opts := cfg.options()
+	doc, err := hj.ParseWithOptions(strings.NewReader(content), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only the selected subtrees
+	if cfg.selector != "" {
+		nodes, err := hj.Select(doc, cfg.selector)
+		if err != nil {
+			return nil, err
 		}
+		doc = &hj.Document{Children: nodes, Fragment: true}
+	}
+	doc.Metadata = &hj.Metadata{Source: cfg.input, Encoding: encoding}
 
-		data, err := io.ReadAll(resp.Body)
+	if cfg.xpath != "" {
+		return doc.XPathToJSON(cfg.xpath, opts)
+	}
+	if cfg.tables == "csv" {
+		var buf bytes.Buffer
+		if err := hj.WriteTablesCSV(&buf, hj.ExtractTables(doc)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if cfg.tables != "" {
+		return hj.TablesToJSON(hj.ExtractTables(doc), cfg.tables == "objects", opts)
+	}
+	if cfg.forms {
+		return hj.FormsToJSON(hj.ExtractForms(doc), opts)
+	}
+	if cfg.links {
+		return hj.LinksToJSON(hj.ExtractLinks(doc), opts)
+	}
+	if cfg.meta {
+		return hj.PageMetaToJSON(hj.ExtractPageMeta(doc), opts)
+	}
+	if cfg.structuredData {
+		return hj.StructuredDataToJSON(hj.ExtractStructuredData(doc), opts)
+	}
+	if cfg.article {
+		return hj.ArticleToJSON(hj.ExtractArticle(doc), opts)
+	}
+	if cfg.ndjson {
+		var buf bytes.Buffer
+		if err := doc.WriteNDJSON(&buf, opts); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if enc := cfg.documentEncoder(); enc != nil {
+		var buf bytes.Buffer
+		if err := doc.Encode(&buf, enc, opts); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return doc.ToJSON(opts)
+}
+
+// convertToHTML converts hj output back to HTML. The input is read as JSON
+// unless another format is selected.
+func convertToHTML(cfg *config, content []byte) (string, error) {
+	if cfg.format == "" {
+		return hj.JSONtoHTML(string(content))
+	}
+
+	dec, err := hj.LookupDecoder(cfg.format)
+	if err != nil {
+		return "", err
+	}
+	doc, err := hj.DecodeDocument(bytes.NewReader(content), dec)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := doc.Render(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// canStream reports whether the input can be converted without building the
+// document tree. Streaming is used for local files and stdin in the default
+// output mode only.
+func canStream(cfg *config) bool {
+	if cfg.input == "" || !cfg.jsonOutput() || len(cfg.outputModes()) > 0 || cfg.lossless || cfg.fragment || cfg.metadata || cfg.selector != "" {
+		return false
+	}
+	return !isURL(cfg.input)
+}
+
+// isURL reports whether an input is an HTTP or HTTPS URL
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// spoolStdin copies stdin to a temporary file so that it can be read twice.
+// The caller removes the file when it is no longer needed.
+func spoolStdin() (string, error) {
+	f, err := os.CreateTemp("", "hj-*.html")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to read from stdin: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// openDecoded opens a file and returns a reader of its content in UTF-8
+func openDecoded(path, encoding string) (*os.File, io.Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	r, _, err := hj.NewDecodingReader(f, "", encoding)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, r, nil
+}
+
+// utf8Checker reads from r and records whether everything read is valid UTF-8
+type utf8Checker struct {
+	r       io.Reader
+	pending []byte // the start of a character cut off at the end of the last read
+	invalid bool
+}
+
+func (c *utf8Checker) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if !c.invalid && n > 0 {
+		data := append(c.pending, p[:n]...)
+		end := len(data)
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					end = i
+				}
+				break
+			}
+		}
+		c.invalid = !utf8.Valid(data[:end])
+		c.pending = append([]byte(nil), data[end:]...)
+	}
+	if err == io.EOF && len(c.pending) > 0 {
+		c.invalid = true
+	}
+	return n, err
+}
+
+// streamHTML converts the HTML file at path to JSON as it is read, keeping
+// memory use bounded for very large documents. The file is read twice: first
+// to check that the streaming output will match the tree-based conversion,
+// then to write the JSON to w. It returns false without writing anything when
+// the document is not well-formed enough to be streamed, or when UTF-8 was
+// chosen from the start of the file but the rest of it is not UTF-8.
+func streamHTML(path, encoding string, opts hj.Options, w io.Writer) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %v", err)
+	}
+	raw := &utf8Checker{r: f}
+	r, name, err := hj.NewDecodingReader(raw, "", encoding)
+	if err == nil {
+		if err = hj.CheckWellFormed(r); err == nil {
+			// The whole file is read to check its encoding
+			if _, err = io.Copy(io.Discard, r); err != nil {
+				err = fmt.Errorf("failed to read file: %v", err)
+			}
+		}
+	}
+	f.Close()
+	if errors.Is(err, hj.ErrNotWellFormed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if encoding == "" && name == "utf-8" && raw.invalid {
+		// The tree-based conversion detects the encoding from the whole file
+		return false, nil
+	}
+
+	f, r, err = openDecoded(path, encoding)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(w)
+	if err := hj.StreamHTMLtoJSON(r, bw, opts); err != nil {
+		return false, err
+	}
+	bw.WriteString("\n")
+	if err := bw.Flush(); err != nil {
+		return false, fmt.Errorf("failed to write output: %v", err)
+	}
+	return true, nil
+}
+
+// crawl crawls the site of cfg.input and writes one JSON line per page to w
+func crawl(ctx context.Context, cfg *config, fetcher *hj.Fetcher, w io.Writer) error {
+	opts := cfg.options()
+	opts.Compact = true
+	crawler := &hj.Crawler{
+		Fetcher:      fetcher,
+		MaxDepth:     cfg.depth,
+		MaxPages:     cfg.maxPages,
+		Delay:        cfg.delay,
+		IgnoreRobots: cfg.ignoreRobots,
+		Options:      opts,
+	}
+	return crawler.Crawl(ctx, cfg.input, func(page *hj.CrawlPage) error {
+		line, err := hj.CrawlPageToJSON(page, opts)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+		return nil
+	})
+}
+
+// isGlob reports whether an input is a file name pattern to expand
+func isGlob(input string) bool {
+	return !isURL(input) && strings.ContainsAny(input, "*?[")
+}
+
+// batchInput is an input of a batch conversion
+type batchInput struct {
+	source string
+	// name is the path of a file found in a directory relative to the
+	// directory without its extension, used for the output file
+	name string
+	// err is the error found while expanding the input, such as a
+	// pattern that matches no files
+	err error
+}
+
+// expandInputs returns the inputs given on the command line and in the input
+// list, with patterns expanded to the files they match and duplicates removed
+func expandInputs(cfg *config) ([]batchInput, error) {
+	sources := slices.Clone(cfg.inputs)
+	if cfg.inputList != "" {
+		list, err := readInputList(cfg.inputList)
 		if err != nil {
-			return "", fmt.Errorf("failed to read response: %v", err)
+			return nil, err
 		}
-		return string(data), nil
+		if cfg.inputList == "-" && slices.Contains(list, "-") {
+			return nil, fmt.Errorf("stdin cannot be both the input list and an input")
+		}
+		sources = append(sources, list...)
 	}
 
-	// Read from file
-	data, err := os.ReadFile(input)
+	var inputs []batchInput
+	seen := map[string]bool{}
+	add := func(input batchInput) {
+		if input.err == nil && seen[input.source] {
+			return
+		}
+		seen[input.source] = true
+		inputs = append(inputs, input)
+	}
+	addPath := func(source string) {
+		if info, err := os.Stat(source); err == nil && info.IsDir() && cfg.recursive {
+			for _, input := range walkInputs(cfg, source) {
+				add(input)
+			}
+			return
+		}
+		add(batchInput{source: source})
+	}
+	for _, source := range sources {
+		if isURL(source) || source == "-" {
+			add(batchInput{source: source})
+			continue
+		}
+		// A file whose name has pattern characters is taken as it is
+		if _, err := os.Stat(source); err == nil || !isGlob(source) {
+			addPath(source)
+			continue
+		}
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			add(batchInput{source: source, err: fmt.Errorf("invalid pattern: %v", err)})
+			continue
+		}
+		if len(matches) == 0 {
+			add(batchInput{source: source, err: fmt.Errorf("no files match the pattern")})
+		}
+		for _, match := range matches {
+			addPath(match)
+		}
+	}
+	return inputs, nil
+}
+
+// walkInputs returns the files to convert in the directory root and its
+// subdirectories, named by their paths relative to root
+func walkInputs(cfg *config, root string) []batchInput {
+	var inputs []batchInput
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			inputs = append(inputs, batchInput{source: path, err: fmt.Errorf("failed to read directory: %v", err)})
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.ContainsFunc(cfg.exclude, func(pattern string) bool { return matchPattern(pattern, rel) }) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !cfg.included(rel) {
+			return nil
+		}
+		inputs = append(inputs, batchInput{source: path, name: strings.TrimSuffix(rel, pathpkg.Ext(rel))})
+		return nil
+	})
+	return inputs
+}
+
+// included reports whether a file found in a directory is converted: by
+// default the .html and .htm files, or the files matching --include
+func (cfg *config) included(rel string) bool {
+	if len(cfg.include) > 0 {
+		return slices.ContainsFunc(cfg.include, func(pattern string) bool { return matchPattern(pattern, rel) })
+	}
+	ext := pathpkg.Ext(rel)
+	return strings.EqualFold(ext, ".html") || strings.EqualFold(ext, ".htm")
+}
+
+// matchPattern reports whether a path relative to the walked directory
+// matches a pattern. Patterns with a slash are matched against the whole
+// path and other patterns against the last element of the path.
+func matchPattern(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		rel = pathpkg.Base(rel)
+	}
+	matched, _ := pathpkg.Match(pattern, rel)
+	return matched
+}
+
+// upToDate reports whether the output file at path was written after the
+// input file was last changed. Stdin and URLs are never up to date.
+func upToDate(source, path string) bool {
+	if source == "-" || isURL(source) {
+		return false
+	}
+	in, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+	out, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return out.ModTime().After(in.ModTime())
+}
+
+// readInputList reads the paths and URLs listed one per line in a file, or in
+// stdin for "-". Empty lines and lines starting with # are skipped.
+func readInputList(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input list: %v", err)
+	}
+
+	var inputs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs, nil
+}
+
+// outputExtension returns the file name extension of the output selected on the command line
+func (cfg *config) outputExtension() string {
+	switch {
+	case cfg.reverse:
+		return ".html"
+	case cfg.ndjson:
+		return ".ndjson"
+	case cfg.tables == "csv":
+		return ".csv"
+	}
+	switch cfg.format {
+	case "", "json", "json-compact":
+		return ".json"
+	case "text":
+		return ".txt"
+	case "markdown":
+		return ".md"
+	}
+	return "." + cfg.format
+}
+
+// unsafeNameChars matches the characters replaced in output file names
+var unsafeNameChars = regexp.MustCompile(`[^\w.-]+`)
+
+// outputPath returns the path of the file written in dir for the input
+// source. Relative paths keep their directories, and URLs are placed in a
+// directory named after their host.
+func outputPath(dir, source, ext string) string {
+	var parts []string
+	switch {
+	case source == "-":
+		parts = []string{"stdin"}
+	case isURL(source):
+		u, err := url.Parse(source)
+		if err != nil {
+			parts = []string{source}
+			break
+		}
+		parts = []string{u.Host}
+		if path := strings.Trim(u.Path, "/"); path != "" {
+			parts = append(parts, strings.Split(path, "/")...)
+		}
+		if strings.HasSuffix(u.Path, "/") || u.Path == "" {
+			parts = append(parts, "index")
+		}
+		if u.RawQuery != "" {
+			parts[len(parts)-1] += "_" + u.RawQuery
+		}
+	default:
+		path := filepath.Clean(source)
+		if !filepath.IsLocal(path) {
+			path = filepath.Base(path)
+		}
+		parts = strings.Split(filepath.ToSlash(strings.TrimSuffix(path, filepath.Ext(path))), "/")
+	}
+
+	for i, part := range parts {
+		part = unsafeNameChars.ReplaceAllString(part, "_")
+		if part == "" || part == "." || part == ".." {
+			part = "_"
+		}
+		parts[i] = part
+	}
+	return filepath.Join(dir, filepath.Join(parts...)+ext)
+}
+
+// batchResult is the result of converting a batch input
+type batchResult struct {
+	output   []byte
+	warnings []byte
+	err      error
+}
+
+// runBatch converts inputs with cfg.jobs workers. Unless an output directory
+// is given, the outputs are written to w as one object keyed by input, or as
+// one line per input with --lines. Failed inputs and warnings are reported
+// to errw in the order of the inputs, and the number of failed inputs is
+// returned.
+func runBatch(cfg *config, inputs []batchInput, fetcher *hj.Fetcher, w, errw io.Writer) (int, error) {
+	// Find the output files first so that two inputs never write the same file
+	paths := make([]string, len(inputs))
+	if cfg.outDir != "" {
+		written := map[string]string{}
+		for i, input := range inputs {
+			if input.err != nil {
+				continue
+			}
+			if input.name != "" {
+				// Files found in directories mirror the directory tree
+				paths[i] = filepath.Join(cfg.outDir, filepath.FromSlash(input.name)+cfg.outputExtension())
+			} else {
+				paths[i] = outputPath(cfg.outDir, input.source, cfg.outputExtension())
+			}
+			if other, ok := written[paths[i]]; ok {
+				inputs[i].err = fmt.Errorf("output file %s is also written for %s", paths[i], other)
+				continue
+			}
+			written[paths[i]] = input.source
+		}
+	}
+
+	results := make([]chan batchResult, len(inputs))
+	for i := range results {
+		results[i] = make(chan batchResult, 1)
+	}
+	queue := make(chan int)
+	go func() {
+		for i := range inputs {
+			queue <- i
+		}
+		close(queue)
+	}()
+	for range cmp.Or(cfg.jobs, runtime.NumCPU()) {
+		go func() {
+			for i := range queue {
+				results[i] <- convertBatchInput(cfg, inputs[i], paths[i], fetcher)
+			}
+		}()
+	}
+
+	// Write the results in the order of the inputs as they are finished
+	failed := 0
+	var combined bytes.Buffer
+	combined.WriteString("{")
+	for i, input := range inputs {
+		result := <-results[i]
+		errw.Write(result.warnings)
+		if result.err != nil {
+			failed++
+			fmt.Fprintf(errw, "Error: %s: %v\n", input.source, result.err)
+			continue
+		}
+		if cfg.outDir != "" {
+			continue
+		}
+		source, _ := json.Marshal(input.source)
+		if cfg.lines {
+			if _, err := fmt.Fprintf(w, "{\"source\":%s,\"result\":%s}\n", source, result.output); err != nil {
+				return failed, fmt.Errorf("failed to write output: %v", err)
+			}
+			continue
+		}
+		if combined.Len() > 1 {
+			combined.WriteString(",")
+		}
+		combined.Write(source)
+		combined.WriteString(":")
+		combined.Write(result.output)
+	}
+	combined.WriteString("}")
+	if cfg.outDir != "" || cfg.lines {
+		return failed, nil
+	}
+
+	switch cfg.format {
+	case "json-compact":
+		combined.WriteString("\n")
+	case "", "json":
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, combined.Bytes(), "", hj.DefaultIndent); err != nil {
+			return failed, fmt.Errorf("failed to convert to JSON: %v", err)
+		}
+		indented.WriteString("\n")
+		combined = indented
+	default:
+		enc, err := hj.LookupEncoder(cfg.format)
+		if err != nil {
+			return failed, err
+		}
+		var encoded bytes.Buffer
+		if err := hj.Transcode(&encoded, combined.Bytes(), enc); err != nil {
+			return failed, err
+		}
+		combined = encoded
+	}
+	if _, err := w.Write(combined.Bytes()); err != nil {
+		return failed, fmt.Errorf("failed to write output: %v", err)
+	}
+	return failed, nil
+}
+
+// convertBatchInput converts an input of a batch, writing it to the file at
+// path when an output directory is given
+func convertBatchInput(cfg *config, input batchInput, path string, fetcher *hj.Fetcher) batchResult {
+	if input.err != nil {
+		return batchResult{err: input.err}
+	}
+	cfg = cfg.withInput(input.source)
+
+	if path == "" {
+		// The output is combined with the others as compact JSON
+		cfg.format = "json-compact"
+		var buf bytes.Buffer
+		var warnings bytes.Buffer
+		if err := convertInput(cfg, fetcher, &buf, &warnings); err != nil {
+			return batchResult{warnings: warnings.Bytes(), err: err}
+		}
+		return batchResult{output: bytes.TrimSpace(buf.Bytes()), warnings: warnings.Bytes()}
+	}
+
+	if !cfg.force && upToDate(input.source, path) {
+		return batchResult{}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return batchResult{err: fmt.Errorf("failed to create directory: %v", err)}
+	}
+	f, err := os.Create(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return batchResult{err: fmt.Errorf("failed to create output file: %v", err)}
+	}
+	var warnings bytes.Buffer
+	err = convertInput(cfg, fetcher, f, &warnings)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to write output file: %v", cerr)
 	}
-	return string(data), nil
+	if err != nil {
+		os.Remove(path)
+		return batchResult{warnings: warnings.Bytes(), err: err}
+	}
+	return batchResult{warnings: warnings.Bytes()}
+}
+
+// convertInput converts cfg.input as selected on the command line and
+// writes the output to w and warnings to errw
+func convertInput(cfg *config, fetcher *hj.Fetcher, w, errw io.Writer) error {
+	if cfg.reverse {
+		// Get JSON
+		content, _, _, err := readInput(cfg.input, fetcher, errw)
+		if err != nil {
+			return err
+		}
+
+		// Convert JSON to HTML
+		htmlOutput, err := convertToHTML(cfg, content)
+		if err != nil {
+			return err
+		}
+
+		// Output HTML
+		_, err = fmt.Fprintln(w, htmlOutput)
+		return err
+	}
+
+	opts := cfg.options()
+
+	// Stream well-formed documents from files and stdin
+	input := cfg.input
+	if canStream(cfg) {
+		if input == "-" {
+			spooled, err := spoolStdin()
+			if err != nil {
+				return err
+			}
+			defer os.Remove(spooled)
+			input = spooled
+		}
+
+		streamed, err := streamHTML(input, cfg.encoding, opts, w)
+		if err != nil || streamed {
+			return err
+		}
+	}
+
+	// Get HTML
+	content, encoding, source, err := getHTML(input, cfg.encoding, fetcher, errw)
+	if err != nil {
+		return err
+	}
+
+	// Convert HTML to JSON, resolving URLs against the page after redirects
+	if isURL(input) {
+		cfg = cfg.withInput(source)
+	}
+	jsonOutput, err := convertHTML(cfg, content, encoding)
+	if err != nil {
+		return err
+	}
+
+	// Output JSON, or write it in the selected format
+	if cfg.ndjson || cfg.tables == "csv" || cfg.documentEncoder() != nil {
+		_, err = w.Write(jsonOutput)
+		return err
+	}
+	if cfg.jsonOutput() {
+		_, err = fmt.Fprintln(w, string(jsonOutput))
+		return err
+	}
+	enc, err := hj.LookupEncoder(cfg.format)
+	if err != nil {
+		return err
+	}
+	return hj.Transcode(w, jsonOutput, enc)
 }
 
 func main() {
@@ -79,25 +1476,60 @@ func main() {
 		return
 	}
 
-	if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+	cfg, err := parseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.help {
 		showHelp()
 		return
 	}
 
-	// Get HTML
-	htmlContent, err := getHTML(args[0])
+	fetcher, err := cfg.fetcher()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Convert HTML to JSON
-	jsonOutput, err := hj.HTMLtoJSON(htmlContent)
+	if cfg.crawl {
+		// Stop between pages on Ctrl-C, keeping the lines already written
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := crawl(ctx, cfg.withInput(cfg.inputs[0]), fetcher, os.Stdout)
+		stop()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !cfg.batch() {
+		var input string
+		if len(cfg.inputs) > 0 {
+			input = cfg.inputs[0]
+		}
+		if err := convertInput(cfg.withInput(input), fetcher, os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Convert many inputs, reporting the failed ones without stopping
+	inputs, err := expandInputs(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-
-	// Output JSON
-	fmt.Println(jsonOutput)
+	failed, err := runBatch(cfg, inputs, fetcher, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d of %d inputs failed\n", failed, len(inputs))
+		os.Exit(1)
+	}
 }
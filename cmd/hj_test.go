@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	hj "github.com/HARMONICOM/hj"
 )
 
 // TestShowHelp tests the showHelp function
@@ -49,6 +56,148 @@ func TestShowHelp(t *testing.T) {
 	}
 }
 
+// TestParseArgs tests command line argument parsing
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected config
+	}{
+		{"file", []string{"test.html"}, config{inputs: []string{"test.html"}}},
+		{"stdin", []string{"-"}, config{inputs: []string{"-"}}},
+		{"help", []string{"--help"}, config{help: true}},
+		{"short help", []string{"-h"}, config{help: true}},
+		{"reverse", []string{"--reverse", "test.json"}, config{inputs: []string{"test.json"}, reverse: true}},
+		{"short reverse after input", []string{"-", "-r"}, config{inputs: []string{"-"}, reverse: true}},
+		{"lossless", []string{"--lossless", "test.html"}, config{inputs: []string{"test.html"}, lossless: true}},
+		{"fragment", []string{"--fragment", "test.html"}, config{inputs: []string{"test.html"}, fragment: true}},
+		{"fragment with context", []string{"--fragment", "ul", "-"}, config{inputs: []string{"-"}, fragment: true, fragmentContext: "ul"}},
+		{"fragment with context value", []string{"--fragment=tbody", "-"}, config{inputs: []string{"-"}, fragment: true, fragmentContext: "tbody"}},
+		{"encoding", []string{"--encoding", "shift_jis", "test.html"}, config{inputs: []string{"test.html"}, encoding: "shift_jis"}},
+		{"encoding value", []string{"test.html", "--encoding=euc-jp"}, config{inputs: []string{"test.html"}, encoding: "euc-jp"}},
+		{"metadata", []string{"--metadata", "-"}, config{inputs: []string{"-"}, metadata: true}},
+		{"select", []string{"--select", "div > p", "-"}, config{inputs: []string{"-"}, selector: "div > p"}},
+		{"select value", []string{"--select=#main", "-"}, config{inputs: []string{"-"}, selector: "#main"}},
+		{"xpath", []string{"--xpath", "//p", "-"}, config{inputs: []string{"-"}, xpath: "//p"}},
+		{"format", []string{"--format", "yaml", "-"}, config{inputs: []string{"-"}, format: "yaml"}},
+		{"format value", []string{"--format=json-compact", "-"}, config{inputs: []string{"-"}, format: "json-compact"}},
+		{"format text", []string{"--format", "text", "--select", "main", "-"}, config{inputs: []string{"-"}, format: "text", selector: "main"}},
+		{"ndjson", []string{"--ndjson", "--select", "p", "-"}, config{inputs: []string{"-"}, selector: "p", ndjson: true}},
+		{"tables", []string{"--tables", "test.html"}, config{inputs: []string{"test.html"}, tables: "rows"}},
+		{"tables with mode", []string{"--tables", "csv", "-"}, config{inputs: []string{"-"}, tables: "csv"}},
+		{"tables with mode value", []string{"--tables=objects", "-"}, config{inputs: []string{"-"}, tables: "objects"}},
+		{"forms", []string{"--forms", "-"}, config{inputs: []string{"-"}, forms: true}},
+		{"links", []string{"--links", "-"}, config{inputs: []string{"-"}, links: true}},
+		{"meta", []string{"--meta", "--metadata", "-"}, config{inputs: []string{"-"}, meta: true, metadata: true}},
+		{"structured data", []string{"--structured-data", "-"}, config{inputs: []string{"-"}, structuredData: true}},
+		{"article", []string{"--article", "--lossless", "-"}, config{inputs: []string{"-"}, article: true, lossless: true}},
+		{"timeouts", []string{"--connect-timeout", "5", "--read-timeout=1.5", "https://example.com"}, config{inputs: []string{"https://example.com"}, connectTimeout: 5 * time.Second, readTimeout: 1500 * time.Millisecond}},
+		{"timeout with unit", []string{"--read-timeout", "500ms", "-"}, config{inputs: []string{"-"}, readTimeout: 500 * time.Millisecond}},
+		{"headers", []string{"-H", "Accept-Language: ja", "--header=X-Token:abc", "-"}, config{inputs: []string{"-"}, headers: []string{"Accept-Language: ja", "X-Token:abc"}}},
+		{"user agent and cookies", []string{"--user-agent", "bot/1.0", "--cookies", "cookies.txt", "-"}, config{inputs: []string{"-"}, userAgent: "bot/1.0", cookies: "cookies.txt"}},
+		{"basic auth", []string{"--user", "alice:secret", "-"}, config{inputs: []string{"-"}, user: "alice:secret"}},
+		{"bearer", []string{"--bearer=token", "-"}, config{inputs: []string{"-"}, bearer: "token"}},
+		{"proxy and CA bundle", []string{"--proxy", "http://proxy:8080", "--cacert", "ca.pem", "-"}, config{inputs: []string{"-"}, proxy: "http://proxy:8080", cacert: "ca.pem"}},
+		{"insecure", []string{"--insecure", "-"}, config{inputs: []string{"-"}, insecure: true}},
+		{"retries", []string{"--retries", "3", "--retry-wait=200ms", "--max-retry-wait", "10", "-"}, config{inputs: []string{"-"}, retries: 3, retryWait: 200 * time.Millisecond, maxRetryWait: 10 * time.Second}},
+		{"allow HTTP errors", []string{"--allow-http-errors", "-"}, config{inputs: []string{"-"}, allowHTTPErrors: true}},
+		{"multiple inputs", []string{"a.html", "--meta", "https://example.com", "-"}, config{inputs: []string{"a.html", "https://example.com", "-"}, meta: true}},
+		{"batch options", []string{"--input-list", "urls.txt", "-j", "4", "--lines"}, config{inputList: "urls.txt", jobs: 4, lines: true}},
+		{"recursive", []string{"-R", "site", "--include", "*.xhtml", "--exclude=drafts", "--exclude", "tmp/*", "--force"}, config{inputs: []string{"site"}, recursive: true, include: []string{"*.xhtml"}, exclude: []string{"drafts", "tmp/*"}, force: true}},
+		{"output directory", []string{"--jobs=2", "--out-dir", "out", "--ndjson", "*.html"}, config{inputs: []string{"*.html"}, jobs: 2, outDir: "out", ndjson: true}},
+		{"crawl", []string{"crawl", "https://example.com"}, config{inputs: []string{"https://example.com"}, crawl: true, depth: 3, maxPages: 100, delay: time.Second}},
+		{"crawl options", []string{"crawl", "--depth", "0", "--max-pages=0", "--delay", "0", "--ignore-robots", "--lossless", "https://example.com"}, config{inputs: []string{"https://example.com"}, crawl: true, ignoreRobots: true, lossless: true}},
+		{"crawl delay", []string{"crawl", "--delay=500ms", "--format", "json-compact", "https://example.com"}, config{inputs: []string{"https://example.com"}, crawl: true, depth: 3, maxPages: 100, delay: 500 * time.Millisecond, format: "json-compact"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs failed: %v", err)
+			}
+			if !reflect.DeepEqual(*cfg, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *cfg)
+			}
+		})
+	}
+}
+
+// TestParseArgsFragmentFile tests that an input file named like an element is not taken as the fragment context
+func TestParseArgsFragmentFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("main", []byte("<p>a</p>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cfg, err := parseArgs([]string{"--fragment", "main"})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	expected := config{inputs: []string{"main"}, fragment: true}
+	if !reflect.DeepEqual(*cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, *cfg)
+	}
+}
+
+// TestParseArgsErrors tests invalid command line arguments
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"unknown option", []string{"--unknown"}, "unknown option: --unknown"},
+		{"missing value", []string{"a.html", "--encoding"}, "option --encoding requires a value"},
+		{"missing selector", []string{"a.html", "--select"}, "option --select requires a value"},
+		{"unknown format", []string{"--format", "csv", "a.html"}, "unknown format: csv"},
+		{"ndjson and format", []string{"--ndjson", "--format", "yaml"}, "--ndjson cannot be used with --format"},
+		{"links and markdown", []string{"--links", "--format", "markdown", "-"}, "--links cannot be used with --format markdown"},
+		{"unknown table mode", []string{"--tables=html", "a.html"}, "unknown table mode: html"},
+		{"tables and ndjson", []string{"--tables", "--ndjson", "a.html"}, "--ndjson and --tables cannot be used together"},
+		{"forms and xpath", []string{"--forms", "--xpath", "//form"}, "--xpath and --forms cannot be used together"},
+		{"meta and structured data", []string{"--structured-data", "--meta", "-"}, "--meta and --structured-data cannot be used together"},
+		{"article and links", []string{"--links", "--article", "-"}, "--links and --article cannot be used together"},
+		{"table csv and format", []string{"--tables", "csv", "--format", "yaml"}, "--tables csv cannot be used with --format"},
+		{"select and xpath", []string{"--select", "p", "--xpath", "//p"}, "--select and --xpath cannot be used together"},
+		{"invalid timeout", []string{"--connect-timeout", "soon", "-"}, "invalid --connect-timeout: soon"},
+		{"zero timeout", []string{"--read-timeout", "0", "-"}, "invalid --read-timeout: 0"},
+		{"invalid header", []string{"-H", "Accept-Language ja", "-"}, "invalid header: Accept-Language ja"},
+		{"missing header", []string{"-", "-H"}, "option -H requires a value"},
+		{"invalid proxy", []string{"--proxy", "proxy:8080", "-"}, "invalid proxy URL: proxy:8080"},
+		{"user and bearer", []string{"--user", "a:b", "--bearer", "t", "-"}, "--user and --bearer cannot be used together"},
+		{"cacert and insecure", []string{"--cacert", "ca.pem", "--insecure", "-"}, "--cacert and --insecure cannot be used together"},
+		{"invalid retries", []string{"--retries", "-1", "-"}, "invalid --retries: -1"},
+		{"invalid retry wait", []string{"--retry-wait=later", "-"}, "invalid --retry-wait: later"},
+		{"invalid pattern", []string{"-R", "--exclude", "[a", "site"}, "invalid --exclude pattern: [a"},
+		{"invalid jobs", []string{"-j", "0", "a.html"}, "invalid -j: 0"},
+		{"lines and out dir", []string{"--lines", "--out-dir", "out", "a.html"}, "--lines and --out-dir cannot be used together"},
+		{"lines and yaml", []string{"--lines", "--format", "yaml", "a.html"}, "--lines cannot be used with --format yaml"},
+		{"ndjson with multiple inputs", []string{"--ndjson", "a.html", "b.html"}, "--ndjson needs --out-dir to convert multiple inputs"},
+		{"reverse with a pattern", []string{"--reverse", "*.json"}, "--reverse needs --out-dir to convert multiple inputs"},
+		{"markdown with an input list", []string{"--format", "markdown", "--input-list", "urls.txt"}, "--format markdown needs --out-dir to convert multiple inputs"},
+		{"depth without crawl", []string{"--depth", "2", "https://example.com"}, "--depth can only be used with crawl"},
+		{"invalid depth", []string{"crawl", "--depth", "-1", "https://example.com"}, "invalid --depth: -1"},
+		{"invalid max pages", []string{"crawl", "--max-pages=many", "https://example.com"}, "invalid --max-pages: many"},
+		{"invalid delay", []string{"crawl", "--delay", "soon", "https://example.com"}, "invalid --delay: soon"},
+		{"crawl without URL", []string{"crawl"}, "crawl needs one start URL"},
+		{"crawl a file", []string{"crawl", "index.html"}, "crawl needs one start URL"},
+		{"crawl two URLs", []string{"crawl", "https://a.example", "https://b.example"}, "crawl needs one start URL"},
+		{"crawl and meta", []string{"crawl", "--meta", "https://example.com"}, "--meta cannot be used with crawl"},
+		{"crawl and yaml", []string{"crawl", "--format", "yaml", "https://example.com"}, "--format yaml cannot be used with crawl"},
+		{"crawl and out dir", []string{"crawl", "--out-dir", "out", "https://example.com"}, "--out-dir cannot be used with crawl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseArgs(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing '%s', got %v", tt.err, err)
+			}
+		})
+	}
+}
+
 // TestGetHTMLWithFile tests getHTML with file input
 func TestGetHTMLWithFile(t *testing.T) {
 	// テスト用の一時ファイルを作成
@@ -62,7 +211,7 @@ func TestGetHTMLWithFile(t *testing.T) {
 	}
 
 	// getHTML関数をテスト
-	result, err := getHTML(testFile)
+	result, _, _, err := getHTML(testFile, "", nil, io.Discard)
 	if err != nil {
 		t.Fatalf("getHTML failed: %v", err)
 	}
@@ -74,7 +223,7 @@ func TestGetHTMLWithFile(t *testing.T) {
 
 // TestGetHTMLWithNonExistentFile tests getHTML with non-existent file
 func TestGetHTMLWithNonExistentFile(t *testing.T) {
-	result, err := getHTML("non_existent_file.html")
+	result, _, _, err := getHTML("non_existent_file.html", "", nil, io.Discard)
 
 	if err == nil {
 		t.Error("Expected error for non-existent file, but got none")
@@ -100,7 +249,7 @@ func TestGetHTMLWithURL(t *testing.T) {
 	defer server.Close()
 
 	// getHTML関数をテスト
-	result, err := getHTML(server.URL)
+	result, _, _, err := getHTML(server.URL, "", nil, io.Discard)
 	if err != nil {
 		t.Fatalf("getHTML with URL failed: %v", err)
 	}
@@ -112,7 +261,7 @@ func TestGetHTMLWithURL(t *testing.T) {
 
 // TestGetHTMLWithInvalidURL tests getHTML with invalid URL
 func TestGetHTMLWithInvalidURL(t *testing.T) {
-	result, err := getHTML("https://invalid-url-that-does-not-exist.example")
+	result, _, _, err := getHTML("https://invalid-url-that-does-not-exist.example", "", nil, io.Discard)
 
 	if err == nil {
 		t.Error("Expected error for invalid URL, but got none")
@@ -135,7 +284,7 @@ func TestGetHTMLWithHTTPError(t *testing.T) {
 	}))
 	defer server.Close()
 
-	result, err := getHTML(server.URL)
+	result, _, _, err := getHTML(server.URL, "", nil, io.Discard)
 
 	if err == nil {
 		t.Error("Expected error for HTTP 404, but got none")
@@ -150,6 +299,163 @@ func TestGetHTMLWithHTTPError(t *testing.T) {
 	}
 }
 
+// TestGetHTMLWithRetries tests retrying temporary errors and converting error pages
+func TestGetHTMLWithRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch {
+		case r.URL.Path == "/missing":
+			http.Error(w, "<p>Not Found</p>", http.StatusNotFound)
+		case attempts < 3:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "<p>ok</p>")
+		}
+	}))
+	defer server.Close()
+
+	// 503は再試行され、3回目で成功する
+	cfg, err := parseArgs([]string{"--retries", "2", "--retry-wait", "1ms", server.URL})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	fetcher, err := cfg.fetcher()
+	if err != nil {
+		t.Fatalf("fetcher failed: %v", err)
+	}
+	result, _, _, err := getHTML(server.URL, "", fetcher, io.Discard)
+	if err != nil || result != "<p>ok</p>" || attempts != 3 {
+		t.Errorf("Expected <p>ok</p> after 3 attempts, got '%s' after %d (%v)", result, attempts, err)
+	}
+
+	// 404のページは--allow-http-errorsで変換できる
+	if _, _, _, err := getHTML(server.URL+"/missing", "", fetcher, io.Discard); err == nil || err.Error() != "HTTP error: 404" {
+		t.Errorf("Expected 'HTTP error: 404', got %v", err)
+	}
+	cfg.allowHTTPErrors = true
+	if fetcher, err = cfg.fetcher(); err != nil {
+		t.Fatalf("fetcher failed: %v", err)
+	}
+	var warnings strings.Builder
+	result, _, _, err = getHTML(server.URL+"/missing", "", fetcher, &warnings)
+	if err != nil || result != "<p>Not Found</p>\n" {
+		t.Errorf("Expected the error page, got '%s' (%v)", result, err)
+	}
+	if expected := "Warning: " + server.URL + "/missing: HTTP error: 404\n"; warnings.String() != expected {
+		t.Errorf("Expected warning %q, got %q", expected, warnings.String())
+	}
+
+	// 一括変換では警告を入力の順に報告する
+	inputs := []batchInput{{source: server.URL + "/missing"}, {source: server.URL + "/"}, {source: server.URL + "/missing?page=2"}}
+	var out, errs strings.Builder
+	failed, err := runBatch(&config{jobs: 3, format: "json-compact", allowHTTPErrors: true}, inputs, fetcher, &out, &errs)
+	if err != nil || failed != 0 {
+		t.Fatalf("runBatch failed: %d %v", failed, err)
+	}
+	expected := "Warning: " + server.URL + "/missing: HTTP error: 404\nWarning: " + server.URL + "/missing?page=2: HTTP error: 404\n"
+	if errs.String() != expected {
+		t.Errorf("Expected warnings:\n%s\nGot:\n%s", expected, errs.String())
+	}
+}
+
+// TestGetHTMLWithFetcher tests fetching URLs with the HTTP options
+func TestGetHTMLWithFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("session")
+		fmt.Fprintf(w, "<p>%s|%s|%s|%v</p>", r.UserAgent(), r.Header.Get("Accept-Language"), r.Header.Get("Authorization"), cookie)
+	}))
+	defer server.Close()
+
+	// サーバーのホスト名でクッキーファイルを作成
+	host := strings.TrimPrefix(server.URL, "http://")
+	host = host[:strings.LastIndex(host, ":")]
+	cookies := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(cookies, []byte(host+"\tFALSE\t/\tFALSE\t0\tsession\tabc\n"), 0644); err != nil {
+		t.Fatalf("Failed to create cookie file: %v", err)
+	}
+
+	cfg, err := parseArgs([]string{"-H", "Accept-Language: ja", "--user-agent", "bot/1.0", "--bearer", "token", "--cookies", cookies, server.URL})
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	fetcher, err := cfg.fetcher()
+	if err != nil {
+		t.Fatalf("fetcher failed: %v", err)
+	}
+	result, _, _, err := getHTML(cfg.inputs[0], "", fetcher, io.Discard)
+	if err != nil {
+		t.Fatalf("getHTML failed: %v", err)
+	}
+	if expected := "<p>bot/1.0|ja|Bearer token|session=abc</p>"; result != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, result)
+	}
+
+	// 読み込めないファイルはエラーになる
+	for _, args := range [][]string{{"--cookies", "missing.txt", "-"}, {"--cacert", "missing.pem", "-"}} {
+		cfg, err := parseArgs(args)
+		if err != nil {
+			t.Fatalf("parseArgs failed: %v", err)
+		}
+		if _, err := cfg.fetcher(); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+// TestGetHTMLWithEncoding tests character encoding detection and conversion
+func TestGetHTMLWithEncoding(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// "あ" in Shift_JIS and EUC-JP
+	sjisFile := filepath.Join(tempDir, "sjis.html")
+	if err := os.WriteFile(sjisFile, []byte("<meta charset=\"Shift_JIS\"><p>\x82\xa0</p>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	eucFile := filepath.Join(tempDir, "euc.html")
+	if err := os.WriteFile(eucFile, []byte("<p>\xa4\xa2</p>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=EUC-JP")
+		w.Write([]byte("<p>\xa4\xa2</p>"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		input    string
+		encoding string
+		expected string
+		detected string
+	}{
+		{"meta charset", sjisFile, "", "<meta charset=\"Shift_JIS\"><p>あ</p>", "shift_jis"},
+		{"forced encoding", eucFile, "euc-jp", "<p>あ</p>", "euc-jp"},
+		{"content type header", server.URL, "", "<p>あ</p>", "euc-jp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, detected, _, err := getHTML(tt.input, tt.encoding, nil, io.Discard)
+			if err != nil {
+				t.Fatalf("getHTML failed: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, result)
+			}
+			if detected != tt.detected {
+				t.Errorf("Expected encoding '%s', got '%s'", tt.detected, detected)
+			}
+		})
+	}
+
+	if _, _, _, err := getHTML(eucFile, "no-such-encoding", nil, io.Discard); err == nil || !strings.Contains(err.Error(), "unknown encoding") {
+		t.Errorf("Expected 'unknown encoding' error, got %v", err)
+	}
+}
+
 // TestGetHTMLWithStdin tests getHTML with stdin input (-)
 func TestGetHTMLWithStdin(t *testing.T) {
 	// stdinをモック
@@ -165,7 +471,7 @@ func TestGetHTMLWithStdin(t *testing.T) {
 	}()
 
 	// getHTML関数をテスト
-	result, err := getHTML("-")
+	result, _, _, err := getHTML("-", "", nil, io.Discard)
 
 	// stdinを復元
 	os.Stdin = oldStdin
@@ -179,6 +485,696 @@ func TestGetHTMLWithStdin(t *testing.T) {
 	}
 }
 
+// TestConvertHTML tests conversion with the command line options
+func TestConvertHTML(t *testing.T) {
+	content := `<div id="content"><p class="lead">Lead</p><p>Text</p></div><p class="lead">Other</p>`
+
+	tests := []struct {
+		name     string
+		cfg      config
+		expected string
+	}{
+		{
+			name:     "select",
+			cfg:      config{selector: "div#content > p.lead"},
+			expected: "[\n    {\n        \"p\": {\n            \"attributes\": {\n                \"class\": \"lead\"\n            },\n            \"child\": \"Lead\"\n        }\n    }\n]",
+		},
+		{
+			name:     "xpath attribute values",
+			cfg:      config{xpath: "//p/@class"},
+			expected: "[\n    \"lead\",\n    \"lead\"\n]",
+		},
+		{
+			name:     "xpath number",
+			cfg:      config{xpath: "count(//p)"},
+			expected: "3",
+		},
+		{
+			name:     "select nothing",
+			cfg:      config{selector: "table"},
+			expected: "[]",
+		},
+		{
+			name:     "json-compact",
+			cfg:      config{selector: "p", format: "json-compact"},
+			expected: `[{"p":{"attributes":{"class":"lead"},"child":"Lead"}},{"p":{"child":"Text"}},{"p":{"attributes":{"class":"lead"},"child":"Other"}}]`,
+		},
+		{
+			name: "ndjson",
+			cfg:  config{selector: "p.lead", ndjson: true},
+			expected: `{"tag":"p","attributes":{"class":"lead"},"text":"Lead","depth":3,"index":0,"path":"/html/body/div#content/p[1]","parent":"/html/body/div#content"}
+{"tag":"p","attributes":{"class":"lead"},"text":"Other","depth":2,"index":1,"path":"/html/body/p","parent":"/html/body"}
+`,
+		},
+		{
+			name:     "text",
+			cfg:      config{selector: "#content", format: "text"},
+			expected: "Lead\n\nText\n",
+		},
+		{
+			name:     "markdown",
+			cfg:      config{format: "markdown"},
+			expected: "Lead\n\nText\n\nOther\n",
+		},
+		{
+			name:     "select with metadata",
+			cfg:      config{input: "test.html", selector: "#content", metadata: true},
+			expected: "{\n    \"metadata\": {\n        \"source\": \"test.html\",\n        \"encoding\": \"utf-8\"\n    },\n    \"document\": [\n        {\n            \"div#content\": {\n                \"child\": [\n                    {\n                        \"p\": {\n                            \"attributes\": {\n                                \"class\": \"lead\"\n                            },\n                            \"child\": \"Lead\"\n                        }\n                    },\n                    {\n                        \"p\": {\n                            \"child\": \"Text\"\n                        }\n                    }\n                ]\n            }\n        }\n    ]\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertHTML(&tt.cfg, content, "utf-8")
+			if err != nil {
+				t.Fatalf("convertHTML failed: %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := convertHTML(&config{selector: "p:hover"}, content, ""); err == nil {
+		t.Error("Expected error for unsupported selector, but got none")
+	}
+	if _, err := convertHTML(&config{xpath: "//p["}, content, ""); err == nil {
+		t.Error("Expected error for invalid XPath, but got none")
+	}
+}
+
+// TestConvertHTMLTables tests the output modes of --tables
+func TestConvertHTMLTables(t *testing.T) {
+	content := `<table><tr><th>Name</th><th>Price</th></tr><tr><td>A</td><td>100</td></tr></table>`
+
+	tests := []struct {
+		cfg      config
+		expected string
+	}{
+		{
+			cfg:      config{tables: "rows", format: "json-compact"},
+			expected: `[{"headers":["Name","Price"],"rows":[["A","100"]]}]`,
+		},
+		{
+			cfg:      config{tables: "objects", format: "json-compact"},
+			expected: `[{"headers":["Name","Price"],"rows":[{"Name":"A","Price":"100"}]}]`,
+		},
+		{
+			cfg:      config{tables: "csv"},
+			expected: "Name,Price\nA,100\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cfg.tables, func(t *testing.T) {
+			result, err := convertHTML(&tt.cfg, content, "utf-8")
+			if err != nil {
+				t.Fatalf("convertHTML failed: %v", err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestConvertHTMLForms tests that form actions are resolved against the source URL
+func TestConvertHTMLForms(t *testing.T) {
+	content := `<form action="login" method="post"><label>User <input name="user"></label></form>`
+	cfg := &config{input: "https://example.com/app/", forms: true, format: "json-compact"}
+
+	result, err := convertHTML(cfg, content, "utf-8")
+	if err != nil {
+		t.Fatalf("convertHTML failed: %v", err)
+	}
+	expected := `[{"action":"https://example.com/app/login","method":"post","enctype":"application/x-www-form-urlencoded",` +
+		`"controls":[{"tag":"input","type":"text","name":"user","value":"","label":"User"}]}]`
+	if string(result) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+// TestConvertHTMLLinks tests that links are resolved against the source URL
+func TestConvertHTMLLinks(t *testing.T) {
+	content := `<a href="page.html">Next</a><img src="/logo.png" alt="Logo">`
+	cfg := &config{input: "https://example.com/docs/", links: true, format: "json-compact"}
+
+	result, err := convertHTML(cfg, content, "utf-8")
+	if err != nil {
+		t.Fatalf("convertHTML failed: %v", err)
+	}
+	expected := `[{"url":"https://example.com/docs/page.html","tag":"a","attribute":"href","text":"Next","path":"/html/body/a"},` +
+		`{"url":"https://example.com/logo.png","tag":"img","attribute":"src","text":"Logo","path":"/html/body/img"}]`
+	if string(result) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+// TestConvertInputRedirect tests that links are resolved against the URL after redirects
+func TestConvertInputRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new/dir/page.html", http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprint(w, `<a href="img.png">Image</a>`)
+	}))
+	defer server.Close()
+
+	_, _, source, err := getHTML(server.URL+"/old", "", nil, io.Discard)
+	if err != nil {
+		t.Fatalf("getHTML failed: %v", err)
+	}
+	if source != server.URL+"/new/dir/page.html" {
+		t.Errorf("Expected the final URL as the source, got %s", source)
+	}
+
+	var out strings.Builder
+	cfg := &config{input: server.URL + "/old", links: true, format: "json-compact"}
+	if err := convertInput(cfg, nil, &out, io.Discard); err != nil {
+		t.Fatalf("convertInput failed: %v", err)
+	}
+	expected := `[{"url":"` + server.URL + `/new/dir/img.png","tag":"a","attribute":"href","text":"Image","path":"/html/body/a"}]` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+// TestConvertHTMLMeta tests the page metadata output
+func TestConvertHTMLMeta(t *testing.T) {
+	content := `<head><title>Top</title><link rel="canonical" href="/"><meta property="og:type" content="website"></head>`
+	cfg := &config{input: "https://example.com/index.html", meta: true, format: "json-compact"}
+
+	result, err := convertHTML(cfg, content, "utf-8")
+	if err != nil {
+		t.Fatalf("convertHTML failed: %v", err)
+	}
+	expected := `{"title":"Top","canonical":"https://example.com/","charset":"utf-8","openGraph":{"og:type":"website"}}`
+	if string(result) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+// TestConvertHTMLStructuredData tests the structured data output
+func TestConvertHTMLStructuredData(t *testing.T) {
+	content := `<script type="application/ld+json">{"@type": "Product", "name": "Shoe"}</script>` +
+		`<div itemscope itemtype="https://schema.org/Product"><span itemprop="name">Shoe</span></div>`
+	cfg := &config{input: "-", structuredData: true, format: "json-compact"}
+
+	result, err := convertHTML(cfg, content, "utf-8")
+	if err != nil {
+		t.Fatalf("convertHTML failed: %v", err)
+	}
+	expected := `{"jsonld":[{"@type":"Product","name":"Shoe"}],` +
+		`"microdata":[{"type":["https://schema.org/Product"],"properties":{"name":["Shoe"]}}],"rdfa":[]}`
+	if string(result) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+// TestConvertHTMLArticle tests the article output
+func TestConvertHTMLArticle(t *testing.T) {
+	text := "A paragraph that is long enough to be scored, with a comma, as the text of the article."
+	content := `<title>Story | Site</title><nav><a href="/">Home</a></nav><article><p>` + text + `</p><p>` + text + `</p></article>`
+	cfg := &config{input: "-", article: true, format: "json-compact"}
+
+	result, err := convertHTML(cfg, content, "utf-8")
+	if err != nil {
+		t.Fatalf("convertHTML failed: %v", err)
+	}
+	expected := `{"title":"Story | Site","content":{"div":{"child":[{"article":{"child":[{"p":{"child":"` + text + `"}},{"p":{"child":"` + text + `"}}]}}]}}}`
+	if string(result) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+// TestConvertToHTML tests converting hj output back to HTML in each format
+func TestConvertToHTML(t *testing.T) {
+	doc, err := hj.ParseWithOptions(strings.NewReader(`<p id="a">x &amp; y</p>`), hj.Options{Fragment: true})
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	expected := `<p id="a">x &amp; y</p>`
+
+	for _, format := range []string{"", "json-compact", "cbor", "msgpack"} {
+		t.Run(format, func(t *testing.T) {
+			// 形式の指定がなければJSONとして読む
+			encFormat := format
+			if encFormat == "" {
+				encFormat = "json"
+			}
+			enc, err := hj.LookupEncoder(encFormat)
+			if err != nil {
+				t.Fatalf("LookupEncoder failed: %v", err)
+			}
+			var content strings.Builder
+			if err := doc.Encode(&content, enc, hj.Options{}); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			result, err := convertToHTML(&config{reverse: true, format: format}, []byte(content.String()))
+			if err != nil {
+				t.Fatalf("convertToHTML failed: %v", err)
+			}
+			if result != expected {
+				t.Errorf("Expected %s, got %s", expected, result)
+			}
+		})
+	}
+
+	if _, err := convertToHTML(&config{reverse: true, format: "yaml"}, []byte("p: {}")); err == nil {
+		t.Error("Expected error for yaml input, but got none")
+	}
+	if _, err := convertToHTML(&config{reverse: true, format: "cbor"}, []byte{0xff}); err == nil {
+		t.Error("Expected error for invalid CBOR, but got none")
+	}
+}
+
+// TestCanStream tests which inputs are converted by streaming
+func TestCanStream(t *testing.T) {
+	tests := []struct {
+		cfg      config
+		expected bool
+	}{
+		{config{input: "test.html"}, true},
+		{config{input: "-"}, true},
+		{config{input: "https://example.com"}, false},
+		{config{input: "test.html", lossless: true}, false},
+		{config{input: "test.html", fragment: true}, false},
+		{config{input: "test.html", metadata: true}, false},
+		{config{input: "test.html", selector: "p"}, false},
+		{config{input: "test.html", xpath: "//p"}, false},
+		{config{input: "test.html", format: "json-compact"}, true},
+		{config{input: "test.html", format: "yaml"}, false},
+		{config{input: "test.html", format: "msgpack"}, false},
+		{config{input: "test.html", format: "markdown"}, false},
+		{config{input: "test.html", ndjson: true}, false},
+		{config{input: "test.html", tables: "rows"}, false},
+		{config{input: "test.html", forms: true}, false},
+		{config{input: "test.html", links: true}, false},
+		{config{input: "test.html", meta: true}, false},
+		{config{input: "test.html", structuredData: true}, false},
+		{config{input: "test.html", article: true}, false},
+		{config{input: "test.html", userAgent: "bot/1.0", readTimeout: time.Second}, true},
+		{config{}, false},
+	}
+
+	for _, tt := range tests {
+		if result := canStream(&tt.cfg); result != tt.expected {
+			t.Errorf("canStream(%+v) = %v, expected %v", tt.cfg, result, tt.expected)
+		}
+	}
+}
+
+// TestStreamHTML tests streaming conversion of files
+func TestStreamHTML(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// 整形式のHTMLはツリー変換と同じJSONを出力する
+	wellFormed := filepath.Join(tempDir, "well-formed.html")
+	content := "<html><head><meta charset=\"shift_jis\"></head><body><p id=\"a\">\x82\xa0</p></body></html>"
+	if err := os.WriteFile(wellFormed, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var out strings.Builder
+	streamed, err := streamHTML(wellFormed, "", hj.Options{}, &out)
+	if err != nil {
+		t.Fatalf("streamHTML failed: %v", err)
+	}
+	if !streamed {
+		t.Fatalf("Expected well-formed HTML to be streamed")
+	}
+
+	decoded, _, _, err := getHTML(wellFormed, "", nil, io.Discard)
+	if err != nil {
+		t.Fatalf("getHTML failed: %v", err)
+	}
+	expected, err := hj.HTMLtoJSON(decoded)
+	if err != nil {
+		t.Fatalf("HTMLtoJSON failed: %v", err)
+	}
+	if out.String() != expected+"\n" {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	// 整形式でないHTMLは何も出力せずにツリー変換に任せる
+	malformed := filepath.Join(tempDir, "malformed.html")
+	if err := os.WriteFile(malformed, []byte("<p>a<div>b</div>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	out.Reset()
+	streamed, err = streamHTML(malformed, "", hj.Options{}, &out)
+	if err != nil {
+		t.Fatalf("streamHTML failed: %v", err)
+	}
+	if streamed || out.Len() != 0 {
+		t.Errorf("Expected malformed HTML not to be streamed, got %q", out.String())
+	}
+
+	// 先頭1KBがASCIIで後にwindows-1252の文字がある文書はツリー変換に任せる
+	latin1 := filepath.Join(tempDir, "latin1.html")
+	if err := os.WriteFile(latin1, []byte("<html><head><!--"+strings.Repeat("x", 1100)+"--></head><body><p>caf\xe9</p></body></html>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	out.Reset()
+	streamed, err = streamHTML(latin1, "", hj.Options{}, &out)
+	if err != nil {
+		t.Fatalf("streamHTML failed: %v", err)
+	}
+	if streamed || out.Len() != 0 {
+		t.Errorf("Expected undeclared windows-1252 not to be streamed, got %q", out.String())
+	}
+	out.Reset()
+	if err := convertInput(&config{input: latin1, format: "json-compact"}, nil, &out, io.Discard); err != nil {
+		t.Fatalf("convertInput failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"café"`) {
+		t.Errorf("Expected café, got %s", out.String())
+	}
+
+	// 先頭1KBより後にUTF-8の文字がある文書はストリーミングで変換する
+	utf8File := filepath.Join(tempDir, "utf8.html")
+	if err := os.WriteFile(utf8File, []byte("<html><head><!--"+strings.Repeat("x", 1100)+"--></head><body><p>"+strings.Repeat("日本語 café", 1000)+"</p></body></html>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	out.Reset()
+	if streamed, err := streamHTML(utf8File, "", hj.Options{}, &out); err != nil || !streamed || !strings.Contains(out.String(), "日本語 café日本語") {
+		t.Errorf("Expected UTF-8 to be streamed, got %v %v", streamed, err)
+	}
+
+	if _, err := streamHTML(filepath.Join(tempDir, "missing.html"), "", hj.Options{}, &out); err == nil {
+		t.Error("Expected error for non-existent file, but got none")
+	}
+}
+
+// TestExpandInputs tests expanding patterns and input lists
+func TestExpandInputs(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.html", "b.html", "c.txt", "[x].html"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("<p></p>"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	list := filepath.Join(tempDir, "list.txt")
+	content := "# pages\n" + filepath.Join(tempDir, "c.txt") + "\n\n  https://example.com/  \n" + filepath.Join(tempDir, "a.html") + "\n"
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create input list: %v", err)
+	}
+
+	cfg := &config{
+		inputs:    []string{filepath.Join(tempDir, "*.html"), filepath.Join(tempDir, "*.xml"), filepath.Join(tempDir, "[x].html")},
+		inputList: list,
+	}
+	inputs, err := expandInputs(cfg)
+	if err != nil {
+		t.Fatalf("expandInputs failed: %v", err)
+	}
+
+	// パターンは一致するファイルに展開され、重複は除かれる
+	var got []string
+	for _, input := range inputs {
+		source := strings.TrimPrefix(input.source, tempDir+string(filepath.Separator))
+		if input.err != nil {
+			source += " (" + input.err.Error() + ")"
+		}
+		got = append(got, source)
+	}
+	expected := []string{"[x].html", "a.html", "b.html", "*.xml (no files match the pattern)", "c.txt", "https://example.com/"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	if _, err := expandInputs(&config{inputList: filepath.Join(tempDir, "missing.txt")}); err == nil || !strings.Contains(err.Error(), "failed to read input list") {
+		t.Errorf("Expected input list error, got %v", err)
+	}
+}
+
+// TestExpandInputsRecursive tests finding the files in directories
+func TestExpandInputsRecursive(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"index.html", "a/page.HTM", "a/data.json", "a/b/deep.html", "drafts/new.html", "tmp/x.html", "tmp/keep/y.xhtml"} {
+		path := filepath.Join(tempDir, "site", filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("<p></p>"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	site := filepath.Join(tempDir, "site")
+
+	tests := []struct {
+		name     string
+		cfg      config
+		expected []string
+	}{
+		{
+			name:     "HTML files",
+			cfg:      config{recursive: true},
+			expected: []string{"a/b/deep", "a/page", "drafts/new", "index", "tmp/x"},
+		},
+		{
+			name:     "Excluded directories",
+			cfg:      config{recursive: true, exclude: []string{"drafts", "tmp/*"}},
+			expected: []string{"a/b/deep", "a/page", "index"},
+		},
+		{
+			name:     "Included files",
+			cfg:      config{recursive: true, include: []string{"*.xhtml", "a/*"}},
+			expected: []string{"a/data", "a/page", "tmp/keep/y"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.inputs = []string{site}
+			inputs, err := expandInputs(&tt.cfg)
+			if err != nil {
+				t.Fatalf("expandInputs failed: %v", err)
+			}
+			var names []string
+			for _, input := range inputs {
+				if input.err != nil {
+					t.Errorf("Unexpected error: %v", input.err)
+				}
+				if expected := filepath.Join(site, filepath.FromSlash(input.name)); !strings.HasPrefix(input.source, expected) {
+					t.Errorf("Source %s does not match name %s", input.source, input.name)
+				}
+				names = append(names, input.name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, names)
+			}
+		})
+	}
+}
+
+// TestOutputPath tests the names of the files written to the output directory
+func TestOutputPath(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"page.html", "out/page.json"},
+		{"docs/guide/intro.htm", "out/docs/guide/intro.json"},
+		{"../shared/page.html", "out/page.json"},
+		{"/var/www/index.html", "out/index.json"},
+		{"-", "out/stdin.json"},
+		{"https://example.com", "out/example.com/index.json"},
+		{"https://example.com/news/", "out/example.com/news/index.json"},
+		{"https://example.com:8080/news/1?page=2&q=a b", "out/example.com_8080/news/1_page_2_q_a_b.json"},
+	}
+
+	for _, tt := range tests {
+		if path := filepath.ToSlash(outputPath("out", filepath.FromSlash(tt.source), ".json")); path != tt.expected {
+			t.Errorf("outputPath(%q) = %q, expected %q", tt.source, path, tt.expected)
+		}
+	}
+}
+
+// TestRunBatch tests converting several inputs with their outputs combined or written to files
+func TestRunBatch(t *testing.T) {
+	tempDir := t.TempDir()
+	pages := map[string]string{
+		"a.html":     "<title>A</title><p>one</p>",
+		"sub/b.html": "<title>B</title><p>two</p>",
+	}
+	var inputs []batchInput
+	for name, content := range pages {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	a, b := filepath.Join(tempDir, "a.html"), filepath.Join(tempDir, "sub", "b.html")
+	missing := filepath.Join(tempDir, "missing.html")
+	inputs = []batchInput{{source: a}, {source: missing}, {source: b}}
+
+	tests := []struct {
+		name     string
+		cfg      config
+		expected string
+	}{
+		{
+			name:     "Combined object",
+			cfg:      config{format: "json-compact", meta: true, jobs: 2},
+			expected: `{"` + a + `":{"title":"A","charset":"utf-8"},"` + b + `":{"title":"B","charset":"utf-8"}}` + "\n",
+		},
+		{
+			name:     "Lines",
+			cfg:      config{lines: true, xpath: "string(//p)"},
+			expected: `{"source":"` + a + `","result":"one"}` + "\n" + `{"source":"` + b + `","result":"two"}` + "\n",
+		},
+		{
+			name:     "YAML",
+			cfg:      config{format: "yaml", xpath: "string(//title)"},
+			expected: a + ": A\n" + b + ": B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errs strings.Builder
+			failed, err := runBatch(&tt.cfg, slices.Clone(inputs), nil, &out, &errs)
+			if err != nil {
+				t.Fatalf("runBatch failed: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, out.String())
+			}
+			// 失敗した入力は報告され、他の入力は変換される
+			if failed != 1 || !strings.HasPrefix(errs.String(), "Error: "+missing+": failed to read file") {
+				t.Errorf("Expected one failure, got %d: %s", failed, errs.String())
+			}
+		})
+	}
+}
+
+// TestRunBatchOutDir tests writing one file per input
+func TestRunBatchOutDir(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "in", "sub"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "in", "a.html"), []byte("<p>one</p>"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "in", "sub", "a.html"), []byte("<p>two</p>"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "a.htm"), []byte("<p>three</p>"), 0644)
+
+	// 入力の相対パスで出力ファイルを作る
+	t.Chdir(tempDir)
+	outDir := filepath.Join(tempDir, "out")
+	cfg := &config{outDir: outDir, format: "markdown"}
+	inputs := []batchInput{{source: filepath.Join("in", "a.html")}, {source: filepath.Join("in", "sub", "a.html")}, {source: "a.htm"}, {source: filepath.Join(tempDir, "a.htm")}}
+	var out, errs strings.Builder
+	failed, err := runBatch(cfg, inputs, nil, &out, &errs)
+	if err != nil {
+		t.Fatalf("runBatch failed: %v", err)
+	}
+	if failed != 1 || !strings.Contains(errs.String(), "is also written for a.htm") || out.Len() != 0 {
+		t.Errorf("Expected one duplicate output file, got %d: %s", failed, errs.String())
+	}
+
+	for name, expected := range map[string]string{"in/a.md": "one\n", "in/sub/a.md": "two\n", "a.md": "three\n"} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", name, err)
+		} else if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, data)
+		}
+	}
+}
+
+// TestRunBatchUpToDate tests skipping inputs whose output file is newer
+func TestRunBatchUpToDate(t *testing.T) {
+	tempDir := t.TempDir()
+	site, outDir := filepath.Join(tempDir, "site"), filepath.Join(tempDir, "json")
+	os.MkdirAll(filepath.Join(site, "docs"), 0755)
+	os.WriteFile(filepath.Join(site, "index.html"), []byte("<p>index</p>"), 0644)
+	os.WriteFile(filepath.Join(site, "docs", "a.html"), []byte("<p>a</p>"), 0644)
+
+	cfg := &config{inputs: []string{site}, recursive: true, outDir: outDir, format: "text"}
+	run := func() {
+		inputs, err := expandInputs(cfg)
+		if err != nil {
+			t.Fatalf("expandInputs failed: %v", err)
+		}
+		var out, errs strings.Builder
+		if failed, err := runBatch(cfg, inputs, nil, &out, &errs); failed != 0 || err != nil {
+			t.Fatalf("runBatch failed: %d %v %s", failed, err, errs.String())
+		}
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		return string(data)
+	}
+	run()
+	if read("index.txt") != "index\n" || read("docs/a.txt") != "a\n" {
+		t.Fatalf("Unexpected output: %q %q", read("index.txt"), read("docs/a.txt"))
+	}
+
+	// 出力が入力より新しいファイルは変換しない
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	os.WriteFile(filepath.Join(outDir, "index.txt"), []byte("kept"), 0644)
+	os.Chtimes(filepath.Join(outDir, "index.txt"), future, future)
+	os.WriteFile(filepath.Join(outDir, "docs", "a.txt"), []byte("stale"), 0644)
+	os.Chtimes(filepath.Join(outDir, "docs", "a.txt"), past, past)
+	run()
+	if read("index.txt") != "kept" || read("docs/a.txt") != "a\n" {
+		t.Errorf("Expected only the stale output to be converted, got %q %q", read("index.txt"), read("docs/a.txt"))
+	}
+
+	// --forceではすべて変換する
+	cfg.force = true
+	run()
+	if read("index.txt") != "index\n" {
+		t.Errorf("Expected the output to be converted with --force, got %q", read("index.txt"))
+	}
+}
+
+// TestCrawl tests writing one JSON line per crawled page
+func TestCrawl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case "/":
+			fmt.Fprint(w, `<title>Home</title><a href="/a">A</a> <a href="/private">Private</a>`)
+		case "/a":
+			fmt.Fprint(w, `<p>A</p><a href="/b">B</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config{input: server.URL, crawl: true, depth: 1}
+	var out strings.Builder
+	if err := crawl(context.Background(), cfg, &hj.Fetcher{}, &out); err != nil {
+		t.Fatalf("crawl failed: %v", err)
+	}
+
+	// 1ページ1行で出力し、深さ1より先と禁止されたページは取得しない
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d:\n%s", len(lines), out.String())
+	}
+	for i, path := range []string{"/", "/a"} {
+		var page struct {
+			URL       string          `json:"url"`
+			Status    int             `json:"status"`
+			FetchedAt time.Time       `json:"fetchedAt"`
+			Depth     int             `json:"depth"`
+			Document  json.RawMessage `json:"document"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &page); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", lines[i], err)
+		}
+		if page.URL != server.URL+path || page.Status != 200 || page.Depth != i || page.FetchedAt.IsZero() || len(page.Document) == 0 {
+			t.Errorf("Unexpected page for %s: %s", path, lines[i])
+		}
+	}
+}
+
 // TestGetHTMLWithEmptyInput tests getHTML with empty input
 func TestGetHTMLWithEmptyInput(t *testing.T) {
 	// showHelp関数が呼ばれ、os.Exit(0)が実行されるため、
@@ -274,7 +1270,7 @@ func BenchmarkGetHTMLFile(t *testing.B) {
 
 	t.ResetTimer()
 	for i := 0; i < t.N; i++ {
-		_, err := getHTML(testFile)
+		_, _, _, err := getHTML(testFile, "", nil, io.Discard)
 		if err != nil {
 			t.Fatalf("Benchmark getHTML failed: %v", err)
 		}
@@ -290,10 +1286,81 @@ func Example_showHelp() {
 	// Usage:
 	//   hj [HTMLfilePath|URL]     - Read HTML from file or URL and convert to JSON
 	//   cat file.html | hj -      - Read HTML from stdin and convert to JSON
+	//   hj a.html 'docs/*.html'   - Convert several inputs into one JSON object keyed by input
+	//   hj crawl <URL> [options]  - Crawl a website and output one JSON line per page
 	//   hj --help                 - Show this help message
 	//
+	// Options:
+	//   -r, --reverse             - Read JSON produced by hj and convert it back to HTML
+	//   --lossless                - Keep doctype, comments, whitespace and raw text
+	//   --fragment [context]      - Parse an HTML fragment inside a context element (default: body)
+	//   --encoding <name>         - Read the input in this character encoding instead of detecting it
+	//   --metadata                - Add the source and detected encoding to the output
+	//   --select <selector>       - Output an array of the elements matching a CSS selector
+	//   --xpath <expression>      - Output the result of an XPath 1.0 expression
+	//   --format <name>           - Output format: json, json-compact, yaml, toml, xml, cbor, msgpack, text or markdown (default: json)
+	//   --ndjson                  - Output one JSON object per element with its path, depth and direct text
+	//   --tables [mode]           - Output the tables with rows as arrays (rows), objects (objects) or CSV (csv)
+	//   --forms                   - Output the forms with their action, method and controls
+	//   --links                   - Output the URLs of links, images, scripts and other resources
+	//   --meta                    - Output the title, description, OpenGraph, Twitter card and other page metadata
+	//   --structured-data         - Output the JSON-LD, Microdata and RDFa structured data
+	//   --article                 - Output the title, byline, date, lead image and main content of an article
+	//   -h, --help                - Show this help message
+	//
+	// HTTP options:
+	//   --connect-timeout <time>  - Time allowed to connect, in seconds or with a unit such as 500ms (default: 30)
+	//   --read-timeout <time>     - Time allowed to wait for data from the server (default: 60)
+	//   -H, --header <header>     - Send an extra header such as 'Accept-Language: ja' (repeatable)
+	//   --user-agent <string>     - Send this User-Agent header
+	//   --cookies <file>          - Send the cookies in a Netscape cookies.txt file
+	//   --user <user:password>    - Authenticate with HTTP basic authentication
+	//   --bearer <token>          - Authenticate with a bearer token
+	//   --proxy <url>             - Use an HTTP or HTTPS proxy (default: HTTP_PROXY and HTTPS_PROXY)
+	//   --cacert <file>           - Verify servers with the CA certificates in a PEM file
+	//   --insecure                - Do not verify the TLS certificates of servers
+	//   --retries <n>             - Retry network errors, 429 and 5xx responses up to n times (default: 0)
+	//   --retry-wait <time>       - Wait before the first retry, doubled for each retry after it (default: 1)
+	//   --max-retry-wait <time>   - Longest wait between retries, including Retry-After (default: 30)
+	//   --allow-http-errors       - Convert the page sent with an HTTP error status instead of failing
+	//
+	// Batch options:
+	//   --input-list <file>       - Also convert the files and URLs listed one per line in a file (- for stdin)
+	//   -j, --jobs <n>            - Convert up to n inputs at once (default: number of CPUs)
+	//   --out-dir <dir>           - Write the output of each input to its own file in a directory
+	//   --lines                   - Output one JSON line per input with its source and result
+	//   -R, --recursive           - Convert the .html and .htm files in directories and their subdirectories
+	//   --include <pattern>       - Convert the files in directories matching a pattern such as '*.xhtml' instead (repeatable)
+	//   --exclude <pattern>       - Skip the files and directories matching a pattern such as 'drafts/*' (repeatable)
+	//   --force                   - Convert inputs even when their file in --out-dir is newer than them
+	//
+	// Crawl options:
+	//   --depth <n>               - Follow links up to n steps away from the start page (default: 3)
+	//   --max-pages <n>           - Stop after n pages, or 0 for no limit (default: 100)
+	//   --delay <time>            - Wait between requests, or the Crawl-delay of robots.txt if longer (default: 1)
+	//   --ignore-robots           - Crawl without reading robots.txt
+	//
 	// Examples:
 	//   hj index.html
 	//   hj https://example.com
 	//   cat test.html | hj -
+	//   hj index.html | hj --reverse -
+	//   echo '<li>a</li><li>b</li>' | hj --fragment ul -
+	//   hj --select 'div#content > p.lead' index.html
+	//   hj --xpath '//a/@href' index.html
+	//   hj --format yaml index.html
+	//   hj --format markdown --select article https://example.com/news/1
+	//   hj --format cbor index.html | hj --reverse --format cbor -
+	//   hj --ndjson index.html > elements.ndjson
+	//   hj --tables csv index.html
+	//   hj --forms https://example.com/login
+	//   hj --links https://example.com | jq -r '.[].url'
+	//   hj --structured-data product.html | jq '.jsonld'
+	//   hj --article https://example.com/news/1 | jq '.content'
+	//   hj -H 'Accept-Language: ja' --cookies cookies.txt --read-timeout 10 https://example.com/account
+	//   hj --retries 3 --allow-http-errors https://example.com/missing
+	//   hj --jobs 8 --out-dir out 'pages/*.html'
+	//   hj --input-list urls.txt --lines --meta > meta.ndjson
+	//   hj --recursive ./site --exclude 'drafts' --out-dir ./json
+	//   hj crawl --depth 2 --max-pages 50 https://example.com > site.ndjson
 }
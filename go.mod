@@ -3,3 +3,5 @@ module github.com/HARMONICOM/hj
 go 1.25.0
 
 require golang.org/x/net v0.43.0
+
+require golang.org/x/text v0.28.0